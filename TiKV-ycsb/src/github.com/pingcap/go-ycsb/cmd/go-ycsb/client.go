@@ -163,6 +163,7 @@ func (c *client) Run() {
 			select {
 			case <-t.C:
 				measurement.Output()
+				outputDBStats()
 			case <-measureCtx.Done():
 				return
 			}
@@ -175,6 +176,7 @@ func (c *client) Run() {
 
 	fmt.Printf("Run finished, takes %s\n", time.Now().Sub(start))
 	measurement.Output()
+	outputDBStats()
 }
 
 func runClientCommandFunc(cmd *cobra.Command, args []string, doTransactions bool) {
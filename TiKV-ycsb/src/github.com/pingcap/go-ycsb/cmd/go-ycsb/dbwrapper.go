@@ -15,6 +15,9 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/pingcap/go-ycsb/pkg/measurement"
@@ -25,6 +28,41 @@ type dbWrapper struct {
 	ycsb.DB
 }
 
+// statsDB is implemented by the databases which keep their own counters.
+type statsDB interface {
+	Stats() map[string]int64
+}
+
+// outputDBStats prints the counters of the global database if it has any.
+func outputDBStats() {
+	db, ok := globalDB.(dbWrapper)
+	if !ok {
+		return
+	}
+
+	s, ok := db.DB.(statsDB)
+	if !ok {
+		return
+	}
+
+	stats := s.Stats()
+	if len(stats) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		items = append(items, fmt.Sprintf("%s: %d", name, stats[name]))
+	}
+	fmt.Printf("DB - %s\n", strings.Join(items, ", "))
+}
+
 func (db dbWrapper) Read(ctx context.Context, table string, key string, fields []string) (map[string][]byte, error) {
 	start := time.Now()
 	defer func() {
@@ -69,3 +107,53 @@ func (db dbWrapper) Delete(ctx context.Context, table string, key string) error
 
 	return db.DB.Delete(ctx, table, key)
 }
+
+// BatchRead measures the whole batch as one BATCH_READ, a database which is not
+// a ycsb.BatchDB reads the keys one by one, measured as one READ each.
+func (db dbWrapper) BatchRead(ctx context.Context, table string, keys []string, fields []string) ([]map[string][]byte, error) {
+	batchDB, ok := db.DB.(ycsb.BatchDB)
+	if !ok {
+		rows := make([]map[string][]byte, len(keys))
+		for i, key := range keys {
+			row, err := db.Read(ctx, table, key, fields)
+			if err != nil {
+				return nil, err
+			}
+			rows[i] = row
+		}
+		return rows, nil
+	}
+
+	start := time.Now()
+	defer func() {
+		measurement.Measure("BATCH_READ", time.Now().Sub(start))
+	}()
+
+	return batchDB.BatchRead(ctx, table, keys, fields)
+}
+
+// BatchInsert measures the whole batch as one BATCH_INSERT, a database which is
+// not a ycsb.BatchDB inserts the records one by one, measured as one INSERT
+// each.
+func (db dbWrapper) BatchInsert(ctx context.Context, table string, keys []string, values []map[string][]byte) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("batch of %d keys has %d rows", len(keys), len(values))
+	}
+
+	batchDB, ok := db.DB.(ycsb.BatchDB)
+	if !ok {
+		for i, key := range keys {
+			if err := db.Insert(ctx, table, key, values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := time.Now()
+	defer func() {
+		measurement.Measure("BATCH_INSERT", time.Now().Sub(start))
+	}()
+
+	return batchDB.BatchInsert(ctx, table, keys, values)
+}
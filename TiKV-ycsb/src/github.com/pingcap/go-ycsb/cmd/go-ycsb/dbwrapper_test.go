@@ -0,0 +1,62 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/go-ycsb/pkg/measurement"
+	"github.com/pingcap/go-ycsb/pkg/ycsb"
+)
+
+// insertDB is a ycsb.DB without batches which records its inserts.
+type insertDB struct {
+	ycsb.DB
+	keys []string
+}
+
+func (db *insertDB) Insert(ctx context.Context, table string, key string, values map[string][]byte) error {
+	db.keys = append(db.keys, key)
+	return nil
+}
+
+func TestBatchInsertFallback(t *testing.T) {
+	measurement.InitMeasure(properties.NewProperties())
+
+	tests := []struct {
+		keys    []string
+		values  []map[string][]byte
+		wantErr bool
+	}{
+		{keys: nil, values: nil},
+		{keys: []string{"a", "b"}, values: []map[string][]byte{{}, {}}},
+		{keys: []string{"a", "b"}, values: []map[string][]byte{{}}, wantErr: true},
+		{keys: []string{"a"}, values: []map[string][]byte{{}, {}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		db := &insertDB{}
+		err := dbWrapper{db}.BatchInsert(context.Background(), "t", tt.keys, tt.values)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("BatchInsert of %d keys and %d rows: err %v, want error %v", len(tt.keys), len(tt.values), err, tt.wantErr)
+		}
+		if !tt.wantErr && len(db.keys) != len(tt.keys) {
+			t.Errorf("BatchInsert inserted %v, want %v", db.keys, tt.keys)
+		}
+		if tt.wantErr && len(db.keys) != 0 {
+			t.Errorf("BatchInsert of a bad batch inserted %v", db.keys)
+		}
+	}
+}
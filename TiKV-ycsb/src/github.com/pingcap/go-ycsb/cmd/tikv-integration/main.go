@@ -0,0 +1,196 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration
+// +build integration
+
+// The tikv-integration command runs the operations of the TiKV drivers end to
+// end against a real cluster, the one of the PD endpoints in TIKV_PD:
+//
+//	TIKV_PD=127.0.0.1:2379 go run -tags integration ./cmd/tikv-integration
+//
+// Every driver type writes to its own new table, which is deleted at the end.
+// Without TIKV_PD it does nothing, so it can run in any environment.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/go-ycsb/db/tikv"
+	"github.com/pingcap/go-ycsb/pkg/prop"
+	"github.com/pingcap/go-ycsb/pkg/ycsb"
+)
+
+type writeWithDB interface {
+	InsertWith(ctx context.Context, table string, key string, values map[string][]byte, opts tikv.WriteOptions) error
+}
+
+type capabilityDB interface {
+	Capabilities() tikv.Capability
+}
+
+func main() {
+	pd := os.Getenv("TIKV_PD")
+	if pd == "" {
+		fmt.Println("TIKV_PD is not set, skipping the TiKV integration checks")
+		return
+	}
+
+	failed := false
+	for _, tp := range []string{"raw", "txn", "mixed"} {
+		if err := check(tp, pd); err != nil {
+			fmt.Printf("%s: FAIL: %v\n", tp, err)
+			failed = true
+		} else {
+			fmt.Printf("%s: ok\n", tp)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func row(v0 string, v1 string) map[string][]byte {
+	return map[string][]byte{"field0": []byte(v0), "field1": []byte(v1)}
+}
+
+func check(tp string, pd string) error {
+	p := properties.NewProperties()
+	p.Set("tikv.pd", pd)
+	p.Set("tikv.type", tp)
+	p.Set(prop.FieldCount, "2")
+
+	db, err := ycsb.GetDBCreator("tikv").Create(p)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := db.InitThread(context.Background(), 0, 1)
+	defer db.CleanupThread(ctx)
+
+	table := fmt.Sprintf("integration_%s_%d", tp, time.Now().UnixNano())
+	keys := []string{"user1", "user2", "user3", "user4", "user5"}
+	defer func() {
+		for _, key := range keys {
+			db.Delete(ctx, table, key)
+		}
+	}()
+
+	for _, key := range keys[:3] {
+		if err := db.Insert(ctx, table, key, row(key, "b")); err != nil {
+			return fmt.Errorf("insert: %v", err)
+		}
+	}
+	if err := expectRead(ctx, db, table, "user1", row("user1", "b")); err != nil {
+		return err
+	}
+
+	if err := db.Update(ctx, table, "user1", map[string][]byte{"field0": []byte("new")}); err != nil {
+		return fmt.Errorf("update: %v", err)
+	}
+	if err := expectRead(ctx, db, table, "user1", row("new", "b")); err != nil {
+		return err
+	}
+
+	if err := expectScan(ctx, db, table, 3); err != nil {
+		return err
+	}
+	if err := db.Delete(ctx, table, "user2"); err != nil {
+		return fmt.Errorf("delete: %v", err)
+	}
+	if err := expectRead(ctx, db, table, "user2", nil); err != nil {
+		return err
+	}
+	if err := expectScan(ctx, db, table, 2); err != nil {
+		return err
+	}
+
+	if err := checkBatch(ctx, db, table); err != nil {
+		return err
+	}
+	return checkOptional(ctx, db, table)
+}
+
+func expectRead(ctx context.Context, db ycsb.DB, table string, key string, want map[string][]byte) error {
+	got, err := db.Read(ctx, table, key, nil)
+	if err != nil {
+		return fmt.Errorf("read %s: %v", key, err)
+	}
+	if len(got) == 0 && len(want) == 0 {
+		return nil
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("read %s: got %q, want %q", key, got, want)
+	}
+	return nil
+}
+
+func expectScan(ctx context.Context, db ycsb.DB, table string, want int) error {
+	rows, err := db.Scan(ctx, table, "user", 10, nil)
+	if err != nil {
+		return fmt.Errorf("scan: %v", err)
+	}
+	if len(rows) != want {
+		return fmt.Errorf("scan: got %d rows, want %d", len(rows), want)
+	}
+	return nil
+}
+
+func checkBatch(ctx context.Context, db ycsb.DB, table string) error {
+	batch, ok := db.(ycsb.BatchDB)
+	if !ok {
+		return fmt.Errorf("not a ycsb.BatchDB")
+	}
+
+	if err := batch.BatchInsert(ctx, table, []string{"user4", "user5"}, []map[string][]byte{row("4", "b"), row("5", "b")}); err != nil {
+		return fmt.Errorf("batch insert: %v", err)
+	}
+	rows, err := batch.BatchRead(ctx, table, []string{"user4", "user2", "user5"}, nil)
+	if err != nil {
+		return fmt.Errorf("batch read: %v", err)
+	}
+	if len(rows) != 3 || !reflect.DeepEqual(rows[0], row("4", "b")) || rows[1] != nil || !reflect.DeepEqual(rows[2], row("5", "b")) {
+		return fmt.Errorf("batch read: got %q", rows)
+	}
+	return nil
+}
+
+// checkOptional checks the TTL and CAS writes against the capabilities: the
+// unsupported ones must fail instead of silently writing something else.
+func checkOptional(ctx context.Context, db ycsb.DB, table string) error {
+	c, ok := db.(capabilityDB)
+	if !ok {
+		return fmt.Errorf("no Capabilities")
+	}
+	caps := c.Capabilities()
+
+	if w, ok := db.(writeWithDB); ok {
+		err := w.InsertWith(ctx, table, "user1", row("ttl", "b"), tikv.WriteOptions{TTL: time.Minute})
+		if caps.Has(tikv.CapTTL) && err != nil {
+			return fmt.Errorf("insert with TTL: %v", err)
+		} else if !caps.Has(tikv.CapTTL) && err == nil {
+			return fmt.Errorf("insert with TTL succeeded without %s", tikv.CapTTL)
+		}
+	}
+
+	if !caps.Has(tikv.CapCAS) {
+		fmt.Printf("%s: skipping CAS, the driver has %s\n", table, caps)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// backupMagic starts every backup, the last byte is the version of the format.
+const backupMagic = "YCSBKV\x00\x01"
+
+// maxBackupEntry bounds the length of a key or a value read by Restore, so a
+// corrupt length fails instead of allocating it.
+const maxBackupEntry = 64 << 20
+
+// Backup writes the stored pairs of the table to w as they are, in the order
+// of the keys. After backupMagic every pair is the 4 bytes big-endian length
+// of the key, the key, the 4 bytes length of the value and the value. The keys
+// are stored without the table prefix, so Restore can load them into another
+// table with the same layout.
+func (db *rawDB) Backup(ctx context.Context, table string, w io.Writer) error {
+	prefix := db.tableCodec(table).appendTablePrefix(nil, table)
+	it := db.newIterator(ctx, prefix, kv.Key(prefix).PrefixNext())
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(backupMagic); err != nil {
+		return err
+	}
+
+	var n [4]byte
+	for it.Next() {
+		for _, b := range [][]byte{it.Key()[len(prefix):], it.Value()} {
+			binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+			if _, err := bw.Write(n[:]); err != nil {
+				return err
+			}
+			if _, err := bw.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Restore puts the pairs written by Backup into the table unchanged and
+// returns on the first error. The pairs are put one by one, and the pairs
+// before a failed one stay restored.
+func (db *rawDB) Restore(ctx context.Context, table string, r io.Reader) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != backupMagic {
+		return fmt.Errorf("restore of table %s: not a backup", table)
+	}
+
+	prefix := db.tableCodec(table).appendTablePrefix(nil, table)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		key, err := readBackupEntry(br)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("restore of table %s: %v", table, err)
+		}
+		value, err := readBackupEntry(br)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return fmt.Errorf("restore of table %s: %v", table, err)
+		}
+
+		rowKey := append(prefix[:len(prefix):len(prefix)], key...)
+		if err := db.db.Put(rowKey, value); err != nil {
+			return err
+		}
+		db.keepWrite(ctx, rowKey, value)
+	}
+}
+
+// readBackupEntry reads a length-prefixed key or value, it returns io.EOF only
+// if r ends before the length.
+func readBackupEntry(r io.Reader) ([]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	size := binary.BigEndian.Uint32(n[:])
+	if size > maxBackupEntry {
+		return nil, fmt.Errorf("entry of %d bytes exceeds %d bytes", size, maxBackupEntry)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	rows := map[string]map[string][]byte{
+		"user1":  {"field0": []byte("a"), "field1": []byte("\x00\xff")},
+		"user2":  {"field0": []byte("")},
+		"user10": {"field1": bytes.Repeat([]byte("x"), 70000)},
+	}
+	tests := [][]string{
+		nil,
+		{tikvRawKeyspacePrefix, "run1/"},
+		{tikvRawSaltBuckets, "4"},
+		{tikvRawReverseKey, "true"},
+		{tikvRawEncoding, "json"},
+	}
+	for _, kvs := range tests {
+		kvs = append([]string{"fieldcount", "2"}, kvs...)
+		src, srcPairs := newTestRawDB(t, kvs...)
+		for key, values := range rows {
+			if err := src.Insert(ctx, "usertable", key, values); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := src.Insert(ctx, "other", "user1", rows["user1"]); err != nil {
+			t.Fatal(err)
+		}
+
+		var backup bytes.Buffer
+		if err := src.Backup(ctx, "usertable", &backup); err != nil {
+			t.Fatalf("%v: Backup: %v", kvs, err)
+		}
+		dst, dstPairs := newTestRawDB(t, kvs...)
+		if err := dst.Restore(ctx, "usertable", bytes.NewReader(backup.Bytes())); err != nil {
+			t.Fatalf("%v: Restore: %v", kvs, err)
+		}
+
+		// The pairs are restored byte for byte, without the other table.
+		want := make(map[string][]byte)
+		for k, v := range srcPairs.pairs {
+			if !strings.Contains(k, "other:") {
+				want[k] = v
+			}
+		}
+		if !reflect.DeepEqual(dstPairs.pairs, want) {
+			t.Errorf("%v: restored the keys %q, want %q", kvs, dstPairs.keys(), srcPairs.keys())
+		}
+		for key, values := range rows {
+			if got, err := dst.Read(ctx, "usertable", key, nil); err != nil || !sameRow(got, values) {
+				t.Errorf("%v: Read(%s) of the restore = %q, %v, want %q", kvs, key, got, err, values)
+			}
+		}
+	}
+}
+
+func TestRestoreCorrupt(t *testing.T) {
+	entry := func(b string) string {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+		return string(n[:]) + b
+	}
+	tests := []struct {
+		backup string
+		want   string
+		// restored is the number of pairs restored before the error.
+		restored int
+	}{
+		{"", "not a backup", 0},
+		{"YCSBKV\x00\x02", "not a backup", 0},
+		{backupMagic + entry("user1") + entry("v") + "\x00\x00", "unexpected EOF", 1},
+		{backupMagic + entry("user1"), "unexpected EOF", 0},
+		{backupMagic + entry("user1") + "\x00\x00\x00\x05v", "unexpected EOF", 0},
+		{backupMagic + "\xff\xff\xff\xff", "exceeds", 0},
+	}
+	for _, tt := range tests {
+		db, m := newTestRawDB(t)
+		err := db.Restore(context.Background(), "usertable", strings.NewReader(tt.backup))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Restore(%q): err %v, want %s", tt.backup, err, tt.want)
+		}
+		if n := len(m.keys()); n != tt.restored {
+			t.Errorf("Restore(%q) restored %d pairs, want %d", tt.backup, n, tt.restored)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+)
+
+// BatchRead and BatchInsert implement ycsb.BatchDB, so go-ycsb measures each
+// call as one BATCH_READ or BATCH_INSERT. The rows are returned in the order of
+// the keys, a missing row is nil, and values[i] is the row of keys[i].
+
+// BatchRead reads the keys one by one.
+func (db *rawDB) BatchRead(ctx context.Context, table string, keys []string, fields []string) ([]map[string][]byte, error) {
+	rows := make([]map[string][]byte, len(keys))
+	for i, key := range keys {
+		row, err := db.Read(ctx, table, key, fields)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// BatchInsert inserts the rows one by one, so the rows before a failed one stay
+// inserted. With tikvRawEncodeWorkers the rows are all encoded in parallel
+// first. With tikvRawDetectDuplicates the keys are all checked first.
+func (db *rawDB) BatchInsert(ctx context.Context, table string, keys []string, values []map[string][]byte) error {
+	if err := checkBatch(keys, values); err != nil {
+		return err
+	}
+	if db.cfg.DetectDuplicates != "" {
+		if err := db.checkDuplicates(ctx, table, keys); err != nil {
+			return err
+		}
+	}
+
+	c := db.tableCodec(table)
+	if c.encodeWorkers <= 1 {
+		for i, key := range keys {
+			if err := db.Insert(ctx, table, key, values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	insertKeys := make([]string, len(keys))
+	rows := make([]map[string][]byte, len(keys))
+	for i, key := range keys {
+		row, err := c.insertValues(values[i])
+		if err != nil {
+			return &RawError{Op: "insert", Table: table, Key: key, Err: err}
+		}
+		insertKeys[i], rows[i] = c.insertKey(key, row), row
+	}
+
+	encoded, err := c.encodeRows(rows)
+	if err != nil {
+		return &RawError{Op: "insert", Table: table, Err: err}
+	}
+	for i, key := range insertKeys {
+		if err := db.putEncoded(ctx, table, key, encoded[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putEncoded puts the row of the key, already encoded, like Insert.
+func (db *rawDB) putEncoded(ctx context.Context, table string, key string, rowData []byte) (err error) {
+	defer wrapRawError(&err, "insert", table, key)
+
+	op := db.profile.begin("insert")
+	defer op.end()
+
+	rowKey, err := db.tableCodec(table).getRowKey(table, key)
+	if err != nil {
+		return err
+	}
+	return db.put(ctx, &op, rowKey, rowData, writeBase{})
+}
+
+// BatchRead is TxnBatchRead.
+func (db *txnDB) BatchRead(ctx context.Context, table string, keys []string, fields []string) ([]map[string][]byte, error) {
+	return db.TxnBatchRead(ctx, table, keys, fields)
+}
+
+// BatchInsert is TxnInsert, a key given twice is written once with its last
+// values. With tikvTxnBatchBytes the rows are split into transactions of up
+// to that many bytes instead, as the rows are added in the order of the keys.
+// With tikvRawDetectDuplicates the keys are all checked first.
+func (db *txnDB) BatchInsert(ctx context.Context, table string, keys []string, values []map[string][]byte) error {
+	if err := checkBatch(keys, values); err != nil {
+		return err
+	}
+	if db.detectDuplicates != "" {
+		if err := db.checkDuplicates(ctx, table, keys); err != nil {
+			return err
+		}
+	}
+
+	entries := make(map[string]map[string][]byte, len(keys))
+	for i, key := range keys {
+		entries[key] = values[i]
+	}
+	return db.txnInsert(ctx, table, entries, db.batchLimit())
+}
+
+// batchLimit returns the bytes of a transaction of BatchInsert.
+func (db *txnDB) batchLimit() int {
+	if db.batchBytes > 0 && db.batchBytes < db.splitBytes {
+		return db.batchBytes
+	}
+	return db.splitBytes
+}
+
+// BatchRead is routed like Read.
+func (db *mixedDB) BatchRead(ctx context.Context, table string, keys []string, fields []string) ([]map[string][]byte, error) {
+	if txn, ok := db.route("read").(*txnDB); ok {
+		return txn.BatchRead(ctx, table, keys, fields)
+	}
+	return db.raw.BatchRead(ctx, table, keys, fields)
+}
+
+// BatchInsert is routed like Insert.
+func (db *mixedDB) BatchInsert(ctx context.Context, table string, keys []string, values []map[string][]byte) error {
+	if txn, ok := db.route("insert").(*txnDB); ok {
+		return txn.BatchInsert(ctx, table, keys, values)
+	}
+	return db.raw.BatchInsert(ctx, table, keys, values)
+}
+
+func checkBatch(keys []string, values []map[string][]byte) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("batch of %d keys has %d rows", len(keys), len(values))
+	}
+	return nil
+}
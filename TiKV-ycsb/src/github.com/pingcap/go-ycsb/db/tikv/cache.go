@@ -0,0 +1,78 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingcap/tidb/util/kvcache"
+)
+
+// readCache is a bounded LRU cache of the encoded rows by the row key, whose
+// entries expire after a TTL. It is safe for concurrent use.
+type readCache struct {
+	mu    sync.Mutex
+	cache *kvcache.SimpleLRUCache
+	ttl   time.Duration
+}
+
+// readCacheEntry is updated in place, as the LRU cache never replaces the
+// value of a key.
+type readCacheEntry struct {
+	row []byte
+	// expire is zero if the entry is invalidated.
+	expire time.Time
+}
+
+func newReadCache(size int64, ttl time.Duration) *readCache {
+	return &readCache{cache: kvcache.NewSimpleLRUCache(size), ttl: ttl}
+}
+
+// get returns the cached row, the row is shared and must not be modified.
+func (c *readCache) get(rowKey []byte) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.cache.Get(rowKeyCacheKey(rowKey))
+	if !ok {
+		return nil, false
+	}
+
+	entry := v.(*readCacheEntry)
+	if entry.expire.IsZero() || time.Now().After(entry.expire) {
+		return nil, false
+	}
+	return entry.row, true
+}
+
+func (c *readCache) put(rowKey []byte, row []byte) {
+	c.set(rowKey, append([]byte(nil), row...), time.Now().Add(c.ttl))
+}
+
+// invalidate drops the cached row. The LRU cache can not delete, so it keeps
+// an invalidated entry until it is evicted.
+func (c *readCache) invalidate(rowKey []byte) {
+	c.set(rowKey, nil, time.Time{})
+}
+
+func (c *readCache) set(rowKey []byte, row []byte, expire time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := rowKeyCacheKey(rowKey)
+	if v, ok := c.cache.Get(key); ok {
+		*v.(*readCacheEntry) = readCacheEntry{row: row, expire: expire}
+		return
+	}
+	c.cache.Put(key, &readCacheEntry{row: row, expire: expire})
+}
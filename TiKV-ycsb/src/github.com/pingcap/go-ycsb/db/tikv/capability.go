@@ -0,0 +1,89 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"strings"
+
+	"github.com/pingcap/go-ycsb/pkg/ycsb"
+)
+
+// Capability is a set of the optional features of a driver, so a harness can
+// skip the operations a driver does not support instead of failing them.
+type Capability uint32
+
+// The capabilities.
+const (
+	// CapScan is Scan.
+	CapScan Capability = 1 << iota
+	// CapBatch is writing or reading a group of rows in one call, like
+	// TxnInsert and TxnBatchRead.
+	CapBatch
+	// CapTxn is running several operations in one transaction, like RunInTxn.
+	CapTxn
+	// CapTTL is writing rows which expire.
+	CapTTL
+	// CapCAS is writing a row only if it still has an expected value.
+	CapCAS
+	// CapReplicaRead is reading from a follower.
+	CapReplicaRead
+	// CapStaleRead is reading an older version from the nearest replica.
+	CapStaleRead
+	// CapCommitTS is returning the commit timestamp of a write, like
+	// InsertWithTS.
+	CapCommitTS
+)
+
+var capabilityNames = []string{"scan", "batch", "txn", "ttl", "cas", "replicaRead", "staleRead", "commitTS"}
+
+// Has returns whether c has all the capabilities of f.
+func (c Capability) Has(f Capability) bool {
+	return c&f == f
+}
+
+func (c Capability) String() string {
+	var names []string
+	for i, name := range capabilityNames {
+		if c.Has(1 << uint(i)) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+var (
+	_ ycsb.DB = (*rawDB)(nil)
+	_ ycsb.DB = (*txnDB)(nil)
+	_ ycsb.DB = (*mixedDB)(nil)
+
+	_ ycsb.BatchDB = (*rawDB)(nil)
+	_ ycsb.BatchDB = (*txnDB)(nil)
+	_ ycsb.BatchDB = (*mixedDB)(nil)
+)
+
+// Capabilities returns CapScan.
+func (db *rawDB) Capabilities() Capability {
+	return CapScan
+}
+
+// Capabilities returns CapScan, CapBatch and CapTxn.
+func (db *txnDB) Capabilities() Capability {
+	return CapScan | CapBatch | CapTxn
+}
+
+// Capabilities returns the capabilities shared by the drivers, as any
+// operation may be routed to either of them.
+func (db *mixedDB) Capabilities() Capability {
+	return db.raw.Capabilities() & db.txn.Capabilities()
+}
@@ -0,0 +1,43 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import "testing"
+
+func TestCapabilities(t *testing.T) {
+	raw, _ := newTestRawDB(t)
+	txn, _ := newTestTxnDB(t)
+	tests := []struct {
+		name string
+		db   interface{ Capabilities() Capability }
+		want string
+	}{
+		{"raw", raw, "scan"},
+		{"txn", txn, "scan,batch,txn"},
+		// An operation may be routed to the raw driver.
+		{"mixed", &mixedDB{raw: raw, txn: txn}, "scan"},
+	}
+	for _, tt := range tests {
+		c := tt.db.Capabilities()
+		if s := c.String(); s != tt.want {
+			t.Errorf("%s: Capabilities() = %s, want %s", tt.name, s, tt.want)
+		}
+		if !c.Has(CapScan) || c.Has(CapTTL) || c.Has(CapScan|CapCAS) {
+			t.Errorf("%s: Capabilities() = %s has the wrong flags", tt.name, c)
+		}
+	}
+	if c := CapScan | CapBatch | CapTxn; !c.Has(CapBatch | CapTxn) {
+		t.Errorf("%s does not have batch,txn", c)
+	}
+}
@@ -0,0 +1,1106 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/go-ycsb/pkg/prop"
+	"github.com/pingcap/go-ycsb/pkg/util"
+	"github.com/pingcap/tidb/mysql"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+	tidbcodec "github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tidb/util/kvcache"
+)
+
+// Key layout properties, they are shared by the raw and txn modes so both
+// modes can read the data written by each other.
+const (
+	// tikvRawSaltBuckets spreads the rows of a table over N buckets by putting
+	// hash(key) % N in front of the key, with the hash of tikvRawSaltHash, 0
+	// disables salting.
+	// A logical key range is no longer stored contiguously in salted mode, so
+	// every scan must fan out to all the buckets and merge the results.
+	tikvRawSaltBuckets = "tikv.raw.saltBuckets"
+	// tikvRawReverseKey stores the key bytes in reverse order, so monotonically
+	// increasing keys are spread over the key space instead of always appending
+	// to the last region. Scans then no longer follow the logical key order.
+	tikvRawReverseKey = "tikv.raw.reverseKey"
+	// tikvRawKeyspacePrefix is put in front of every row key, so the data of
+	// this run is isolated from other tenants of a shared cluster.
+	tikvRawKeyspacePrefix = "tikv.raw.keyspacePrefix"
+	// tikvRawRowKeyCacheSize is the number of row keys kept in an LRU cache,
+	// which only pays off for skewed workloads, 0 disables the cache.
+	tikvRawRowKeyCacheSize = "tikv.raw.rowKeyCacheSize"
+	// tikvRawCompositeKeyFields lists the fields, separated by commas, whose
+	// values are joined by compositeKeyDelimiter to build the key in Insert.
+	// Read and Scan take the key in the same joined format.
+	tikvRawCompositeKeyFields = "tikv.raw.compositeKeyFields"
+	// tikvRawMaxKeyBytes limits the length of the whole row key, including the
+	// keyspace and table prefix, 0 means no limit. Set it to the max key size of
+	// the TiKV cluster to fail early with a clear error.
+	tikvRawMaxKeyBytes = "tikv.raw.maxKeyBytes"
+	// tikvRawTruncateLongKeys truncates the row keys longer than maxKeyBytes and
+	// ends them with a hash of the full key instead of returning an error.
+	tikvRawTruncateLongKeys = "tikv.raw.truncateLongKeys"
+	// none, hex or base64, the keys from the workload are decoded to the bytes
+	// stored in the row key.
+	tikvRawKeyDecode = "tikv.raw.keyDecode"
+	// tikvRawMissingFields is what Insert does with a row missing some fields,
+	// "skip" writes the row without them, "fillEmpty" writes them as empty
+	// values and "error" fails the insert.
+	tikvRawMissingFields = "tikv.raw.missingFields"
+	// tikvRawTiDBCompat stores the rows under the record keys of the TiDB table
+	// tikvRawTiDBTableID, so TiDB can read them with SQL. The handle of a row
+	// is the integer at the end of its key, like 12 for "user12".
+	tikvRawTiDBCompat  = "tikv.raw.tidbCompat"
+	tikvRawTiDBTableID = "tikv.raw.tidbTableID"
+)
+
+// tikvRawScanDecodeParallelism is the number of goroutines decoding the rows of
+// a scan, 1 decodes them in the goroutine of the scan.
+const tikvRawScanDecodeParallelism = "tikv.raw.scanDecodeParallelism"
+
+// tikvRawEncodeWorkers is the number of goroutines encoding the rows of a
+// batch insert, 1 encodes them in the goroutine of the insert.
+const tikvRawEncodeWorkers = "tikv.raw.encodeWorkers"
+
+// minRowsPerDecoder keeps the small scans from paying for the goroutines.
+const minRowsPerDecoder = 64
+
+// minRowsPerEncoder keeps the small batches from paying for the goroutines.
+const minRowsPerEncoder = 64
+
+// compositeKeyDelimiter separates the field values of a composite key.
+const compositeKeyDelimiter = "#"
+
+// tidbFirstFieldCol is the column ID of field0 in tikvRawTiDBCompat mode, the
+// columns of a TiDB table are numbered from 1 and the first one is the integer
+// primary key, which is the handle and not stored in the row.
+const tidbFirstFieldCol = 2
+
+// encodedColOverhead is the estimated size of a column in an encoded row
+// besides the value.
+const encodedColOverhead = 8
+
+// maxSaltBuckets keeps the bucket number in a fixed width.
+const maxSaltBuckets = 10000
+
+// codec builds the row keys and encodes the rows like TiDB does.
+type codec struct {
+	fieldIndices   map[string]int64
+	fields         []string
+	bufPool        *util.BufPool
+	saltBuckets    int
+	saltHash       saltHasher
+	reverseKey     bool
+	keyspacePrefix []byte
+	rowKeyCache    *rowKeyCache
+	compositeKey   []string
+	maxKeyBytes    int
+	truncateKeys   bool
+	keyDecode      string
+	missingFields  string
+	// tidbTableID is the TiDB table of the record keys, 0 if tikvRawTiDBCompat
+	// is not set.
+	tidbTableID int64
+	// rowCodec encodes the rows, nil encodes them like TiDB with the columns
+	// below.
+	rowCodec RowCodec
+	// hot is nil if tikvRawHotFraction is 0.
+	hot *hotKeys
+	// tokens is nil if tikvRawIdempotentWrites is not set.
+	tokens *tokenSource
+
+	// fieldCols are the columns of the fields by their position in fields, so
+	// the full rows are decoded without looking up fieldIndices.
+	fieldCols []int64
+	// allCols are the columns of all the fields, it is read only.
+	allCols map[int64]*types.FieldType
+	// singleCol is the column of the only field, -1 if there are more fields.
+	singleCol int64
+	// decodeParallelism is the number of goroutines of decodeRows.
+	decodeParallelism int
+	// encodeWorkers is the number of goroutines of encodeRows.
+	encodeWorkers int
+	// decodePool keeps the *decodeScratch of decodeRow.
+	decodePool sync.Pool
+	// encodePool keeps the *encodeScratch of encodeRow.
+	encodePool sync.Pool
+	// sc is shared by all the encodings and never written, EncodeRow only
+	// reads its TimeZone for the time values, and the rows have none.
+	sc *stmtctx.StatementContext
+	// rowSizeHint is the estimated size of an encoded row, the pooled buffers
+	// are grown to it before encoding. It only grows, it is accessed
+	// atomically.
+	rowSizeHint int64
+}
+
+// encodeScratch holds the slices encodeRow needs only during a call.
+type encodeScratch struct {
+	cols   []types.Datum
+	colIDs []int64
+	// flat holds the column IDs and the values interleaved, like EncodeRow
+	// flattens them.
+	flat []types.Datum
+}
+
+// decodeScratch holds the maps decodeRow needs only during a call.
+type decodeScratch struct {
+	cols      map[int64]*types.FieldType
+	fieldCols []int64
+	datums    map[int64]types.Datum
+}
+
+// LayoutConfig is the key layout and the row encoding, shared by the raw and
+// txn drivers. Every field is the property of the same name, like SaltBuckets
+// for tikv.raw.saltBuckets.
+type LayoutConfig struct {
+	// FieldCount is the number of fields of a row, named field0 and so on.
+	FieldCount int64
+	// FieldLength is the usual length of a field value, for sizing the row
+	// buffers.
+	FieldLength           int64
+	SaltBuckets           int
+	SaltHash              string
+	ReverseKey            bool
+	KeyspacePrefix        string
+	RowKeyCacheSize       int64
+	CompositeKeyFields    []string
+	MaxKeyBytes           int
+	TruncateLongKeys      bool
+	KeyDecode             string
+	ScanDecodeParallelism int
+	EncodeWorkers         int
+	MissingFields         string
+	TiDBCompat            bool
+	TiDBTableID           int64
+	HotFraction           float64
+	HotRange              int
+	IdempotentWrites      bool
+	// Encoding is the RowCodec of tikv.raw.encoding.
+	Encoding string
+}
+
+// DefaultLayoutConfig returns the defaults of the layout properties.
+func DefaultLayoutConfig() LayoutConfig {
+	return LayoutConfig{
+		FieldCount:            prop.FieldCountDefault,
+		FieldLength:           prop.FieldLengthDefault,
+		SaltHash:              "crc32",
+		KeyDecode:             "none",
+		ScanDecodeParallelism: 1,
+		EncodeWorkers:         1,
+		MissingFields:         "skip",
+		HotRange:              100,
+		Encoding:              "tablecodec",
+	}
+}
+
+func layoutConfig(p *properties.Properties) LayoutConfig {
+	cfg := DefaultLayoutConfig()
+	cfg.FieldCount = p.GetInt64(prop.FieldCount, cfg.FieldCount)
+	cfg.FieldLength = p.GetInt64(prop.FieldLength, cfg.FieldLength)
+	cfg.SaltBuckets = p.GetInt(tikvRawSaltBuckets, cfg.SaltBuckets)
+	cfg.SaltHash = p.GetString(tikvRawSaltHash, cfg.SaltHash)
+	cfg.ReverseKey = p.GetBool(tikvRawReverseKey, cfg.ReverseKey)
+	cfg.KeyspacePrefix = p.GetString(tikvRawKeyspacePrefix, cfg.KeyspacePrefix)
+	cfg.RowKeyCacheSize = p.GetInt64(tikvRawRowKeyCacheSize, cfg.RowKeyCacheSize)
+	if s := p.GetString(tikvRawCompositeKeyFields, ""); len(s) > 0 {
+		cfg.CompositeKeyFields = strings.Split(s, ",")
+	}
+	cfg.MaxKeyBytes = p.GetInt(tikvRawMaxKeyBytes, cfg.MaxKeyBytes)
+	cfg.TruncateLongKeys = p.GetBool(tikvRawTruncateLongKeys, cfg.TruncateLongKeys)
+	cfg.KeyDecode = p.GetString(tikvRawKeyDecode, cfg.KeyDecode)
+	cfg.ScanDecodeParallelism = p.GetInt(tikvRawScanDecodeParallelism, cfg.ScanDecodeParallelism)
+	cfg.EncodeWorkers = p.GetInt(tikvRawEncodeWorkers, cfg.EncodeWorkers)
+	cfg.MissingFields = p.GetString(tikvRawMissingFields, cfg.MissingFields)
+	cfg.TiDBCompat = p.GetBool(tikvRawTiDBCompat, cfg.TiDBCompat)
+	cfg.TiDBTableID = p.GetInt64(tikvRawTiDBTableID, cfg.TiDBTableID)
+	cfg.HotFraction = p.GetFloat64(tikvRawHotFraction, cfg.HotFraction)
+	cfg.HotRange = p.GetInt(tikvRawHotRange, cfg.HotRange)
+	cfg.IdempotentWrites = p.GetBool(tikvRawIdempotentWrites, cfg.IdempotentWrites)
+	cfg.Encoding = p.GetString(tikvRawEncoding, cfg.Encoding)
+	return cfg
+}
+
+func newCodec(p *properties.Properties) (*codec, error) {
+	return newLayoutCodec(layoutConfig(p))
+}
+
+// newLayoutCodec validates the layout and creates its codec.
+func newLayoutCodec(cfg LayoutConfig) (*codec, error) {
+	var errs configError
+	if cfg.validate(&errs); len(errs) > 0 {
+		return nil, errs
+	}
+
+	rowCodec, err := newRowCodec(cfg.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldIndices := createFieldIndices(cfg.FieldCount)
+	fields := allFields(cfg.FieldCount)
+	bufPool := util.NewBufPool()
+
+	var tidbTableID int64
+	if cfg.TiDBCompat {
+		tidbTableID = cfg.TiDBTableID
+		for field := range fieldIndices {
+			fieldIndices[field] += tidbFirstFieldCol
+		}
+	}
+
+	var cache *rowKeyCache
+	if cfg.RowKeyCacheSize > 0 {
+		cache = newRowKeyCache(cfg.RowKeyCacheSize)
+	}
+
+	var tokens *tokenSource
+	if cfg.IdempotentWrites {
+		tokens = newTokenSource()
+	}
+
+	fieldType := types.NewFieldType(mysql.TypeVarchar)
+	allCols := make(map[int64]*types.FieldType, len(fields))
+	fieldCols := make([]int64, len(fields))
+	for i, field := range fields {
+		fieldCols[i] = fieldIndices[field]
+		allCols[fieldCols[i]] = fieldType
+	}
+
+	// A column costs its ID, the flag and the length of the value besides the
+	// value itself.
+	rowSizeHint := int64(len(fields)) * (cfg.FieldLength + encodedColOverhead)
+
+	singleCol := int64(-1)
+	if len(fields) == 1 {
+		singleCol = fieldIndices[fields[0]]
+	}
+
+	return &codec{
+		fieldIndices:      fieldIndices,
+		fields:            fields,
+		bufPool:           bufPool,
+		saltBuckets:       cfg.SaltBuckets,
+		saltHash:          saltHashers[cfg.SaltHash],
+		reverseKey:        cfg.ReverseKey,
+		keyspacePrefix:    []byte(cfg.KeyspacePrefix),
+		rowKeyCache:       cache,
+		compositeKey:      cfg.CompositeKeyFields,
+		maxKeyBytes:       cfg.MaxKeyBytes,
+		truncateKeys:      cfg.TruncateLongKeys,
+		keyDecode:         cfg.KeyDecode,
+		missingFields:     cfg.MissingFields,
+		tidbTableID:       tidbTableID,
+		rowCodec:          rowCodec,
+		hot:               newHotKeys(cfg.HotFraction, cfg.HotRange),
+		tokens:            tokens,
+		rowSizeHint:       rowSizeHint,
+		sc:                &stmtctx.StatementContext{},
+		fieldCols:         fieldCols,
+		allCols:           allCols,
+		singleCol:         singleCol,
+		decodeParallelism: cfg.ScanDecodeParallelism,
+		encodeWorkers:     cfg.EncodeWorkers}, nil
+}
+
+// rowKeyCache is a bounded LRU cache of the row keys, safe for concurrent use.
+// The cached keys are shared, callers must not modify them.
+type rowKeyCache struct {
+	mu    sync.Mutex
+	cache *kvcache.SimpleLRUCache
+	// lookup is the key of the lookups, reused under mu so a hit does not
+	// allocate.
+	lookup rowKeyLookup
+}
+
+type rowKeyCacheKey string
+
+func (k rowKeyCacheKey) Hash() []byte {
+	return util.Slice(string(k))
+}
+
+// rowKeyLookup is a reusable key for Get only, Put keeps its key.
+type rowKeyLookup struct {
+	b []byte
+}
+
+func (k *rowKeyLookup) Hash() []byte {
+	return k.b
+}
+
+func newRowKeyCache(size int64) *rowKeyCache {
+	return &rowKeyCache{cache: kvcache.NewSimpleLRUCache(size)}
+}
+
+func (c *rowKeyCache) get(table string, key string, build func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	c.lookup.b = append(append(append(c.lookup.b[:0], table...), 0), key...)
+	v, ok := c.cache.Get(&c.lookup)
+	c.mu.Unlock()
+	if ok {
+		return v.([]byte), nil
+	}
+
+	rowKey, err := build()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.cache.Put(rowKeyCacheKey(table+"\x00"+key), rowKey)
+	c.mu.Unlock()
+	return rowKey, nil
+}
+
+// RowKey returns the exact key the row is stored under, so it can be inspected
+// with tools like tikv-ctl. The layout is described in the README.
+func (c *codec) RowKey(table string, key string) ([]byte, error) {
+	rowKey, err := c.getRowKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+	// The key may be shared by the row key cache.
+	return append([]byte(nil), rowKey...), nil
+}
+
+// getRowKey builds the row key byte by byte, so binary keys are stored as is.
+func (c *codec) getRowKey(table string, key string) ([]byte, error) {
+	if c.hot != nil {
+		key = c.hot.route(key)
+	}
+	if c.rowKeyCache != nil {
+		return c.rowKeyCache.get(table, key, func() ([]byte, error) {
+			return c.buildCheckedRowKey(table, key)
+		})
+	}
+	return c.buildCheckedRowKey(table, key)
+}
+
+func (c *codec) buildCheckedRowKey(table string, key string) ([]byte, error) {
+	rowKey, err := c.buildRowKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.checkRowKey(table, key, rowKey)
+}
+
+// checkRowKey enforces the maxKeyBytes limit on the row key.
+func (c *codec) checkRowKey(table string, key string, rowKey []byte) ([]byte, error) {
+	if c.maxKeyBytes == 0 || len(rowKey) <= c.maxKeyBytes {
+		return rowKey, nil
+	}
+
+	if !c.truncateKeys {
+		return nil, fmt.Errorf("row key of table %s key %q is %d bytes, exceeds %s %d",
+			table, key, len(rowKey), tikvRawMaxKeyBytes, c.maxKeyBytes)
+	}
+
+	hash := util.BytesHash64(rowKey)
+	rowKey = rowKey[:c.maxKeyBytes-8]
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(hash))
+	return append(rowKey, b[:]...), nil
+}
+
+// buildRowKey builds the row key with one allocation of the exact size. The key
+// is kept by the callers, like the row key cache and the transactions, so it
+// is not taken from a pool.
+func (c *codec) buildRowKey(table string, key string) ([]byte, error) {
+	if c.tidbTableID > 0 {
+		handle, err := tidbHandle(key)
+		if err != nil {
+			return nil, err
+		}
+		return tablecodec.EncodeRowKeyWithHandle(c.tidbTableID, handle), nil
+	}
+
+	b := make([]byte, 0, len(c.keyspacePrefix)+len(table)+len(key)+6)
+	if c.saltBuckets == 0 {
+		return c.appendKey(c.appendTablePrefix(b, table), key)
+	}
+
+	// The bucket depends on the encoded key, so write the encoded key after a
+	// placeholder bucket and fill the bucket in place.
+	b = c.appendBucketPrefix(b, table, 0)
+	start := len(b)
+	b, err := c.appendKey(b, key)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := c.saltBucket(util.String(b[start:]))
+	// The capacity is enough, so this overwrites the prefix of b.
+	c.appendBucketPrefix(b[:0], table, bucket)
+	return b, nil
+}
+
+// appendTablePrefix appends the common prefix of all the rows in the table, in
+// tikvRawTiDBCompat mode it is the record prefix of the TiDB table.
+func (c *codec) appendTablePrefix(b []byte, table string) []byte {
+	if c.tidbTableID > 0 {
+		return append(b, tablecodec.GenTableRecordPrefix(c.tidbTableID)...)
+	}
+	b = append(b, c.keyspacePrefix...)
+	b = append(b, table...)
+	return append(b, ':')
+}
+
+// encodeKey converts the logical key to the key stored after the table prefix.
+func (c *codec) encodeKey(key string) (string, error) {
+	if c.keyDecode == "none" && !c.reverseKey {
+		return key, nil
+	}
+
+	b, err := c.appendKey(nil, key)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// appendKey appends the key stored after the table prefix to b.
+func (c *codec) appendKey(b []byte, key string) ([]byte, error) {
+	start := len(b)
+	switch c.keyDecode {
+	case "hex":
+		b = append(b, make([]byte, hex.DecodedLen(len(key)))...)
+		if _, err := hex.Decode(b[start:], util.Slice(key)); err != nil {
+			return nil, fmt.Errorf("decode key %q as %s failed: %v", key, c.keyDecode, err)
+		}
+	case "base64":
+		b = append(b, make([]byte, base64.StdEncoding.DecodedLen(len(key)))...)
+		n, err := base64.StdEncoding.Decode(b[start:], util.Slice(key))
+		if err != nil {
+			return nil, fmt.Errorf("decode key %q as %s failed: %v", key, c.keyDecode, err)
+		}
+		b = b[:start+n]
+	default:
+		b = append(b, key...)
+	}
+
+	if c.reverseKey {
+		k := b[start:]
+		for i, j := 0, len(k)-1; i < j; i, j = i+1, j-1 {
+			k[i], k[j] = k[j], k[i]
+		}
+	}
+	return b, nil
+}
+
+// logicalKey returns the logical key of a row key of the table, reversing what
+// buildRowKey does. A truncated row key keeps only a hash of the end of the
+// key, so its logical key can not be recovered and is wrong.
+func (c *codec) logicalKey(table string, rowKey []byte) (string, error) {
+	if c.tidbTableID > 0 {
+		// The key only keeps the handle, so it is the logical key.
+		tableID, handle, err := tablecodec.DecodeRecordKey(rowKey)
+		if err != nil || tableID != c.tidbTableID {
+			return "", fmt.Errorf("key %q is not a record of TiDB table %d", rowKey, c.tidbTableID)
+		}
+		return strconv.FormatInt(handle, 10), nil
+	}
+
+	prefix := c.appendTablePrefix(nil, table)
+	if !bytes.HasPrefix(rowKey, prefix) {
+		return "", fmt.Errorf("key %q is not in table %s", rowKey, table)
+	}
+
+	k := rowKey[len(prefix):]
+	if c.saltBuckets > 0 {
+		if len(k) < 5 || k[4] != ':' {
+			return "", fmt.Errorf("key %q has no salt bucket", rowKey)
+		}
+		k = k[5:]
+	}
+
+	b := append([]byte(nil), k...)
+	if c.reverseKey {
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+	}
+
+	switch c.keyDecode {
+	case "hex":
+		return hex.EncodeToString(b), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b), nil
+	default:
+		return string(b), nil
+	}
+}
+
+// tidbHandle returns the integer at the end of the key, like 12 for "user12"
+// or -3 for "user-3", the hashed keys of the workload may be negative.
+func tidbHandle(key string) (int64, error) {
+	i := len(key)
+	for i > 0 && key[i-1] >= '0' && key[i-1] <= '9' {
+		i--
+	}
+	if i > 0 && i < len(key) && key[i-1] == '-' {
+		i--
+	}
+
+	handle, err := strconv.ParseInt(key[i:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("key %q does not end with an integer handle for %s", key, tikvRawTiDBCompat)
+	}
+	return handle, nil
+}
+
+func (c *codec) saltBucket(key string) int {
+	return int(c.saltHash.hash(util.Slice(key)) % uint64(c.saltBuckets))
+}
+
+// appendBucketPrefix appends the common prefix of all the salted rows in the
+// bucket, the bucket is written as 4 decimal digits.
+func (c *codec) appendBucketPrefix(b []byte, table string, bucket int) []byte {
+	b = c.appendTablePrefix(b, table)
+	b = append(b, byte('0'+bucket/1000), byte('0'+bucket/100%10), byte('0'+bucket/10%10), byte('0'+bucket%10))
+	return append(b, ':')
+}
+
+// getCompositeKey joins the values of the composite key fields, it returns
+// false if any of the fields is missing.
+func (c *codec) getCompositeKey(values map[string][]byte) (string, bool) {
+	parts := make([]string, 0, len(c.compositeKey))
+	for _, field := range c.compositeKey {
+		v, ok := values[field]
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, string(v))
+	}
+	return strings.Join(parts, compositeKeyDelimiter), true
+}
+
+// insertKey returns the key the values are inserted under.
+func (c *codec) insertKey(key string, values map[string][]byte) string {
+	if len(c.compositeKey) > 0 {
+		if k, ok := c.getCompositeKey(values); ok {
+			return k
+		}
+	}
+	return key
+}
+
+// insertValues applies tikvRawMissingFields to the values of an inserted row.
+// The values are never modified, the filled fields are added to a copy.
+func (c *codec) insertValues(values map[string][]byte) (map[string][]byte, error) {
+	if c.missingFields == "skip" {
+		return values, nil
+	}
+
+	var missing []string
+	for _, field := range c.fields {
+		if _, ok := values[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	} else if c.missingFields == "error" {
+		return nil, fmt.Errorf("the row misses the fields %s", strings.Join(missing, ","))
+	}
+
+	filled := make(map[string][]byte, len(values)+len(missing))
+	for field, v := range values {
+		filled[field] = v
+	}
+	for _, field := range missing {
+		filled[field] = []byte{}
+	}
+	return filled, nil
+}
+
+// encodeRowBuf encodes the values into buf, which is grown to rowSizeHint
+// first so the encoding rarely reallocates. The rows larger than the hint
+// raise it with a quarter of headroom. The row is only valid until buf is
+// reused.
+func (c *codec) encodeRowBuf(buf *bytes.Buffer, values map[string][]byte) ([]byte, error) {
+	hint := atomic.LoadInt64(&c.rowSizeHint)
+	buf.Grow(int(hint))
+
+	row, err := c.encodeRow(buf.Bytes(), values)
+	if err != nil {
+		return nil, err
+	}
+	c.raiseRowSizeHint(hint, len(row))
+	return row, nil
+}
+
+// raiseRowSizeHint raises the rowSizeHint read as hint with a quarter of
+// headroom if a row of size bytes is larger.
+func (c *codec) raiseRowSizeHint(hint int64, size int) {
+	for n := int64(size); n > hint; hint = atomic.LoadInt64(&c.rowSizeHint) {
+		if atomic.CompareAndSwapInt64(&c.rowSizeHint, hint, n+n/4) {
+			break
+		}
+	}
+}
+
+// encodeRow encodes the values like a TiDB row into b, or with the RowCodec of
+// tikvRawEncoding, followed by the token of the write with
+// tikvRawIdempotentWrites.
+func (c *codec) encodeRow(b []byte, values map[string][]byte) ([]byte, error) {
+	row, err := c.encodeValues(b, values)
+	if err != nil || c.tokens == nil {
+		return row, err
+	}
+	return c.tokens.appendToken(row), nil
+}
+
+func (c *codec) encodeValues(b []byte, values map[string][]byte) ([]byte, error) {
+	if c.rowCodec != nil {
+		return c.rowCodec.Encode(b, values)
+	}
+	if c.singleCol >= 0 && len(values) == 1 {
+		return c.encodeSingleField(b, values)
+	}
+
+	// The slices are pooled, they are only used until the row is encoded.
+	scratch, _ := c.encodePool.Get().(*encodeScratch)
+	if scratch == nil {
+		scratch = &encodeScratch{
+			cols:   make([]types.Datum, 0, len(c.fields)),
+			colIDs: make([]int64, 0, len(c.fields)),
+		}
+	}
+
+	cols, colIDs, flat := scratch.cols[:0], scratch.colIDs[:0], scratch.flat
+	if cap(flat) < 2*len(values) {
+		flat = make([]types.Datum, 2*len(values))
+	}
+	for k, v := range values {
+		i := c.fieldIndices[k]
+		var d types.Datum
+		d.SetBytes(v)
+
+		cols = append(cols, d)
+		colIDs = append(colIDs, i)
+	}
+
+	flat = flat[:2*len(cols)]
+	row, err := tablecodec.EncodeRow(c.sc, cols, colIDs, b, flat)
+
+	// Keep the grown slices, and drop the references to the values.
+	for i := range cols {
+		cols[i] = types.Datum{}
+	}
+	for i := range flat {
+		flat[i] = types.Datum{}
+	}
+	scratch.cols, scratch.colIDs, scratch.flat = cols[:0], colIDs[:0], flat
+	c.encodePool.Put(scratch)
+
+	return row, err
+}
+
+func (c *codec) decodeRow(ctx context.Context, row []byte, fields []string) (map[string][]byte, error) {
+	row, err := c.stripToken(row)
+	if err != nil {
+		return nil, err
+	}
+	if c.rowCodec != nil {
+		if len(row) == 0 {
+			// A registered codec may not accept the row of a missing key.
+			return make(map[string][]byte), nil
+		}
+		return c.rowCodec.Decode(row, fields)
+	}
+	if c.singleCol >= 0 && (len(fields) == 0 || c.isAllFields(fields)) {
+		return c.decodeSingleField(row)
+	}
+
+	// The returned map is kept by the caller, but the maps used to decode are
+	// pooled, so a read only allocates the result.
+	scratch, _ := c.decodePool.Get().(*decodeScratch)
+	if scratch == nil {
+		scratch = &decodeScratch{
+			cols:   make(map[int64]*types.FieldType, len(c.fields)),
+			datums: make(map[int64]types.Datum, len(c.fields)),
+		}
+	}
+	defer c.decodePool.Put(scratch)
+
+	cols, fieldCols := c.allCols, c.fieldCols
+	if len(fields) == 0 {
+		fields = c.fields
+	} else if !c.isAllFields(fields) {
+		// The fields vary between calls, so the columns are rebuilt each time.
+		for i := range scratch.cols {
+			delete(scratch.cols, i)
+		}
+		scratch.fieldCols = scratch.fieldCols[:0]
+		for _, field := range fields {
+			i := c.fieldIndices[field]
+			scratch.cols[i] = c.allCols[i]
+			scratch.fieldCols = append(scratch.fieldCols, i)
+		}
+		cols, fieldCols = scratch.cols, scratch.fieldCols
+	}
+
+	for i := range scratch.datums {
+		delete(scratch.datums, i)
+	}
+	data, err := tablecodec.DecodeRowWithMap(row, cols, nil, scratch.datums)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string][]byte, len(fields))
+	for n, field := range fields {
+		if v, ok := data[fieldCols[n]]; ok {
+			res[field] = v.GetBytes()
+		}
+	}
+
+	return res, nil
+}
+
+// encodeSingleField encodes the row of a single field table without the
+// general slices.
+func (c *codec) encodeSingleField(b []byte, values map[string][]byte) ([]byte, error) {
+	var (
+		cols   [1]types.Datum
+		colIDs [1]int64
+		flat   [2]types.Datum
+	)
+	for k, v := range values {
+		cols[0].SetBytes(v)
+		colIDs[0] = c.fieldIndices[k]
+	}
+	return tablecodec.EncodeRow(c.sc, cols[:], colIDs[:], b, flat[:])
+}
+
+// decodeSingleField decodes the row of a single field table, it walks the
+// columns of the row in place, so it needs no map but the result.
+func (c *codec) decodeSingleField(row []byte) (map[string][]byte, error) {
+	res := make(map[string][]byte, 1)
+	if len(row) == 0 || (len(row) == 1 && row[0] == tidbcodec.NilFlag) {
+		return res, nil
+	}
+
+	for b := row; len(b) > 0; {
+		data, remain, err := tidbcodec.CutOne(b)
+		if err != nil {
+			return nil, err
+		}
+		_, id, err := tidbcodec.DecodeOne(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if data, b, err = tidbcodec.CutOne(remain); err != nil {
+			return nil, err
+		}
+		if id.GetInt64() != c.singleCol {
+			continue
+		}
+
+		_, v, err := tidbcodec.DecodeOne(data)
+		if err != nil {
+			return nil, err
+		}
+		res[c.fields[0]] = v.GetBytes()
+		break
+	}
+	return res, nil
+}
+
+// isAllFields returns whether the fields are all the fields in the configured
+// order, which is how the workloads ask for a full row.
+func (c *codec) isAllFields(fields []string) bool {
+	if len(fields) != len(c.fields) {
+		return false
+	}
+
+	for i, field := range fields {
+		if field != c.fields[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeRows decodes the rows in order, a nil row is decoded to nil. Large
+// scans are split in contiguous parts decoded by decodeParallelism goroutines,
+// the first error stops all of them.
+func (c *codec) decodeRows(ctx context.Context, rows [][]byte, fields []string) ([]map[string][]byte, error) {
+	res := scanResult(ctx, len(rows))
+
+	workers := c.decodeParallelism
+	if n := len(rows) / minRowsPerDecoder; n < workers {
+		workers = n
+	}
+	if workers <= 1 {
+		if err := c.decodeRowsTo(ctx, res, rows, fields, nil); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		once   sync.Once
+		failed int32
+		first  error
+	)
+	part := (len(rows) + workers - 1) / workers
+	for start := 0; start < len(rows); start += part {
+		end := start + part
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			if err := c.decodeRowsTo(ctx, res[start:end], rows[start:end], fields, &failed); err != nil {
+				once.Do(func() { first = err })
+				atomic.StoreInt32(&failed, 1)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	if first != nil {
+		return nil, first
+	}
+	return res, nil
+}
+
+// encodeRows encodes the rows of a batch with up to encodeWorkers goroutines,
+// the encoded row i is the one of rows[i]. The encoded rows are kept by the
+// caller, so each is encoded into a pooled buffer and copied out at its exact
+// size.
+func (c *codec) encodeRows(rows []map[string][]byte) ([][]byte, error) {
+	res := make([][]byte, len(rows))
+
+	workers := c.encodeWorkers
+	if n := len(rows) / minRowsPerEncoder; n < workers {
+		workers = n
+	}
+	if workers <= 1 {
+		if err := c.encodeRowsTo(res, rows, nil); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		once   sync.Once
+		failed int32
+		first  error
+	)
+	part := (len(rows) + workers - 1) / workers
+	for start := 0; start < len(rows); start += part {
+		end := start + part
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			if err := c.encodeRowsTo(res[start:end], rows[start:end], &failed); err != nil {
+				once.Do(func() { first = err })
+				atomic.StoreInt32(&failed, 1)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	if first != nil {
+		return nil, first
+	}
+	return res, nil
+}
+
+// encodeRowsTo encodes the rows into res, it stops early once failed is set by
+// another goroutine, failed may be nil.
+func (c *codec) encodeRowsTo(res [][]byte, rows []map[string][]byte, failed *int32) error {
+	buf := c.bufPool.Get()
+	defer c.bufPool.Put(buf)
+
+	for i, values := range rows {
+		if failed != nil && atomic.LoadInt32(failed) != 0 {
+			return nil
+		}
+
+		buf.Reset()
+		row, err := c.encodeRowBuf(buf, values)
+		if err != nil {
+			return err
+		}
+		res[i] = append([]byte(nil), row...)
+	}
+	return nil
+}
+
+// decodeRowsTo decodes the rows into res, it stops early once failed is set by
+// another goroutine, failed may be nil.
+func (c *codec) decodeRowsTo(ctx context.Context, res []map[string][]byte, rows [][]byte, fields []string, failed *int32) error {
+	for i, row := range rows {
+		if failed != nil && atomic.LoadInt32(failed) != 0 {
+			return nil
+		}
+		if row == nil {
+			continue
+		}
+
+		v, err := c.decodeRow(ctx, row, fields)
+		if err != nil {
+			return err
+		}
+		res[i] = v
+	}
+	return nil
+}
+
+// scanResult returns a result of n nil rows, which reuses the result released
+// by the thread if it is large enough.
+func scanResult(ctx context.Context, n int) []map[string][]byte {
+	state := threadStateOf(ctx)
+	if state == nil || n == 0 || cap(state.scanFree) < n {
+		return make([]map[string][]byte, n)
+	}
+
+	res := state.scanFree[:n]
+	state.scanFree = nil
+	return res
+}
+
+// ReleaseScan gives the result of a scan back to the thread of ctx, so its
+// next scans reuse the slice instead of allocating one. The row maps are not
+// reused and stay valid, but the slice itself must not be used after it is
+// released, nor released twice.
+func (c *codec) ReleaseScan(ctx context.Context, rows []map[string][]byte) {
+	state := threadStateOf(ctx)
+	if state == nil || cap(rows) <= cap(state.scanFree) {
+		return
+	}
+
+	// Drop the references to the rows, the next scan expects nil rows.
+	rows = rows[:cap(rows)]
+	for i := range rows {
+		rows[i] = nil
+	}
+	state.scanFree = rows
+}
+
+// scanFunc returns at most limit pairs starting from the start key.
+type scanFunc func(start []byte, limit int) (keys [][]byte, values [][]byte, err error)
+
+// scanRows scans count rows of the table from the startKey with scan.
+func (c *codec) scanRows(ctx context.Context, table string, startKey string, count int, fields []string, scan scanFunc) ([]map[string][]byte, error) {
+	_, rows, err := c.scanRowPairs(table, startKey, count, scan)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.decodeRows(ctx, rows, fields)
+}
+
+// scanRowPairs is like scanRows but returns the row keys and the encoded rows.
+func (c *codec) scanRowPairs(table string, startKey string, count int, scan scanFunc) ([][]byte, [][]byte, error) {
+	if c.saltBuckets > 0 {
+		return c.saltedScan(table, startKey, count, scan)
+	}
+
+	// The start key is never stored, so it is not limited by maxKeyBytes.
+	startRowKey, err := c.buildRowKey(table, startKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys, rows, err := scan(startRowKey, count)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The scan has no end key, drop the rows beyond the table.
+	prefix := c.appendTablePrefix(nil, table)
+	for i, key := range keys {
+		if !bytes.HasPrefix(key, prefix) {
+			keys, rows = keys[:i], rows[:i]
+			break
+		}
+	}
+
+	return keys, rows, nil
+}
+
+type saltedRow struct {
+	rowKey []byte
+	// key is the row key without the bucket prefix.
+	key []byte
+	row []byte
+}
+
+// saltedScan scans every bucket from the startKey and merges the rows by the
+// logical key, so it costs one scan per bucket.
+func (c *codec) saltedScan(table string, startKey string, count int, scan scanFunc) ([][]byte, [][]byte, error) {
+	startKey, err := c.encodeKey(startKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var merged []saltedRow
+	for bucket := 0; bucket < c.saltBuckets; bucket++ {
+		prefix := c.appendBucketPrefix(nil, table, bucket)
+		keys, rows, err := scan(append(prefix[:len(prefix):len(prefix)], startKey...), count)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i, key := range keys {
+			if !bytes.HasPrefix(key, prefix) {
+				break
+			}
+			merged = append(merged, saltedRow{rowKey: key, key: key[len(prefix):], row: rows[i]})
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return bytes.Compare(merged[i].key, merged[j].key) < 0
+	})
+	if len(merged) > count {
+		merged = merged[:count]
+	}
+
+	keys := make([][]byte, len(merged))
+	rows := make([][]byte, len(merged))
+	for i, r := range merged {
+		keys[i], rows[i] = r.rowKey, r.row
+	}
+
+	return keys, rows, nil
+}
@@ -0,0 +1,440 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestReverseKey(t *testing.T) {
+	tests := []struct {
+		kvs  []string
+		key  string
+		want string
+	}{
+		{nil, "user123", "usertable:user123"},
+		{[]string{tikvRawReverseKey, "true"}, "user123", "usertable:321resu"},
+		{[]string{tikvRawReverseKey, "true", tikvRawKeyspacePrefix, "run1/"}, "ab", "run1/usertable:ba"},
+		{[]string{tikvRawReverseKey, "true", tikvRawKeyDecode, "hex"}, "0102ff", "usertable:\xff\x02\x01"},
+		{[]string{tikvRawReverseKey, "true"}, "", "usertable:"},
+	}
+	for _, tt := range tests {
+		c := newTestCodec(t, tt.kvs...)
+		rowKey, err := c.getRowKey("usertable", tt.key)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.kvs, err)
+		}
+		if string(rowKey) != tt.want {
+			t.Errorf("%v: row key of %q is %q, want %q", tt.kvs, tt.key, rowKey, tt.want)
+		}
+		if key, err := c.logicalKey("usertable", rowKey); err != nil || key != tt.key {
+			t.Errorf("%v: logical key of %q is %q, %v, want %q", tt.kvs, rowKey, key, err, tt.key)
+		}
+	}
+}
+
+// The monotonic keys of an ordered load end in their fast changing digits, so
+// reversed they spread over the key space instead of appending to one region.
+func TestReverseKeySpreadsMonotonicKeys(t *testing.T) {
+	c := newTestCodec(t, tikvRawReverseKey, "true")
+	first := make(map[byte]bool)
+	for i := 1000; i < 1010; i++ {
+		rowKey, err := c.getRowKey("usertable", fmt.Sprintf("user%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		first[rowKey[len("usertable:")]] = true
+	}
+	if len(first) != 10 {
+		t.Errorf("10 consecutive keys start with %d distinct bytes once reversed, want 10", len(first))
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	tests := []struct {
+		kvs []string
+		// want is the row key of "user1", "" if RowKey fails.
+		want string
+	}{
+		{nil, "usertable:user1"},
+		{[]string{tikvRawKeyspacePrefix, "run1/"}, "run1/usertable:user1"},
+		{[]string{tikvRawRowKeyCacheSize, "10"}, "usertable:user1"},
+		{[]string{tikvRawSaltBuckets, "1"}, "usertable:0000:user1"},
+		{[]string{tikvRawMaxKeyBytes, "10"}, ""},
+	}
+	for _, tt := range tests {
+		c := newTestCodec(t, tt.kvs...)
+		rowKey, err := c.RowKey("usertable", "user1")
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%v: RowKey = %q, want an error", tt.kvs, rowKey)
+			}
+			continue
+		}
+		if err != nil || string(rowKey) != tt.want {
+			t.Errorf("%v: RowKey = %q, %v, want %q", tt.kvs, rowKey, err, tt.want)
+			continue
+		}
+
+		// The returned key is the caller's, even with the row key cache.
+		rowKey[0] = 'X'
+		if stored, _ := c.getRowKey("usertable", "user1"); string(stored) != tt.want {
+			t.Errorf("%v: changing the result of RowKey changed the row key to %q", tt.kvs, stored)
+		}
+	}
+}
+
+// TestEncodeRows checks the rows of a batch are encoded in order at their own
+// size, so the small rows after a large one do not take its size.
+func TestEncodeRows(t *testing.T) {
+	rows := []map[string][]byte{benchValues(10, 10000)}
+	for i := 0; i < 4*minRowsPerEncoder; i++ {
+		rows = append(rows, map[string][]byte{"field0": []byte(fmt.Sprintf("v%d", i))})
+	}
+	ctx := context.Background()
+	for _, workers := range []string{"1", "4"} {
+		c := newTestCodec(t, tikvRawEncodeWorkers, workers)
+		res, err := c.encodeRows(rows)
+		if err != nil || len(res) != len(rows) {
+			t.Fatalf("workers=%s: encodeRows = %d rows, %v, want %d", workers, len(res), err, len(rows))
+		}
+		for i, row := range res {
+			if cap(row) >= 2*len(row) {
+				t.Errorf("workers=%s: row %d of %d bytes has a capacity of %d", workers, i, len(row), cap(row))
+			}
+			got, err := c.decodeRow(ctx, row, nil)
+			if err != nil || !sameRow(got, rows[i]) {
+				t.Errorf("workers=%s: row %d decoded to %q, %v, want %q", workers, i, got, err, rows[i])
+			}
+		}
+	}
+}
+
+// benchRowKey keeps the row keys of the benchmarks alive.
+var benchRowKey []byte
+
+// BenchmarkRowKey compares building the row key byte by byte with the
+// fmt.Sprintf it replaced, which allocated the string and its copy.
+func BenchmarkRowKey(b *testing.B) {
+	keys := []struct {
+		name string
+		key  string
+	}{
+		{"plain", "user6284781860667377211"},
+		{"binary", "user\x00\xfe\xff6284781860667377211"},
+	}
+	for _, k := range keys {
+		key := k.key
+		b.Run(k.name+"/sprintf", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchRowKey = []byte(fmt.Sprintf("%s:%s", "usertable", key))
+			}
+		})
+		b.Run(k.name+"/builder", func(b *testing.B) {
+			c := newTestCodec(b)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchRowKey, _ = c.buildCheckedRowKey("usertable", key)
+			}
+		})
+	}
+}
+
+// BenchmarkRowKeyCache runs getRowKey on a skewed workload of 16 hot keys,
+// which the row key cache serves without building the keys again.
+func BenchmarkRowKeyCache(b *testing.B) {
+	keys := make([]string, 16)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user%d", 6284781860667377211+i)
+	}
+	for _, size := range []string{"0", "1024"} {
+		b.Run("size="+size, func(b *testing.B) {
+			c := newTestCodec(b, tikvRawRowKeyCacheSize, size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchRowKey, _ = c.getRowKey("usertable", keys[i%len(keys)])
+			}
+		})
+	}
+}
+
+// benchValues returns the values of a row of n fields of size bytes, the
+// YCSB default is 10 fields of 100 bytes.
+func benchValues(n int, size int) map[string][]byte {
+	values := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		values[fmt.Sprintf("field%d", i)] = bytes.Repeat([]byte{byte('a' + i)}, size)
+	}
+	return values
+}
+
+// benchRow keeps the decoded rows of the benchmarks alive.
+var benchRow map[string][]byte
+
+// BenchmarkDecodeRow decodes a full row and projections of it, the maps used
+// to decode are pooled, so only the result is allocated.
+func BenchmarkDecodeRow(b *testing.B) {
+	c := newTestCodec(b)
+	row, err := c.encodeRow(nil, benchValues(10, 100))
+	if err != nil {
+		b.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		fields [][]string
+	}{
+		{"all", [][]string{nil}},
+		{"subset", [][]string{{"field1", "field3"}}},
+		{"varying", [][]string{{"field1"}, {"field2", "field9"}, {"field0", "field4", "field5"}}},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		fields := tt.fields
+		b.Run(tt.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if benchRow, err = c.decodeRow(ctx, row, fields[i%len(fields)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDecodeAllFields decodes all the fields by name, in the configured
+// order the precomputed columns are used, in another order the columns are
+// rebuilt like those of a projection.
+func BenchmarkDecodeAllFields(b *testing.B) {
+	c := newTestCodec(b)
+	row, err := c.encodeRow(nil, benchValues(10, 100))
+	if err != nil {
+		b.Fatal(err)
+	}
+	configured := append([]string(nil), c.fields...)
+	reordered := append(configured[1:len(configured):len(configured)], configured[0])
+
+	tests := []struct {
+		name   string
+		fields []string
+	}{{"configured", configured}, {"reordered", reordered}}
+	ctx := context.Background()
+	for _, tt := range tests {
+		fields := tt.fields
+		b.Run(tt.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if benchRow, err = c.decodeRow(ctx, row, fields); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetRowKey builds the row keys of every layout, each with a
+// single allocation of the key.
+func BenchmarkGetRowKey(b *testing.B) {
+	tests := []struct {
+		name string
+		kvs  []string
+	}{
+		{"plain", nil},
+		{"keyspace", []string{tikvRawKeyspacePrefix, "run1/"}},
+		{"salted", []string{tikvRawSaltBuckets, "16"}},
+		{"reversed", []string{tikvRawReverseKey, "true"}},
+		{"salted+reversed", []string{tikvRawSaltBuckets, "16", tikvRawReverseKey, "true"}},
+	}
+	for _, tt := range tests {
+		c := newTestCodec(b, tt.kvs...)
+		b.Run(tt.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var err error
+				if benchRowKey, err = c.getRowKey("usertable", "user6284781860667377211"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEncodeRow encodes a 10 field row into a reused buffer, like the
+// load phase. The datum slices are pooled, so encoding allocates nothing,
+// also from concurrent goroutines.
+func BenchmarkEncodeRow(b *testing.B) {
+	c := newTestCodec(b)
+	values := benchValues(10, 100)
+
+	b.Run("serial", func(b *testing.B) {
+		b.ReportAllocs()
+		var buf []byte
+		for i := 0; i < b.N; i++ {
+			var err error
+			if buf, err = c.encodeRow(buf[:0], values); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			var buf []byte
+			for pb.Next() {
+				var err error
+				if buf, err = c.encodeRow(buf[:0], values); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkSingleField encodes and decodes the row of a single field table
+// with the fast path and with the general one.
+func BenchmarkSingleField(b *testing.B) {
+	values := benchValues(1, 100)
+	ctx := context.Background()
+	for _, fast := range []bool{true, false} {
+		c := newTestCodec(b, "fieldcount", "1")
+		name := "fast"
+		if !fast {
+			c.singleCol = -1
+			name = "general"
+		}
+		row, err := c.encodeRow(nil, values)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name+"/encode", func(b *testing.B) {
+			b.ReportAllocs()
+			var buf []byte
+			for i := 0; i < b.N; i++ {
+				if buf, err = c.encodeRow(buf[:0], values); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(name+"/decode", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if benchRow, err = c.decodeRow(ctx, row, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDecodeRows decodes a scan of 10k rows with 1 and 4 decoders.
+func BenchmarkDecodeRows(b *testing.B) {
+	ctx := context.Background()
+	for _, parallelism := range []string{"1", "4"} {
+		c := newTestCodec(b, tikvRawScanDecodeParallelism, parallelism)
+		rows := make([][]byte, 10000)
+		for i := range rows {
+			var err error
+			if rows[i], err = c.encodeRow(nil, benchValues(10, 100)); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.Run("parallelism="+parallelism, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.decodeRows(ctx, rows, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchCol keeps the columns of the benchmarks alive.
+var benchCol int64
+
+// BenchmarkFieldCols looks up the columns of all the fields of a full row
+// by name in fieldIndices and by position in fieldCols, as decodeRow does.
+// BenchmarkDecodeRow and BenchmarkEncodeRow cover the paths using them.
+func BenchmarkFieldCols(b *testing.B) {
+	c := newTestCodec(b)
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, field := range c.fields {
+				benchCol += c.fieldIndices[field]
+			}
+		}
+	})
+	b.Run("position", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for n := range c.fields {
+				benchCol += c.fieldCols[n]
+			}
+		}
+	})
+}
+
+// BenchmarkEncodeRowBuf encodes rows of varying sizes into the pooled
+// buffers, grown to the row size hint first or left to grow during the
+// encoding.
+func BenchmarkEncodeRowBuf(b *testing.B) {
+	rows := []map[string][]byte{benchValues(10, 100), benchValues(10, 1000), benchValues(10, 10000)}
+	encodes := []struct {
+		name   string
+		encode func(c *codec, buf *bytes.Buffer, values map[string][]byte) ([]byte, error)
+	}{
+		{"hint", (*codec).encodeRowBuf},
+		{"nohint", func(c *codec, buf *bytes.Buffer, values map[string][]byte) ([]byte, error) {
+			return c.encodeRow(buf.Bytes(), values)
+		}},
+	}
+	for _, e := range encodes {
+		encode := e.encode
+		b.Run(e.name, func(b *testing.B) {
+			c := newTestCodec(b)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf := c.bufPool.Get()
+				if _, err := encode(c, buf, rows[i%len(rows)]); err != nil {
+					b.Fatal(err)
+				}
+				c.bufPool.Put(buf)
+			}
+		})
+	}
+}
+
+// BenchmarkEncodeRows encodes a batch of 10k rows with 1 and 8 workers.
+func BenchmarkEncodeRows(b *testing.B) {
+	rows := make([]map[string][]byte, 10000)
+	for i := range rows {
+		rows[i] = benchValues(10, 100)
+	}
+	for _, workers := range []string{"1", "8"} {
+		c := newTestCodec(b, tikvRawEncodeWorkers, workers)
+		b.Run("workers="+workers, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.encodeRows(rows); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+var (
+	errNoRawCommitTS = errors.New("raw writes have no commit timestamp, use the txn driver")
+	errNoCommitTS    = errors.New("this TiKV client does not expose the commit timestamp of a transaction")
+)
+
+// commitTSTxn is a transaction exposing its commit timestamp once committed.
+// The vendored client keeps it unexported.
+type commitTSTxn interface {
+	CommitTS() uint64
+}
+
+// InsertWithTS is Insert returning the commit timestamp of the write, so a
+// benchmark can order the writes. The raw writes are not timestamped, so it
+// always fails before writing.
+func (db *rawDB) InsertWithTS(ctx context.Context, table string, key string, values map[string][]byte) (uint64, error) {
+	return 0, errNoRawCommitTS
+}
+
+// InsertWithTS is Insert returning the commit timestamp of the transaction of
+// the write. It fails before writing when the client does not expose the
+// commit timestamp, see CapCommitTS.
+func (db *txnDB) InsertWithTS(ctx context.Context, table string, key string, values map[string][]byte) (uint64, error) {
+	values, err := db.insertValues(values)
+	if err != nil {
+		return 0, err
+	}
+
+	rowKey, err := db.getRowKey(table, db.insertKey(key, values))
+	if err != nil {
+		return 0, err
+	}
+
+	// The last transaction is the committed one, the others conflicted.
+	var last commitTSTxn
+	err = db.runTxn(ctx, func(tx kv.Transaction) error {
+		ct, ok := tx.(commitTSTxn)
+		if !ok {
+			return errNoCommitTS
+		}
+		last = ct
+		return db.set(tx, rowKey, values)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return last.CommitTS(), nil
+}
+
+// InsertWithTS is routed like Insert.
+func (db *mixedDB) InsertWithTS(ctx context.Context, table string, key string, values map[string][]byte) (uint64, error) {
+	if txn, ok := db.route("insert").(*txnDB); ok {
+		return txn.InsertWithTS(ctx, table, key, values)
+	}
+	return db.raw.InsertWithTS(ctx, table, key, values)
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// noCompactionError returns the error of TriggerCompaction, with the range of
+// the table to compact by hand.
+func noCompactionError(c *codec, table string) error {
+	start := c.appendTablePrefix(nil, table)
+	end := kv.Key(start).PrefixNext()
+	return fmt.Errorf("this TiKV client can not compact a range, which needs the debug service of TiKV 2.0 or later, "+
+		"compact the keys [%q, %q) of table %s with tikv-ctl instead", start, end, table)
+}
+
+// TriggerCompaction would compact the key range of table on every store, so
+// a run after heavy churn measures the steady state. It always fails, with the
+// range to compact with tikv-ctl.
+func (db *rawDB) TriggerCompaction(ctx context.Context, table string) error {
+	return noCompactionError(db.tableCodec(table), table)
+}
+
+// TriggerCompaction is rawDB.TriggerCompaction, the keys in the error are the
+// row keys, which TiKV stores encoded with their versions in txn mode.
+func (db *txnDB) TriggerCompaction(ctx context.Context, table string) error {
+	return noCompactionError(db.codec, table)
+}
+
+// TriggerCompaction is rawDB.TriggerCompaction, the drivers share the rows.
+func (db *mixedDB) TriggerCompaction(ctx context.Context, table string) error {
+	return db.raw.TriggerCompaction(ctx, table)
+}
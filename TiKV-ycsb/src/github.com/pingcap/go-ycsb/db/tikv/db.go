@@ -15,6 +15,7 @@ package tikv
 
 import (
 	"fmt"
+	"runtime"
 
 	"github.com/magiconair/properties"
 	"github.com/pingcap/go-ycsb/pkg/prop"
@@ -23,20 +24,44 @@ import (
 
 const (
 	tikvPD = "tikv.pd"
-	// raw, txn, or coprocessor
+	// raw, txn, mixed, or coprocessor
 	tikvType = "tikv.type"
+	// tikvMaxConnCount is the number of gRPC connections to every store, 0
+	// derives it from GOMAXPROCS and the thread count.
+	tikvMaxConnCount = "tikv.maxConnCount"
+)
+
+// maxConnsPerProc and maxDerivedConns bound the derived connection count.
+const (
+	maxConnsPerProc = 4
+	maxDerivedConns = 128
 )
 
 type tikvCreator struct {
 }
 
 func (c tikvCreator) Create(p *properties.Properties) (ycsb.DB, error) {
+	db, err := c.create(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := warmupFromProperties(p, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (c tikvCreator) create(p *properties.Properties) (ycsb.DB, error) {
 	tp := p.GetString(tikvType, "raw")
 	switch tp {
 	case "raw":
 		return createRawDB(p)
 	case "txn":
-		return nil, fmt.Errorf("txn is not supported now for TiKV")
+		return createTxnDB(p)
+	case "mixed":
+		return createMixedDB(p)
 	case "coprocessor":
 		return nil, fmt.Errorf("coprocessor is not supported now for TiKV")
 	default:
@@ -44,8 +69,45 @@ func (c tikvCreator) Create(p *properties.Properties) (ycsb.DB, error) {
 	}
 }
 
-func createFieldIndices(p *properties.Properties) map[string]int64 {
-	fieldCount := p.GetInt64(prop.FieldCount, prop.FieldCountDefault)
+// maxConnCount returns tikvMaxConnCount, or the count derived from GOMAXPROCS
+// and the thread count if it is 0.
+func maxConnCount(p *properties.Properties) (int, error) {
+	return resolveConnCount(p.GetInt(tikvMaxConnCount, 0), p.GetInt(prop.ThreadCount, int(prop.ThreadCountDefault)), defaultLogger)
+}
+
+// resolveConnCount returns n, or the count derived from GOMAXPROCS and the
+// threads if n is 0, which is logged to log.
+func resolveConnCount(n int, threads int, log Logger) (int, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("%s must not be negative, got %d", tikvMaxConnCount, n)
+	} else if n > 0 {
+		return n, nil
+	}
+
+	procs := runtime.GOMAXPROCS(0)
+	n = deriveConnCount(procs, threads)
+	log.Infof("%s is unset, using %d connections per store for %d procs and %d threads", tikvMaxConnCount, n, procs, threads)
+	return n, nil
+}
+
+// deriveConnCount gives every proc maxConnsPerProc connections, as more
+// connections than procs only add idle ones, but no more than the threads,
+// which can not keep more connections busy, and at most maxDerivedConns.
+func deriveConnCount(procs int, threads int) int {
+	n := procs * maxConnsPerProc
+	if n > threads {
+		n = threads
+	}
+	if n > maxDerivedConns {
+		n = maxDerivedConns
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func createFieldIndices(fieldCount int64) map[string]int64 {
 	m := make(map[string]int64, fieldCount)
 	for i := int64(0); i < fieldCount; i++ {
 		field := fmt.Sprintf("field%d", i)
@@ -54,8 +116,7 @@ func createFieldIndices(p *properties.Properties) map[string]int64 {
 	return m
 }
 
-func allFields(p *properties.Properties) []string {
-	fieldCount := p.GetInt64(prop.FieldCount, prop.FieldCountDefault)
+func allFields(fieldCount int64) []string {
 	fields := make([]string, 0, fieldCount)
 	for i := int64(0); i < fieldCount; i++ {
 		field := fmt.Sprintf("field%d", i)
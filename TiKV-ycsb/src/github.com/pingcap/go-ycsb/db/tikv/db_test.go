@@ -0,0 +1,86 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordLogger keeps the messages logged.
+type recordLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordLogger) Infof(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Warnf(format string, args ...interface{}) {
+	l.Infof(format, args...)
+}
+
+func TestDeriveConnCount(t *testing.T) {
+	tests := []struct {
+		procs, threads int
+		want           int
+	}{
+		{1, 100, 4},
+		{8, 100, 32},
+		{8, 10, 10},
+		{64, 1000, maxDerivedConns},
+		{4, 0, 1},
+	}
+	for _, tt := range tests {
+		if n := deriveConnCount(tt.procs, tt.threads); n != tt.want {
+			t.Errorf("deriveConnCount(%d, %d) = %d, want %d", tt.procs, tt.threads, n, tt.want)
+		}
+	}
+}
+
+func TestResolveConnCount(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	tests := []struct {
+		n, threads int
+		// want is the count, -1 if it fails, and logged whether it is logged.
+		want   int
+		logged bool
+	}{
+		{16, 1, 16, false},
+		{0, 1000, deriveConnCount(procs, 1000), true},
+		{-1, 1, -1, false},
+	}
+	for _, tt := range tests {
+		log := &recordLogger{}
+		n, err := resolveConnCount(tt.n, tt.threads, log)
+		if tt.want < 0 {
+			if err == nil {
+				t.Errorf("resolveConnCount(%d) = %d, want an error", tt.n, n)
+			}
+			continue
+		}
+		if err != nil || n != tt.want {
+			t.Errorf("resolveConnCount(%d, %d) = %d, %v, want %d", tt.n, tt.threads, n, err, tt.want)
+		}
+		if logged := len(log.msgs) == 1 && strings.Contains(log.msgs[0], fmt.Sprintf("using %d connections", n)); logged != tt.logged {
+			t.Errorf("resolveConnCount(%d, %d) logged %q", tt.n, tt.threads, log.msgs)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// debugHost is the host of a debugging address without one, the endpoints can
+// write to the store, so they are not exposed unless asked to.
+const debugHost = "127.0.0.1"
+
+// debugInsert is the body of POST /insert.
+type debugInsert struct {
+	Table  string            `json:"table"`
+	Key    string            `json:"key"`
+	Values map[string]string `json:"values"`
+}
+
+// ServeHTTP serves the debugging endpoints of the driver on addr until the
+// listener fails, an address without host listens on localhost only. The
+// values are written and returned as JSON strings.
+//
+//	GET /read?table=&key=[&fields=f1,f2] returns the row, 404 if it is missing
+//	GET /scan?table=&start=&count=[&fields=f1,f2] returns an array of rows
+//	POST /insert takes {"table": "", "key": "", "values": {"field0": ""}}
+func (db *rawDB) ServeHTTP(addr string) error {
+	lis, err := listenDebug(addr)
+	if err != nil {
+		return err
+	}
+	return http.Serve(lis, db.debugHandler())
+}
+
+func listenDebug(addr string) (net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid debugging HTTP address %q: %v", addr, err)
+	}
+	if host == "" {
+		host = debugHost
+	}
+	return net.Listen("tcp", net.JoinHostPort(host, port))
+}
+
+func (db *rawDB) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/read", db.debugRead)
+	mux.HandleFunc("/scan", db.debugScan)
+	mux.HandleFunc("/insert", db.debugInsert)
+	return mux
+}
+
+func (db *rawDB) debugRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "read must be a GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	row, err := db.Read(r.Context(), q.Get("table"), q.Get("key"), debugFields(q.Get("fields")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if row == nil {
+		http.Error(w, "row not found", http.StatusNotFound)
+		return
+	}
+	writeDebugJSON(w, rowStrings(row))
+}
+
+func (db *rawDB) debugScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "scan must be a GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	count, err := strconv.Atoi(q.Get("count"))
+	if err != nil || count <= 0 {
+		http.Error(w, fmt.Sprintf("invalid scan count %q", q.Get("count")), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.Scan(r.Context(), q.Get("table"), q.Get("start"), count, debugFields(q.Get("fields")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		res[i] = rowStrings(row)
+	}
+	writeDebugJSON(w, res)
+}
+
+func (db *rawDB) debugInsert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "insert must be a POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req debugInsert
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid insert: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	values := make(map[string][]byte, len(req.Values))
+	for field, v := range req.Values {
+		values[field] = []byte(v)
+	}
+	if err := db.Insert(r.Context(), req.Table, req.Key, values); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// debugFields splits the fields of a query, "" is all the fields.
+func debugFields(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func writeDebugJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	db, _ := newTestRawDB(t, "fieldcount", "2")
+	h := db.debugHandler()
+	tests := []struct {
+		method, url, body string
+		code              int
+		// want is the JSON response, "" if it is not checked.
+		want string
+	}{
+		{"POST", "/insert", `{"table":"usertable","key":"user1","values":{"field0":"a","field1":"b"}}`, http.StatusNoContent, ""},
+		{"POST", "/insert", `{"table":"usertable","key":"user2","values":{"field0":"c"}}`, http.StatusNoContent, ""},
+		{"GET", "/read?table=usertable&key=user1", "", http.StatusOK, `{"field0":"a","field1":"b"}`},
+		{"GET", "/read?table=usertable&key=user1&fields=field1", "", http.StatusOK, `{"field1":"b"}`},
+		{"GET", "/read?table=usertable&key=user3", "", http.StatusNotFound, ""},
+		{"GET", "/scan?table=usertable&start=user1&count=10", "", http.StatusOK, `[{"field0":"a","field1":"b"},{"field0":"c"}]`},
+		{"GET", "/scan?table=usertable&start=user2&count=1&fields=field0", "", http.StatusOK, `[{"field0":"c"}]`},
+		{"GET", "/scan?table=usertable&start=user9&count=1", "", http.StatusOK, `[]`},
+		{"GET", "/scan?table=usertable&count=0", "", http.StatusBadRequest, ""},
+		{"GET", "/scan?table=usertable", "", http.StatusBadRequest, ""},
+		{"POST", "/insert", `{"table":`, http.StatusBadRequest, ""},
+		{"GET", "/insert", "", http.StatusMethodNotAllowed, ""},
+		{"POST", "/read?table=usertable&key=user1", "", http.StatusMethodNotAllowed, ""},
+		{"POST", "/scan?table=usertable&count=1", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("%s %s: %d %q, want %d", tt.method, tt.url, w.Code, w.Body.String(), tt.code)
+			continue
+		}
+		if tt.want == "" {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: content type %q", tt.method, tt.url, ct)
+		}
+		if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+			t.Errorf("%s %s: %s, want %s", tt.method, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestListenDebug(t *testing.T) {
+	tests := []struct {
+		addr string
+		// host is the host listened on, "" if the address is invalid.
+		host string
+	}{
+		{":0", debugHost},
+		{"127.0.0.1:0", "127.0.0.1"},
+		{"localhost", ""},
+	}
+	for _, tt := range tests {
+		lis, err := listenDebug(tt.addr)
+		if tt.host == "" {
+			if err == nil {
+				lis.Close()
+				t.Errorf("listenDebug(%q) listened on %s", tt.addr, lis.Addr())
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("listenDebug(%q): %v", tt.addr, err)
+		}
+		if host, _, _ := net.SplitHostPort(lis.Addr().String()); host != tt.host {
+			t.Errorf("listenDebug(%q) listened on %s, want host %s", tt.addr, lis.Addr(), tt.host)
+		}
+		lis.Close()
+	}
+}
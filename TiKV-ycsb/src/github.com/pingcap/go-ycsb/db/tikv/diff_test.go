@@ -0,0 +1,93 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestDiffTables(t *testing.T) {
+	ctx := context.Background()
+	// The tables span several scan pages, so the lockstep crosses pages at
+	// different keys.
+	var keys []string
+	for i := 0; i < 2*rawScanBatchSize+500; i++ {
+		keys = append(keys, fmt.Sprintf("user%04d", i))
+	}
+
+	tests := []struct {
+		name string
+		kvs  []string
+		// missing, extra and changed are the keys tableB misses, adds and
+		// changes compared to tableA.
+		missing, extra, changed []string
+	}{
+		{name: "identical"},
+		{name: "divergent",
+			missing: []string{"user0000", "user1500"},
+			extra:   []string{"user", "user9999", "user1500x"},
+			changed: []string{"user1023", "user1024", "user2547"}},
+		{name: "empty", missing: keys},
+		// The tokens of the writes differ, but not the rows.
+		{name: "idempotent", kvs: []string{tikvRawIdempotentWrites, "true"}, changed: []string{"user0001"}},
+	}
+	for _, tt := range tests {
+		db, _ := newTestRawDB(t, tt.kvs...)
+		skip := make(map[string]bool)
+		for _, key := range tt.missing {
+			skip[key] = true
+		}
+		change := make(map[string]bool)
+		for _, key := range tt.changed {
+			change[key] = true
+		}
+
+		for _, key := range keys {
+			if err := db.Insert(ctx, "a", key, map[string][]byte{"field0": []byte(key)}); err != nil {
+				t.Fatal(err)
+			}
+			if skip[key] {
+				continue
+			}
+			value := key
+			if change[key] {
+				value += "!"
+			}
+			if err := db.Insert(ctx, "b", key, map[string][]byte{"field0": []byte(value)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, key := range tt.extra {
+			if err := db.Insert(ctx, "b", key, map[string][]byte{"field0": []byte(key)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		added, removed, changed, err := db.DiffTables(ctx, "a", "b")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if added != int64(len(tt.extra)) || removed != int64(len(tt.missing)) || changed != int64(len(tt.changed)) {
+			t.Errorf("%s: DiffTables = %d added, %d removed, %d changed, want %d, %d, %d",
+				tt.name, added, removed, changed, len(tt.extra), len(tt.missing), len(tt.changed))
+		}
+		// The other way around adds what was removed.
+		added, removed, changed, err = db.DiffTables(ctx, "b", "a")
+		if err != nil || added != int64(len(tt.missing)) || removed != int64(len(tt.extra)) || changed != int64(len(tt.changed)) {
+			t.Errorf("%s: DiffTables of b and a = %d added, %d removed, %d changed, %v", tt.name, added, removed, changed, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// properties
+const (
+	// tikvRawDetectDuplicates checks the keys of BatchInsert and ImportCSV
+	// before writing them, "report" counts and logs the rows overwritten,
+	// "error" fails the write, "" does not check.
+	tikvRawDetectDuplicates = "tikv.raw.detectDuplicates"
+)
+
+const (
+	duplicatesReport = "report"
+	duplicatesError  = "error"
+)
+
+// DuplicateKeysError is returned by a load which would overwrite existing rows
+// with tikvRawDetectDuplicates "error", nothing of the batch is written.
+type DuplicateKeysError struct {
+	Table string
+	// Keys are the keys of the existing rows.
+	Keys []string
+}
+
+func (e *DuplicateKeysError) Error() string {
+	return fmt.Sprintf("%d keys already exist in table %s, like %q", len(e.Keys), e.Table, e.Keys[0])
+}
+
+// reportDuplicates counts the keys of the existing rows as "duplicate_key",
+// and fails with a DuplicateKeysError in "error" mode or logs them.
+func reportDuplicates(mode string, log Logger, stats *stats, table string, dups []string) error {
+	if len(dups) == 0 {
+		return nil
+	}
+
+	stats.add("duplicate_key", int64(len(dups)))
+	if mode == duplicatesError {
+		return &DuplicateKeysError{Table: table, Keys: dups}
+	}
+	log.Warnf("overwriting %d existing rows of table %s, like %q", len(dups), table, dups[0])
+	return nil
+}
+
+// checkDuplicates reads the keys one by one, so it doubles the requests of the
+// load.
+func (db *rawDB) checkDuplicates(ctx context.Context, table string, keys []string) error {
+	var dups []string
+	for _, key := range keys {
+		ok, err := db.Exists(ctx, table, key)
+		if err != nil {
+			return err
+		} else if ok {
+			dups = append(dups, key)
+		}
+	}
+	return reportDuplicates(db.cfg.DetectDuplicates, db.cfg.logger(), db.stats, table, dups)
+}
+
+// checkDuplicates reads the keys with one BatchGet of the latest snapshot, the
+// rows written after it are not seen.
+func (db *txnDB) checkDuplicates(ctx context.Context, table string, keys []string) error {
+	rowKeys := make([]kv.Key, len(keys))
+	for i, key := range keys {
+		rowKey, err := db.getRowKey(table, key)
+		if err != nil {
+			return err
+		}
+		rowKeys[i] = rowKey
+	}
+
+	ver, err := db.db.CurrentVersion()
+	if err != nil {
+		return err
+	}
+	snapshot, err := db.db.GetSnapshot(ver)
+	if err != nil {
+		return err
+	}
+	values, err := snapshot.BatchGet(rowKeys)
+	if err != nil {
+		return err
+	}
+
+	var dups []string
+	for i, rowKey := range rowKeys {
+		if len(values[string(rowKey)]) > 0 {
+			dups = append(dups, keys[i])
+		}
+	}
+	return reportDuplicates(db.detectDuplicates, defaultLogger, db.stats, table, dups)
+}
@@ -0,0 +1,184 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// ExportKeys writes the row key of every row of the table to w, one per line
+// in the upper case hex form of `tikv-ctl --to-hex`, in the order of the keys,
+// so they can be checked against the cluster with tikv-ctl. Like RowKey, the
+// keys are the stored ones, with the keyspace prefix, the salt bucket and the
+// reversed or truncated key of the layout. It scans the whole table, so it is
+// expensive.
+func (db *rawDB) ExportKeys(ctx context.Context, table string, w io.Writer) error {
+	prefix := db.tableCodec(table).appendTablePrefix(nil, table)
+	it := db.newIterator(ctx, prefix, kv.Key(prefix).PrefixNext())
+	bw := bufio.NewWriter(w)
+	for it.Next() {
+		if _, err := fmt.Fprintf(bw, "%X\n", it.Key()); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// ExportJSON writes the rows of the table to w in the order of the keys, one
+// JSON object per line mapping the logical key to the fields of the row, like
+// {"user1":{"field0":"..."}}. The values are written as strings. The rows are
+// read page by page, so the memory used does not grow with the table. With
+// tikvRawKeyDecode the logical keys are written encoded again, in lower case
+// for "hex", and the logical key of a row key truncated by tikvRawMaxKeyBytes
+// can not be recovered.
+func (db *rawDB) ExportJSON(ctx context.Context, table string, w io.Writer) error {
+	c := db.tableCodec(table)
+	prefix := c.appendTablePrefix(nil, table)
+	it := db.newIterator(ctx, prefix, kv.Key(prefix).PrefixNext())
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for it.Next() {
+		key, err := c.logicalKey(table, it.Key())
+		if err != nil {
+			return err
+		}
+
+		row, err := c.decodeRow(ctx, it.Value(), nil)
+		if err != nil {
+			return fmt.Errorf("decode row of key %q in table %s: %v", key, table, err)
+		}
+
+		if err := enc.Encode(map[string]map[string]string{key: rowStrings(row)}); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// rowStrings converts the values of a row to strings for JSON.
+func rowStrings(row map[string][]byte) map[string]string {
+	fields := make(map[string]string, len(row))
+	for field, value := range row {
+		fields[field] = string(value)
+	}
+	return fields
+}
+
+// ImportCSV inserts the rows of the CSV read from r into the table and returns
+// the number of rows imported. The header names the columns, keyCol is the key
+// and each other column is one of the configured fields. The rows go through
+// Insert, so they are encoded like the loaded ones and tikvRawMissingFields
+// applies to the fields missing from the header. The rows are put one by one,
+// and the rows before a failed one stay imported. With tikvRawDetectDuplicates
+// every key is read before its row is put, and the rows overwritten are logged
+// once at the end.
+func (db *rawDB) ImportCSV(ctx context.Context, table string, r io.Reader, keyCol string) (int64, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return 0, fmt.Errorf("import of table %s: empty CSV, no header", table)
+	} else if err != nil {
+		return 0, err
+	}
+
+	keyIdx, fields, err := db.tableCodec(table).csvColumns(header, keyCol)
+	if err != nil {
+		return 0, fmt.Errorf("import of table %s: %v", table, err)
+	}
+
+	var n, dups int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		record, err := cr.Read()
+		if err == io.EOF {
+			if dups > 0 {
+				db.cfg.logger().Warnf("import of table %s overwrote %d existing rows", table, dups)
+			}
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+
+		if db.cfg.DetectDuplicates != "" {
+			ok, err := db.Exists(ctx, table, record[keyIdx])
+			if err != nil {
+				return n, err
+			} else if ok {
+				db.stats.add("duplicate_key", 1)
+				if db.cfg.DetectDuplicates == duplicatesError {
+					return n, &DuplicateKeysError{Table: table, Keys: []string{record[keyIdx]}}
+				}
+				dups++
+			}
+		}
+
+		values := make(map[string][]byte, len(fields))
+		for i, field := range fields {
+			if i != keyIdx {
+				values[field] = []byte(record[i])
+			}
+		}
+		if err := db.Insert(ctx, table, record[keyIdx], values); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// csvColumns checks the CSV header and returns the index of the key column and
+// the field of each column.
+func (c *codec) csvColumns(header []string, keyCol string) (int, []string, error) {
+	keyIdx := -1
+	fields := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, col := range header {
+		if seen[col] {
+			return 0, nil, fmt.Errorf("duplicate CSV column %q", col)
+		}
+		seen[col] = true
+
+		if col == keyCol {
+			keyIdx = i
+			continue
+		}
+		if _, ok := c.fieldIndices[col]; !ok {
+			return 0, nil, fmt.Errorf("CSV column %q is not one of the %d fields", col, len(c.fields))
+		}
+		fields[i] = col
+	}
+
+	if keyIdx < 0 {
+		return 0, nil, fmt.Errorf("no key column %q in the CSV header", keyCol)
+	}
+	return keyIdx, fields, nil
+}
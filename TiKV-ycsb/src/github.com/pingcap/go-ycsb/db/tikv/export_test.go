@@ -0,0 +1,108 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestImportExportJSON(t *testing.T) {
+	ctx := context.Background()
+	const csvRows = "key,field1,field0\nuser1,b,a\nuser2,,\"x,y\"\nuser10,\"q\"\"\",c\n"
+	want := map[string]map[string]string{
+		"user1":  {"field0": "a", "field1": "b"},
+		"user2":  {"field0": "x,y", "field1": ""},
+		"user10": {"field0": "c", "field1": "q\""},
+	}
+	hexRows := "key,field0,field1\n" + hex.EncodeToString([]byte("user1")) + ",A,B\n"
+	hexWant := map[string]map[string]string{hex.EncodeToString([]byte("user1")): {"field0": "A", "field1": "B"}}
+
+	tests := []struct {
+		kvs  []string
+		csv  string
+		want map[string]map[string]string
+	}{
+		{nil, csvRows, want},
+		{[]string{tikvRawKeyspacePrefix, "run1/"}, csvRows, want},
+		{[]string{tikvRawSaltBuckets, "4"}, csvRows, want},
+		{[]string{tikvRawReverseKey, "true"}, csvRows, want},
+		{[]string{tikvRawEncoding, "json"}, csvRows, want},
+		{[]string{tikvRawEncoding, "msgpack"}, csvRows, want},
+		{[]string{tikvRawKeyDecode, "hex"}, hexRows, hexWant},
+	}
+	for _, tt := range tests {
+		db, m := newTestRawDB(t, append([]string{"fieldcount", "2"}, tt.kvs...)...)
+		// The key of the other row is valid hex for tikvRawKeyDecode.
+		if err := db.Insert(ctx, "other", "6f74686572", map[string][]byte{"field0": []byte("o")}); err != nil {
+			t.Fatal(err)
+		}
+		n, err := db.ImportCSV(ctx, "usertable", strings.NewReader(tt.csv), "key")
+		if err != nil || n != int64(len(tt.want)) {
+			t.Fatalf("%v: ImportCSV = %d, %v, want %d rows", tt.kvs, n, err, len(tt.want))
+		}
+
+		var out bytes.Buffer
+		if err := db.ExportJSON(ctx, "usertable", &out); err != nil {
+			t.Fatalf("%v: ExportJSON: %v", tt.kvs, err)
+		}
+		got := make(map[string]map[string]string)
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		for _, line := range lines {
+			var row map[string]map[string]string
+			if err := json.Unmarshal([]byte(line), &row); err != nil || len(row) != 1 {
+				t.Fatalf("%v: exported line %q is not one row: %v", tt.kvs, line, err)
+			}
+			for key, fields := range row {
+				got[key] = fields
+			}
+		}
+		if len(lines) != len(tt.want) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: exported %q, want %v", tt.kvs, out.String(), tt.want)
+		}
+
+		// ExportKeys writes the stored keys of the table in order.
+		out.Reset()
+		if err := db.ExportKeys(ctx, "usertable", &out); err != nil {
+			t.Fatalf("%v: ExportKeys: %v", tt.kvs, err)
+		}
+		var keys []string
+		for _, line := range strings.Fields(out.String()) {
+			if line != strings.ToUpper(line) {
+				t.Errorf("%v: exported key %s is not upper case", tt.kvs, line)
+			}
+			k, err := hex.DecodeString(line)
+			if err != nil {
+				t.Fatalf("%v: exported key %s: %v", tt.kvs, line, err)
+			}
+			keys = append(keys, string(k))
+		}
+		var stored []string
+		prefix := string(db.tableCodec("usertable").appendTablePrefix(nil, "usertable"))
+		for _, k := range m.keys() {
+			if strings.HasPrefix(k, prefix) {
+				stored = append(stored, k)
+			}
+		}
+		if !sort.StringsAreSorted(keys) || !reflect.DeepEqual(keys, stored) {
+			t.Errorf("%v: ExportKeys wrote %q, want %q", tt.kvs, keys, stored)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import "context"
+
+// ReadFields and ScanFields take the fields inline, like
+// ReadFields(ctx, table, key, "field0", "field1"), no fields read them all.
+
+// ReadFields is Read with inline fields.
+func (db *rawDB) ReadFields(ctx context.Context, table string, key string, fields ...string) (map[string][]byte, error) {
+	return db.Read(ctx, table, key, fields)
+}
+
+// ScanFields is Scan with inline fields.
+func (db *rawDB) ScanFields(ctx context.Context, table string, startKey string, count int, fields ...string) ([]map[string][]byte, error) {
+	return db.Scan(ctx, table, startKey, count, fields)
+}
+
+// ReadFields is Read with inline fields.
+func (db *txnDB) ReadFields(ctx context.Context, table string, key string, fields ...string) (map[string][]byte, error) {
+	return db.Read(ctx, table, key, fields)
+}
+
+// ScanFields is Scan with inline fields.
+func (db *txnDB) ScanFields(ctx context.Context, table string, startKey string, count int, fields ...string) ([]map[string][]byte, error) {
+	return db.Scan(ctx, table, startKey, count, fields)
+}
+
+// ReadFields is Read with inline fields.
+func (db *mixedDB) ReadFields(ctx context.Context, table string, key string, fields ...string) (map[string][]byte, error) {
+	return db.Read(ctx, table, key, fields)
+}
+
+// ScanFields is Scan with inline fields.
+func (db *mixedDB) ScanFields(ctx context.Context, table string, startKey string, count int, fields ...string) ([]map[string][]byte, error) {
+	return db.Scan(ctx, table, startKey, count, fields)
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"net"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServiceName is the service of ycsb.proto, which the clients in other
+// languages are generated from. The messages below are written by hand to
+// match it, the fields are numbered like in the proto file.
+const grpcServiceName = "tikv.ycsb.YCSB"
+
+type grpcReadRequest struct {
+	Table  string   `protobuf:"bytes,1,opt,name=table,proto3"`
+	Key    string   `protobuf:"bytes,2,opt,name=key,proto3"`
+	Fields []string `protobuf:"bytes,3,rep,name=fields"`
+}
+
+func (m *grpcReadRequest) Reset()         { *m = grpcReadRequest{} }
+func (m *grpcReadRequest) String() string { return proto.CompactTextString(m) }
+func (*grpcReadRequest) ProtoMessage()    {}
+
+type grpcReadResponse struct {
+	Found  bool              `protobuf:"varint,1,opt,name=found,proto3"`
+	Values map[string][]byte `protobuf:"bytes,2,rep,name=values" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *grpcReadResponse) Reset()         { *m = grpcReadResponse{} }
+func (m *grpcReadResponse) String() string { return proto.CompactTextString(m) }
+func (*grpcReadResponse) ProtoMessage()    {}
+
+type grpcScanRequest struct {
+	Table    string   `protobuf:"bytes,1,opt,name=table,proto3"`
+	StartKey string   `protobuf:"bytes,2,opt,name=start_key,json=startKey,proto3"`
+	Count    int32    `protobuf:"varint,3,opt,name=count,proto3"`
+	Fields   []string `protobuf:"bytes,4,rep,name=fields"`
+}
+
+func (m *grpcScanRequest) Reset()         { *m = grpcScanRequest{} }
+func (m *grpcScanRequest) String() string { return proto.CompactTextString(m) }
+func (*grpcScanRequest) ProtoMessage()    {}
+
+type grpcRow struct {
+	Values map[string][]byte `protobuf:"bytes,1,rep,name=values" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *grpcRow) Reset()         { *m = grpcRow{} }
+func (m *grpcRow) String() string { return proto.CompactTextString(m) }
+func (*grpcRow) ProtoMessage()    {}
+
+type grpcScanResponse struct {
+	Rows []*grpcRow `protobuf:"bytes,1,rep,name=rows"`
+}
+
+func (m *grpcScanResponse) Reset()         { *m = grpcScanResponse{} }
+func (m *grpcScanResponse) String() string { return proto.CompactTextString(m) }
+func (*grpcScanResponse) ProtoMessage()    {}
+
+type grpcInsertRequest struct {
+	Table  string            `protobuf:"bytes,1,opt,name=table,proto3"`
+	Key    string            `protobuf:"bytes,2,opt,name=key,proto3"`
+	Values map[string][]byte `protobuf:"bytes,3,rep,name=values" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *grpcInsertRequest) Reset()         { *m = grpcInsertRequest{} }
+func (m *grpcInsertRequest) String() string { return proto.CompactTextString(m) }
+func (*grpcInsertRequest) ProtoMessage()    {}
+
+type grpcDeleteRequest struct {
+	Table string `protobuf:"bytes,1,opt,name=table,proto3"`
+	Key   string `protobuf:"bytes,2,opt,name=key,proto3"`
+}
+
+func (m *grpcDeleteRequest) Reset()         { *m = grpcDeleteRequest{} }
+func (m *grpcDeleteRequest) String() string { return proto.CompactTextString(m) }
+func (*grpcDeleteRequest) ProtoMessage()    {}
+
+// grpcEmpty is the response of the writes.
+type grpcEmpty struct{}
+
+func (m *grpcEmpty) Reset()         { *m = grpcEmpty{} }
+func (m *grpcEmpty) String() string { return proto.CompactTextString(m) }
+func (*grpcEmpty) ProtoMessage()    {}
+
+// grpcServer serves the rawDB, the requests run without InitThread, so they
+// do not read their own writes with tikvRawReadYourWrites.
+type grpcServer struct {
+	db *rawDB
+}
+
+func (s *grpcServer) read(ctx context.Context, req *grpcReadRequest) (*grpcReadResponse, error) {
+	values, err := s.db.Read(ctx, req.Table, req.Key, req.Fields)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcReadResponse{Found: values != nil, Values: values}, nil
+}
+
+func (s *grpcServer) scan(ctx context.Context, req *grpcScanRequest) (*grpcScanResponse, error) {
+	if req.Count <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "scan count must be positive, got %d", req.Count)
+	}
+
+	rows, err := s.db.Scan(ctx, req.Table, req.StartKey, int(req.Count), req.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &grpcScanResponse{Rows: make([]*grpcRow, len(rows))}
+	for i, row := range rows {
+		resp.Rows[i] = &grpcRow{Values: row}
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) insert(ctx context.Context, req *grpcInsertRequest) (*grpcEmpty, error) {
+	return &grpcEmpty{}, s.db.Insert(ctx, req.Table, req.Key, req.Values)
+}
+
+func (s *grpcServer) delete(ctx context.Context, req *grpcDeleteRequest) (*grpcEmpty, error) {
+	return &grpcEmpty{}, s.db.Delete(ctx, req.Table, req.Key)
+}
+
+// grpcMethod describes a unary method, which decodes the request with newReq
+// and serves it with call.
+func grpcMethod(name string, newReq func() interface{}, call func(s *grpcServer, ctx context.Context, req interface{}) (interface{}, error)) grpc.MethodDesc {
+	handler := func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+
+		s := srv.(*grpcServer)
+		if interceptor == nil {
+			return call(s, ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + grpcServiceName + "/" + name}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(s, ctx, req)
+		})
+	}
+	return grpc.MethodDesc{MethodName: name, Handler: handler}
+}
+
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		grpcMethod("Read", func() interface{} { return new(grpcReadRequest) },
+			func(s *grpcServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.read(ctx, req.(*grpcReadRequest))
+			}),
+		grpcMethod("Scan", func() interface{} { return new(grpcScanRequest) },
+			func(s *grpcServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.scan(ctx, req.(*grpcScanRequest))
+			}),
+		grpcMethod("Insert", func() interface{} { return new(grpcInsertRequest) },
+			func(s *grpcServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.insert(ctx, req.(*grpcInsertRequest))
+			}),
+		grpcMethod("Delete", func() interface{} { return new(grpcDeleteRequest) },
+			func(s *grpcServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.delete(ctx, req.(*grpcDeleteRequest))
+			}),
+	},
+	Metadata: "ycsb.proto",
+}
+
+// ServeGRPC serves Read, Scan, Insert and Delete of the driver over gRPC on
+// addr, with the service of ycsb.proto, so clients in other languages can
+// drive the same store. It blocks until the listener fails.
+func (db *rawDB) ServeGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return newGRPCServer(db).Serve(lis)
+}
+
+func newGRPCServer(db *rawDB) *grpc.Server {
+	s := grpc.NewServer()
+	s.RegisterService(&grpcServiceDesc, &grpcServer{db: db})
+	return s
+}
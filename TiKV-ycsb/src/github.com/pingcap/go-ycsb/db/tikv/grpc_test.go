@@ -0,0 +1,115 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// grpcClient is the client stub protoc would generate from ycsb.proto.
+type grpcClient struct {
+	cc *grpc.ClientConn
+}
+
+func (c *grpcClient) invoke(ctx context.Context, method string, req, resp interface{}) error {
+	return grpc.Invoke(ctx, "/"+grpcServiceName+"/"+method, req, resp, c.cc)
+}
+
+func (c *grpcClient) Read(ctx context.Context, req *grpcReadRequest) (*grpcReadResponse, error) {
+	resp := new(grpcReadResponse)
+	return resp, c.invoke(ctx, "Read", req, resp)
+}
+
+func (c *grpcClient) Scan(ctx context.Context, req *grpcScanRequest) (*grpcScanResponse, error) {
+	resp := new(grpcScanResponse)
+	return resp, c.invoke(ctx, "Scan", req, resp)
+}
+
+func (c *grpcClient) Insert(ctx context.Context, req *grpcInsertRequest) error {
+	return c.invoke(ctx, "Insert", req, new(grpcEmpty))
+}
+
+func (c *grpcClient) Delete(ctx context.Context, req *grpcDeleteRequest) error {
+	return c.invoke(ctx, "Delete", req, new(grpcEmpty))
+}
+
+func TestGRPC(t *testing.T) {
+	db, _ := newTestRawDB(t, "fieldcount", "2")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newGRPCServer(db)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	c := &grpcClient{cc: cc}
+	ctx := context.Background()
+
+	rows := []struct {
+		key    string
+		values map[string][]byte
+	}{
+		{"user1", map[string][]byte{"field0": []byte("a"), "field1": []byte("\x00\xff")}},
+		{"user2", map[string][]byte{"field0": []byte("b")}},
+		{"user3", map[string][]byte{"field1": []byte("c")}},
+	}
+	for _, row := range rows {
+		if err := c.Insert(ctx, &grpcInsertRequest{Table: "usertable", Key: row.key, Values: row.values}); err != nil {
+			t.Fatalf("Insert(%s): %v", row.key, err)
+		}
+	}
+	if err := c.Delete(ctx, &grpcDeleteRequest{Table: "usertable", Key: "user2"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	reads := []struct {
+		req  *grpcReadRequest
+		want *grpcReadResponse
+	}{
+		{&grpcReadRequest{Table: "usertable", Key: "user1"}, &grpcReadResponse{Found: true, Values: rows[0].values}},
+		{&grpcReadRequest{Table: "usertable", Key: "user1", Fields: []string{"field1"}},
+			&grpcReadResponse{Found: true, Values: map[string][]byte{"field1": []byte("\x00\xff")}}},
+		{&grpcReadRequest{Table: "usertable", Key: "user2"}, &grpcReadResponse{}},
+	}
+	for _, tt := range reads {
+		resp, err := c.Read(ctx, tt.req)
+		if err != nil || !reflect.DeepEqual(resp, tt.want) {
+			t.Errorf("Read(%v) = %v, %v, want %v", tt.req, resp, err, tt.want)
+		}
+	}
+
+	resp, err := c.Scan(ctx, &grpcScanRequest{Table: "usertable", StartKey: "user1", Count: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &grpcScanResponse{Rows: []*grpcRow{{Values: rows[0].values}, {Values: rows[2].values}}}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("Scan = %v, want %v", resp, want)
+	}
+	if _, err := c.Scan(ctx, &grpcScanRequest{Table: "usertable", Count: 0}); grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("Scan of 0 rows: err %v, want InvalidArgument", err)
+	}
+}
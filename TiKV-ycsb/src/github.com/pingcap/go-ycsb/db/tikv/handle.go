@@ -0,0 +1,104 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// Txn is a transaction started by Begin of the txn driver, it reads and
+// writes rows with the same encoding as the driver. A Txn is not safe for
+// concurrent use, it must be used by one goroutine and ended by Commit or
+// Rollback. Conflicts are not retried, the caller decides what to do when
+// Commit fails.
+type Txn struct {
+	db *txnDB
+	tx kv.Transaction
+}
+
+// Begin starts a new transaction.
+func (db *txnDB) Begin(ctx context.Context) (*Txn, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Txn{db: db, tx: tx}, nil
+}
+
+// StartTS returns the start timestamp of the transaction, which can be used
+// with ReadAt.
+func (t *Txn) StartTS() uint64 {
+	return t.tx.StartTS()
+}
+
+// Get reads the row in the transaction, it returns nil if the row does not
+// exist.
+func (t *Txn) Get(ctx context.Context, table string, key string, fields []string) (map[string][]byte, error) {
+	rowKey, err := t.db.getRowKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := t.db.getRow(t.tx, rowKey)
+	if err != nil {
+		return nil, err
+	} else if row == nil {
+		return nil, nil
+	}
+
+	return t.db.decodeRow(ctx, row, fields)
+}
+
+// Set writes the whole row in the transaction, the missing fields are handled
+// like Insert.
+func (t *Txn) Set(table string, key string, values map[string][]byte) error {
+	values, err := t.db.insertValues(values)
+	if err != nil {
+		return err
+	}
+
+	rowKey, err := t.db.getRowKey(table, t.db.insertKey(key, values))
+	if err != nil {
+		return err
+	}
+
+	return t.db.set(t.tx, rowKey, values)
+}
+
+// Delete deletes the row in the transaction.
+func (t *Txn) Delete(table string, key string) error {
+	rowKey, err := t.db.getRowKey(table, key)
+	if err != nil {
+		return err
+	}
+
+	return t.tx.Delete(rowKey)
+}
+
+// Commit commits the transaction, a write conflict is counted in the
+// "commit_conflict" stats of the driver.
+func (t *Txn) Commit(ctx context.Context) error {
+	err := t.tx.Commit(ctx)
+	if isWriteConflict(err) {
+		t.db.stats.add("commit_conflict", 1)
+	}
+	return err
+}
+
+// Rollback discards the transaction.
+func (t *Txn) Rollback() error {
+	return t.tx.Rollback()
+}
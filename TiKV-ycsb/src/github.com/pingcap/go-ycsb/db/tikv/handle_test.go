@@ -0,0 +1,78 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// memTxn is a kv.Transaction keeping its writes in a map.
+type memTxn struct {
+	kv.Transaction
+	rows map[string][]byte
+}
+
+func (tx *memTxn) Get(k kv.Key) ([]byte, error) {
+	if v, ok := tx.rows[string(k)]; ok {
+		return v, nil
+	}
+	return nil, kv.ErrNotExist
+}
+
+func (tx *memTxn) Set(k kv.Key, v []byte) error {
+	tx.rows[string(k)] = append([]byte(nil), v...)
+	return nil
+}
+
+func TestTxnSetMissingFields(t *testing.T) {
+	tests := []struct {
+		policy string
+		// want is the fields read back, nil if Set fails.
+		want []string
+	}{
+		{"skip", []string{"field0"}},
+		{"fillEmpty", []string{"field0", "field1"}},
+		{"error", nil},
+	}
+	for _, tt := range tests {
+		db := &txnDB{codec: newTestCodec(t, "fieldcount", "2", tikvRawMissingFields, tt.policy), stats: newStats()}
+		txn := &Txn{db: db, tx: &memTxn{rows: make(map[string][]byte)}}
+		err := txn.Set("usertable", "user1", map[string][]byte{"field0": []byte("a")})
+		if tt.want == nil {
+			if err == nil || !strings.Contains(err.Error(), "field1") {
+				t.Errorf("%s: Set of a row missing field1: err %v", tt.policy, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("%s: %v", tt.policy, err)
+		}
+
+		row, err := txn.Get(context.Background(), "usertable", "user1", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.policy, err)
+		}
+		if len(row) != len(tt.want) {
+			t.Errorf("%s: read %v, want the fields %v", tt.policy, row, tt.want)
+		}
+		for _, field := range tt.want {
+			if _, ok := row[field]; !ok {
+				t.Errorf("%s: read %v without %s", tt.policy, row, field)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"hash/crc32"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/pingcap/go-ycsb/pkg/util"
+)
+
+// Hot key properties, they are layout properties because the reads must find
+// the rows where the writes put them. They deliberately create a hotspot for
+// stress testing, never set them for a benchmark of the regular workload.
+const (
+	// tikvRawHotFraction is the fraction of the keys stored under one of the
+	// tikvRawHotRange hot keys instead of their own, 0 disables it.
+	tikvRawHotFraction = "tikv.raw.hotFraction"
+	// tikvRawHotRange is the number of hot keys.
+	tikvRawHotRange = "tikv.raw.hotRange"
+)
+
+// hotKeyPrefix starts the hot keys, so they are next to each other in the
+// table.
+const hotKeyPrefix = "hot"
+
+// hotKeys routes a fixed fraction of the keys to a few hot keys. A key is hot
+// by its hash, so every operation on the key goes to the same hot key.
+type hotKeys struct {
+	// hits counts the operations on the hot keys, it is accessed atomically.
+	hits int64
+	// threshold is the fraction scaled to the range of the hash, a key whose
+	// hash is below it is hot.
+	threshold uint64
+	width     uint32
+}
+
+// newHotKeys returns nil if fraction is 0.
+func newHotKeys(fraction float64, width int) *hotKeys {
+	if fraction == 0 {
+		return nil
+	}
+	return &hotKeys{threshold: uint64(fraction * (1 << 32)), width: uint32(width)}
+}
+
+// route returns the hot key the key is stored under, or the key if it is not
+// hot.
+func (h *hotKeys) route(key string) string {
+	sum := crc32.ChecksumIEEE(util.Slice(key))
+	if uint64(sum) >= h.threshold {
+		return key
+	}
+	atomic.AddInt64(&h.hits, 1)
+	return hotKeyPrefix + strconv.FormatUint(uint64(sum%h.width), 10)
+}
+
+// addHotHits adds the "hot_key" stats of the codecs to m, the hot keys are
+// counted by the codec, so the drivers sharing a codec, like the clones, count
+// the hits of each other.
+func addHotHits(m map[string]int64, codecs ...*codec) {
+	for _, c := range codecs {
+		if c.hot != nil {
+			m["hot_key"] += atomic.LoadInt64(&c.hot.hits)
+		}
+	}
+}
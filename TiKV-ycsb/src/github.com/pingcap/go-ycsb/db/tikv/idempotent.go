@@ -0,0 +1,145 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// properties
+const (
+	// tikvRawIdempotentWrites ends every row with the token of its write, so a
+	// retried raw put which finds its token already stored is not applied
+	// again. It is a layout property, the rows of a table must all have a
+	// token or none.
+	tikvRawIdempotentWrites = "tikv.raw.idempotentWrites"
+)
+
+// tokenSize is the size of the token ending a row, the ID of the client and
+// the sequence of the write.
+const tokenSize = 16
+
+// maxWriteRetries bounds the retries of a failed raw put with
+// tikvRawIdempotentWrites.
+const maxWriteRetries = 2
+
+// errWriteConflict fails a retried write whose row was written by another
+// write since it was read.
+var errWriteConflict = errors.New("the row was written by another write while the write was retried")
+
+// tokenSource generates the tokens of the writes of a client.
+type tokenSource struct {
+	// seq is the sequence of the last write, it is accessed atomically.
+	seq    uint64
+	client uint64
+}
+
+func newTokenSource() *tokenSource {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		binary.BigEndian.PutUint64(b[:], uint64(time.Now().UnixNano()))
+	}
+	return &tokenSource{client: binary.BigEndian.Uint64(b[:])}
+}
+
+// appendToken appends the token of a new write to the row.
+func (t *tokenSource) appendToken(row []byte) []byte {
+	var b [tokenSize]byte
+	binary.BigEndian.PutUint64(b[:8], t.client)
+	binary.BigEndian.PutUint64(b[8:], atomic.AddUint64(&t.seq, 1))
+	return append(row, b[:]...)
+}
+
+// stripToken returns the row without its token, a missing row stays nil.
+func (c *codec) stripToken(row []byte) ([]byte, error) {
+	if c.tokens == nil || len(row) == 0 {
+		return row, nil
+	}
+	if len(row) < tokenSize {
+		return nil, fmt.Errorf("row of %d bytes has no token of %s", len(row), tikvRawIdempotentWrites)
+	}
+	return row[:len(row)-tokenSize], nil
+}
+
+// rowToken returns the token ending the row, nil if the row is missing or too
+// short for a token.
+func rowToken(row []byte) []byte {
+	if len(row) < tokenSize {
+		return nil
+	}
+	return row[len(row)-tokenSize:]
+}
+
+// writeBase is the row a write replaces, as far as the writer knows it.
+type writeBase struct {
+	// known is whether the row was read before the write, like in an update,
+	// the blind writes like inserts do not know it.
+	known bool
+	// token is the token of the row, nil if the row did not exist.
+	token []byte
+}
+
+// rowValues returns the row without its token like stripToken, but a row too
+// short for a token is returned whole.
+func (c *codec) rowValues(row []byte) []byte {
+	if values, err := c.stripToken(row); err == nil {
+		return values
+	}
+	return row
+}
+
+// retryPut retries the put of an encoded row which failed with err. The put
+// may have been applied before failing, so every retry first reads the row,
+// and the retry is skipped if the row already ends with the token of rowData.
+// If the write knows the row it replaces, the retry fails with
+// errWriteConflict when the row holds the token of another write instead, so
+// it does not put back a row built from an older one, and a row it can not
+// read is not put blindly.
+func (db *rawDB) retryPut(op *profileOp, rowKey []byte, rowData []byte, base writeBase, err error) error {
+	token := rowToken(rowData)
+	for i := 0; i < maxWriteRetries; i++ {
+		op.rpcBegin()
+		stored, getErr := db.db.Get(rowKey)
+		op.rpcEnd()
+		if getErr == nil && bytes.HasSuffix(stored, token) {
+			db.stats.add("write_retry_skipped", 1)
+			return nil
+		}
+		if base.known {
+			if getErr != nil {
+				err = getErr
+				continue
+			}
+			if !bytes.Equal(rowToken(stored), base.token) {
+				db.stats.add("write_retry_conflict", 1)
+				return errWriteConflict
+			}
+		}
+
+		db.stats.add("write_retry", 1)
+		op.rpcBegin()
+		err = db.db.Put(rowKey, rowData)
+		op.rpcEnd()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
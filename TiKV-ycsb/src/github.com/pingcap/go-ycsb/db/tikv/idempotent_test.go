@@ -0,0 +1,189 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// The outcomes of a put of flakyRaw.
+const (
+	putOK = iota
+	// putLost fails the put before it is applied.
+	putLost
+	// putTimeout applies the put, but fails it like a timed out request.
+	putTimeout
+	// putTimeoutOverwritten is putTimeout, but the row of another writer is
+	// put before the put fails.
+	putTimeoutOverwritten
+	// putLostOverwritten is putLost, but the row of another writer is put
+	// before the put fails.
+	putLostOverwritten
+)
+
+// flakyRaw is a memRaw whose puts have the outcomes of puts in turn, then
+// succeed. other is the row of the other writer.
+type flakyRaw struct {
+	*memRaw
+	puts  []int
+	other []byte
+}
+
+func (f *flakyRaw) Put(key, value []byte) error {
+	outcome := putOK
+	if len(f.puts) > 0 {
+		outcome, f.puts = f.puts[0], f.puts[1:]
+	}
+	switch outcome {
+	case putLost:
+		return errors.New("put lost")
+	case putTimeout:
+		if err := f.memRaw.Put(key, value); err != nil {
+			return err
+		}
+		return errors.New("put timed out")
+	case putTimeoutOverwritten, putLostOverwritten:
+		if outcome == putTimeoutOverwritten {
+			if err := f.memRaw.Put(key, value); err != nil {
+				return err
+			}
+		}
+		if err := f.memRaw.Put(key, f.other); err != nil {
+			return err
+		}
+		return errors.New("put timed out")
+	}
+	return f.memRaw.Put(key, value)
+}
+
+func TestIdempotentWrites(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		idempotent bool
+		puts       []int
+		// err is whether the insert fails, retries and skipped the counts of
+		// "write_retry" and "write_retry_skipped".
+		err              bool
+		retries, skipped int64
+	}{
+		{true, nil, false, 0, 0},
+		// The first put was applied, it is not applied twice.
+		{true, []int{putTimeout}, false, 0, 1},
+		{true, []int{putLost}, false, 1, 0},
+		{true, []int{putLost, putTimeout}, false, 1, 1},
+		{true, []int{putLost, putLost, putLost}, true, 2, 0},
+		// Without tokens a put is not retried.
+		{false, []int{putLost}, true, 0, 0},
+		{false, []int{putTimeout}, true, 0, 0},
+	}
+	for _, tt := range tests {
+		var kvs []string
+		if tt.idempotent {
+			kvs = []string{tikvRawIdempotentWrites, "true"}
+		}
+		db, m := newTestRawDB(t, kvs...)
+		if err := db.Insert(ctx, "usertable", "user1", map[string][]byte{"field0": []byte("old")}); err != nil {
+			t.Fatal(err)
+		}
+		old := m.pairs["usertable:user1"]
+
+		db.db = &flakyRaw{memRaw: m, puts: tt.puts}
+		gets := m.gets
+		err := db.Insert(ctx, "usertable", "user1", map[string][]byte{"field0": []byte("new")})
+		if (err != nil) != tt.err {
+			t.Errorf("%v %v: Insert: err %v, want an error %v", tt.idempotent, tt.puts, err, tt.err)
+		}
+		stats := db.Stats()
+		if stats["write_retry"] != tt.retries || stats["write_retry_skipped"] != tt.skipped {
+			t.Errorf("%v %v: %d retries and %d skipped, want %d and %d",
+				tt.idempotent, tt.puts, stats["write_retry"], stats["write_retry_skipped"], tt.retries, tt.skipped)
+		}
+		// Every retry reads the row first.
+		if n := int64(m.gets - gets); n != tt.retries+tt.skipped {
+			t.Errorf("%v %v: %d gets, want %d", tt.idempotent, tt.puts, n, tt.retries+tt.skipped)
+		}
+		if tt.err {
+			continue
+		}
+
+		row, err := db.Read(ctx, "usertable", "user1", nil)
+		if err != nil || string(row["field0"]) != "new" {
+			t.Errorf("%v %v: read %q, %v, want the new row", tt.idempotent, tt.puts, row, err)
+		}
+		// The rows end with the different tokens of the writes.
+		stored := m.pairs["usertable:user1"]
+		if len(stored) < tokenSize || bytes.Equal(stored[len(stored)-tokenSize:], old[len(old)-tokenSize:]) {
+			t.Errorf("%v %v: the row %q has no new token", tt.idempotent, tt.puts, stored)
+		}
+	}
+}
+
+// TestIdempotentWritesOverwritten runs another writer between a failed put
+// and its retry. An update knows the row it replaced, so its retry does not
+// put back a row built from it over the newer one, a blind insert can not
+// tell the newer row from the one it replaced and puts its row again.
+func TestIdempotentWritesOverwritten(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		update bool
+		put    int
+		// err is whether the write fails, and want the field0 of the row
+		// stored after it.
+		err  bool
+		want string
+	}{
+		{true, putTimeoutOverwritten, true, "other"},
+		{true, putLostOverwritten, true, "other"},
+		{false, putTimeoutOverwritten, false, "new"},
+		{false, putLostOverwritten, false, "new"},
+	}
+	for _, tt := range tests {
+		db, m := newTestRawDB(t, tikvRawIdempotentWrites, "true")
+		if err := db.Insert(ctx, "usertable", "user1", map[string][]byte{"field0": []byte("old")}); err != nil {
+			t.Fatal(err)
+		}
+		// The other writer is another client, with tokens of its own.
+		other, _ := newTestRawDB(t, tikvRawIdempotentWrites, "true")
+		otherRow, err := other.codec.encodeRow(nil, map[string][]byte{"field0": []byte("other")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.db = &flakyRaw{memRaw: m, puts: []int{tt.put}, other: otherRow}
+		values := map[string][]byte{"field0": []byte("new")}
+		if tt.update {
+			err = db.Update(ctx, "usertable", "user1", values)
+		} else {
+			err = db.Insert(ctx, "usertable", "user1", values)
+		}
+		if (err != nil) != tt.err {
+			t.Errorf("update %v, put %d: err %v, want an error %v", tt.update, tt.put, err, tt.err)
+		}
+		var wantConflicts int64
+		if tt.err {
+			wantConflicts = 1
+		}
+		if conflicts := db.Stats()["write_retry_conflict"]; conflicts != wantConflicts {
+			t.Errorf("update %v, put %d: %d write_retry_conflict, want %d", tt.update, tt.put, conflicts, wantConflicts)
+		}
+
+		row, err := db.Read(ctx, "usertable", "user1", nil)
+		if err != nil || string(row["field0"]) != tt.want {
+			t.Errorf("update %v, put %d: read %q, %v, want field0 %q", tt.update, tt.put, row, err, tt.want)
+		}
+	}
+}
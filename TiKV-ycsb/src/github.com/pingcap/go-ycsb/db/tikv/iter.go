@@ -0,0 +1,154 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/pingcap/tidb/store/tikv"
+)
+
+// rawScanBatchSize is the number of pairs fetched by one raw scan request.
+const rawScanBatchSize = 1024
+
+// maxScanResumes bounds the resumes of a page, a region which stays
+// unavailable fails the scan.
+const maxScanResumes = 3
+
+// rawIterator pages through the raw pairs in [start, end), a nil end means no
+// upper bound. It is not safe for concurrent use.
+type rawIterator struct {
+	ctx   context.Context
+	scan  scanFunc
+	end   []byte
+	batch int
+	// deadline stops the scan before its next page, zero never stops it.
+	deadline  time.Time
+	truncated bool
+
+	// next is the start key of the next page, nil if there is no more page.
+	next   []byte
+	keys   [][]byte
+	values [][]byte
+	pos    int
+
+	key   []byte
+	value []byte
+	err   error
+
+	// resumes counts the resumes of the current page.
+	resumes int
+	// stats counts the resumes as "scan_resume", nil counts nothing.
+	stats *stats
+}
+
+func newRawIterator(ctx context.Context, scan scanFunc, start []byte, end []byte) *rawIterator {
+	return &rawIterator{
+		ctx:   ctx,
+		scan:  scan,
+		end:   end,
+		batch: rawScanBatchSize,
+		next:  start,
+	}
+}
+
+// newIterator is newRawIterator on the client of the driver, counting the
+// resumes in its Stats.
+func (db *rawDB) newIterator(ctx context.Context, start []byte, end []byte) *rawIterator {
+	it := newRawIterator(ctx, db.db.Scan, start, end)
+	it.stats = db.stats
+	return it
+}
+
+// Next moves to the next pair, it returns false when the range is exhausted
+// or an error occurs.
+func (it *rawIterator) Next() bool {
+	for it.pos >= len(it.keys) {
+		if it.next == nil || it.err != nil {
+			return false
+		}
+
+		select {
+		case <-it.ctx.Done():
+			it.err = it.ctx.Err()
+			return false
+		default:
+		}
+
+		if !it.deadline.IsZero() && !time.Now().Before(it.deadline) {
+			it.truncated = true
+			if it.stats != nil {
+				it.stats.add("scan_truncated", 1)
+			}
+			return false
+		}
+
+		keys, values, err := it.scan(it.next, it.batch)
+		if err != nil && tikv.ErrRegionUnavailable.Equal(err) && it.resumes < maxScanResumes {
+			// A split or a merge moved the region, the client gave up
+			// backing off and dropped it from its region cache, so the page
+			// is scanned again after the last key returned.
+			it.resumes++
+			if it.stats != nil {
+				it.stats.add("scan_resume", 1)
+			}
+			continue
+		} else if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.keys, it.values, it.pos, it.resumes = keys, values, 0, 0
+		if len(keys) < it.batch {
+			it.next = nil
+		} else {
+			// Append a '\0' to skip the last key.
+			last := keys[len(keys)-1]
+			it.next = append(append(make([]byte, 0, len(last)+1), last...), 0)
+		}
+	}
+
+	key := it.keys[it.pos]
+	if it.end != nil && bytes.Compare(key, it.end) >= 0 {
+		it.keys, it.next = nil, nil
+		return false
+	}
+
+	it.key, it.value = key, it.values[it.pos]
+	it.pos++
+	return true
+}
+
+// Key returns the key of the current pair.
+func (it *rawIterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the value of the current pair.
+func (it *rawIterator) Value() []byte {
+	return it.value
+}
+
+// Truncated returns whether the deadline stopped the iteration before the end
+// of the range.
+func (it *rawIterator) Truncated() bool {
+	return it.truncated
+}
+
+// Err returns the error which stopped the iteration.
+func (it *rawIterator) Err() error {
+	return it.err
+}
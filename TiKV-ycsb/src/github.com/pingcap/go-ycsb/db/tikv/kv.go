@@ -0,0 +1,62 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import "context"
+
+// kvTable is the table of the rows of KV.
+const kvTable = "kv"
+
+// KV is a plain key value store over the raw driver for embedding in programs
+// which do not speak the YCSB API. A key is stored as the row of the key in
+// table "kv", with the value in field0, so it follows the key layout of the
+// configuration, like the keyspace prefix. It is safe for concurrent use.
+type KV struct {
+	db *rawDB
+}
+
+// NewKV connects to the cluster of cfg.
+func NewKV(cfg Config) (*KV, error) {
+	db, err := NewRawDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &KV{db: db.(*rawDB)}, nil
+}
+
+// Get returns the value of the key, nil if the key does not exist.
+func (k *KV) Get(key []byte) ([]byte, error) {
+	fields := k.db.tableCodec(kvTable).fields[:1]
+	row, err := k.db.Read(context.Background(), kvTable, string(key), fields)
+	if err != nil {
+		return nil, err
+	}
+	return row[fields[0]], nil
+}
+
+// Set sets the value of the key. The row only has field0, whatever
+// tikvRawMissingFields is.
+func (k *KV) Set(key []byte, value []byte) (err error) {
+	defer wrapRawError(&err, "insert", kvTable, string(key))
+
+	field := k.db.tableCodec(kvTable).fields[0]
+	op := k.db.profile.begin("insert")
+	defer op.end()
+	return k.db.insert(context.Background(), &op, kvTable, string(key), map[string][]byte{field: value}, writeBase{})
+}
+
+// Close closes the connections.
+func (k *KV) Close() error {
+	return k.db.Close()
+}
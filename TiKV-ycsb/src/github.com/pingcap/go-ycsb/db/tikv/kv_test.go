@@ -0,0 +1,55 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestKV(t *testing.T) {
+	tests := []struct {
+		kvs []string
+		// stored is the stored key of "key1".
+		stored string
+	}{
+		{nil, "kv:key1"},
+		{[]string{tikvRawKeyspacePrefix, "run1/"}, "run1/kv:key1"},
+		// Set writes only field0, whatever the policy.
+		{[]string{"fieldcount", "3", tikvRawMissingFields, "error"}, "kv:key1"},
+	}
+	for _, tt := range tests {
+		db, m := newTestRawDB(t, tt.kvs...)
+		k := &KV{db: db}
+
+		if v, err := k.Get([]byte("key1")); err != nil || v != nil {
+			t.Errorf("%v: Get of a missing key = %q, %v, want nil", tt.kvs, v, err)
+		}
+		for _, value := range [][]byte{[]byte("v1"), []byte("v2"), {}, []byte("\x00\xff")} {
+			if err := k.Set([]byte("key1"), value); err != nil {
+				t.Fatalf("%v: Set(%q): %v", tt.kvs, value, err)
+			}
+			if v, err := k.Get([]byte("key1")); err != nil || !bytes.Equal(v, value) || v == nil {
+				t.Errorf("%v: Get after Set(%q) = %q, %v", tt.kvs, value, v, err)
+			}
+		}
+		if keys := m.keys(); !reflect.DeepEqual(keys, []string{tt.stored}) {
+			t.Errorf("%v: stored the keys %q, want %q", tt.kvs, keys, tt.stored)
+		}
+		if err := k.Close(); err != nil || m.closes != 1 {
+			t.Errorf("%v: Close = %v closed the client %d times", tt.kvs, err, m.closes)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+)
+
+// Logger receives the messages of the drivers, like the warnings about the
+// features the vendored clients do not support. It must be safe for
+// concurrent use.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// stdoutLogger prints the messages to the standard output, like the rest of
+// go-ycsb.
+type stdoutLogger struct{}
+
+func (stdoutLogger) Infof(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func (stdoutLogger) Warnf(format string, args ...interface{}) {
+	fmt.Printf("WARNING: "+format+"\n", args...)
+}
+
+// defaultLogger is the logger when none is configured.
+var defaultLogger Logger = stdoutLogger{}
+
+// WithLogger returns the configuration with the driver messages sent to l, a
+// nil l prints them to the standard output.
+func (cfg Config) WithLogger(l Logger) Config {
+	cfg.Logger = l
+	return cfg
+}
+
+// logger returns the logger of the configuration, defaultLogger if it is nil.
+func (cfg Config) logger() Logger {
+	if cfg.Logger == nil {
+		return defaultLogger
+	}
+	return cfg.Logger
+}
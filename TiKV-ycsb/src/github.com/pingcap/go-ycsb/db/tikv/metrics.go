@@ -0,0 +1,151 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// clientHistograms are the latency histograms of the vendored clients exported
+// by RegisterMetrics, by the value of their "client" label.
+var clientHistograms = map[string]string{
+	"tikv": tikvRequestMetric,
+	"pd":   pdCmdMetric,
+}
+
+// metricsCollector exports the Stats of a driver and the latency histograms of
+// the vendored clients. The stats are read on every scrape, so the collector
+// keeps no state of its own.
+type metricsCollector struct {
+	stats func() map[string]int64
+	stat  *prometheus.Desc
+	// statUs are the latencies of Stats, a family only has one metric type.
+	statUs  *prometheus.Desc
+	latency *prometheus.Desc
+}
+
+func newMetricsCollector(driver string, stats func() map[string]int64) *metricsCollector {
+	labels := prometheus.Labels{"driver": driver}
+	return &metricsCollector{
+		stats: stats,
+		stat: prometheus.NewDesc("go_ycsb_tikv_stat",
+			"The counters of the Stats of the TiKV driver, by name.",
+			[]string{"name"}, labels),
+		statUs: prometheus.NewDesc("go_ycsb_tikv_stat_us",
+			"The latencies of the Stats of the TiKV driver in microseconds, by name.",
+			[]string{"name"}, labels),
+		latency: prometheus.NewDesc("go_ycsb_tikv_request_seconds",
+			"Bucketed histogram of the requests sent by the TiKV and PD clients, by type.",
+			[]string{"client", "type"}, labels),
+	}
+}
+
+func (c *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.stat
+	ch <- c.statUs
+	ch <- c.latency
+}
+
+func (c *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, v := range c.stats() {
+		// The latencies derived from the histograms go up and down.
+		if strings.HasSuffix(name, "_us") {
+			ch <- prometheus.MustNewConstMetric(c.statUs, prometheus.GaugeValue, float64(v), name)
+		} else {
+			ch <- prometheus.MustNewConstMetric(c.stat, prometheus.CounterValue, float64(v), name)
+		}
+	}
+
+	for client, metric := range clientHistograms {
+		// The histograms are best effort, like the latencies of Stats.
+		samples, err := gatherHistograms(metric)
+		if err != nil {
+			continue
+		}
+		for reqType, sample := range samples {
+			buckets := make(map[float64]uint64, len(sample.bounds))
+			for i, bound := range sample.bounds {
+				buckets[bound] = sample.buckets[i]
+			}
+			ch <- prometheus.MustNewConstHistogram(c.latency, sample.count, sample.sum, buckets, client, reqType)
+		}
+	}
+}
+
+// RegisterMetrics registers on reg the counters of Stats as "go_ycsb_tikv_stat",
+// the latencies of Stats ending with "_us" as "go_ycsb_tikv_stat_us" and the
+// latency histograms of the client requests, summed over the stores, as
+// "go_ycsb_tikv_request_seconds", all labeled with driver="raw".
+func (db *rawDB) RegisterMetrics(reg prometheus.Registerer) error {
+	return reg.Register(newMetricsCollector("raw", db.Stats))
+}
+
+// RegisterMetrics is rawDB.RegisterMetrics labeled with driver="txn".
+func (db *txnDB) RegisterMetrics(reg prometheus.Registerer) error {
+	return reg.Register(newMetricsCollector("txn", db.Stats))
+}
+
+// RegisterMetrics is rawDB.RegisterMetrics labeled with driver="mixed", the
+// counters are named like in Stats, like "raw.read_cache_hit".
+func (db *mixedDB) RegisterMetrics(reg prometheus.Registerer) error {
+	return reg.Register(newMetricsCollector("mixed", db.Stats))
+}
+
+// statsMetric is the metric of the entries of StatsJSON, like the "DB - ..."
+// line go-ycsb prints with the measurement.
+const statsMetric = "DB"
+
+// statsEntry is an entry of the JSON array report of YCSB.
+type statsEntry struct {
+	Metric      string `json:"metric"`
+	Measurement string `json:"measurement"`
+	Value       int64  `json:"value"`
+}
+
+// statsJSON returns the stats as the entries of the YCSB JSON array report,
+// sorted by name.
+func statsJSON(stats map[string]int64) ([]byte, error) {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]statsEntry, len(names))
+	for i, name := range names {
+		entries[i] = statsEntry{Metric: statsMetric, Measurement: name, Value: stats[name]}
+	}
+	return json.Marshal(entries)
+}
+
+// StatsJSON returns Stats in the JSON array report format of YCSB, one
+// {"metric": "DB", "measurement": name, "value": v} entry for every counter,
+// so the counters of the driver can be merged with the other measurements.
+func (db *rawDB) StatsJSON() ([]byte, error) {
+	return statsJSON(db.Stats())
+}
+
+// StatsJSON is rawDB.StatsJSON.
+func (db *txnDB) StatsJSON() ([]byte, error) {
+	return statsJSON(db.Stats())
+}
+
+// StatsJSON is rawDB.StatsJSON, with the names of Stats like "raw.retry".
+func (db *mixedDB) StatsJSON() ([]byte, error) {
+	return statsJSON(db.Stats())
+}
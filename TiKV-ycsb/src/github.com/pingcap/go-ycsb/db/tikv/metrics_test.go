@@ -0,0 +1,145 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/tidb/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherFamilies returns the metric families of reg by name.
+func gatherFamilies(t *testing.T, reg *prometheus.Registry) map[string]*dto.MetricFamily {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		m[family.GetName()] = family
+	}
+	return m
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	ctx := context.Background()
+	raw, _ := newTestRawDB(t, tikvRawReadCacheSize, "16", tikvRawReadCacheTTL, "1h")
+	txn, _ := newTestTxnDB(t)
+	mixed := &mixedDB{raw: raw, txn: txn, routes: map[string]string{}, stats: newStats()}
+
+	// The requests of two stores are summed by type.
+	metrics.TiKVSendReqHistogram.WithLabelValues("TestRawGet", "1").Observe(0.001)
+	metrics.TiKVSendReqHistogram.WithLabelValues("TestRawGet", "2").Observe(0.003)
+
+	if err := raw.Insert(ctx, "usertable", "user1", map[string][]byte{"field0": []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := raw.Read(ctx, "usertable", "user1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw.stats.add("latency_us", 7)
+
+	tests := []struct {
+		driver string
+		db     interface {
+			RegisterMetrics(reg prometheus.Registerer) error
+			Stats() map[string]int64
+		}
+	}{{"raw", raw}, {"txn", txn}, {"mixed", mixed}}
+	for _, tt := range tests {
+		reg := prometheus.NewRegistry()
+		if err := tt.db.RegisterMetrics(reg); err != nil {
+			t.Fatalf("%s: %v", tt.driver, err)
+		}
+		if err := tt.db.RegisterMetrics(reg); err == nil {
+			t.Errorf("%s: registered the metrics twice", tt.driver)
+		}
+		families := gatherFamilies(t, reg)
+
+		stats := tt.db.Stats()
+		got := make(map[string]int64)
+		for _, family := range []string{"go_ycsb_tikv_stat", "go_ycsb_tikv_stat_us"} {
+			for _, m := range families[family].GetMetric() {
+				if driver := labelValue(m.GetLabel(), "driver"); driver != tt.driver {
+					t.Errorf("%s: %s labeled with driver %q", tt.driver, family, driver)
+				}
+				name := labelValue(m.GetLabel(), "name")
+				if gauge := strings.HasSuffix(name, "_us"); gauge != (m.GetGauge() != nil) || gauge != (family == "go_ycsb_tikv_stat_us") {
+					t.Errorf("%s: %s is in %s as %v", tt.driver, name, family, m)
+				}
+				got[name] = int64(m.GetCounter().GetValue() + m.GetGauge().GetValue())
+			}
+		}
+		if len(got) != len(stats) {
+			t.Errorf("%s: scraped %v, want %v", tt.driver, got, stats)
+		}
+		for name, v := range stats {
+			if got[name] != v {
+				t.Errorf("%s: scraped %s = %d, want %d", tt.driver, name, got[name], v)
+			}
+		}
+
+		var found bool
+		for _, m := range families["go_ycsb_tikv_request_seconds"].GetMetric() {
+			if labelValue(m.GetLabel(), "type") != "TestRawGet" {
+				continue
+			}
+			found = true
+			h := m.GetHistogram()
+			if client := labelValue(m.GetLabel(), "client"); client != "tikv" || h.GetSampleCount() != 2 || h.GetSampleSum() != 0.004 {
+				t.Errorf("%s: scraped the %s histogram of %d requests in %vs, want the tikv one of 2 in 0.004s",
+					tt.driver, client, h.GetSampleCount(), h.GetSampleSum())
+			}
+		}
+		if !found {
+			t.Errorf("%s: no request histogram of type TestRawGet", tt.driver)
+		}
+	}
+
+}
+
+func TestStatsJSON(t *testing.T) {
+	tests := []struct {
+		stats map[string]int64
+		want  string
+	}{
+		{nil, `[]`},
+		{map[string]int64{"retry": 3}, `[{"metric":"DB","measurement":"retry","value":3}]`},
+		{map[string]int64{"txn.tso.p99_us": 120, "raw.read_cache_hit": 0, "raw.hot_key": -1},
+			`[{"metric":"DB","measurement":"raw.hot_key","value":-1},` +
+				`{"metric":"DB","measurement":"raw.read_cache_hit","value":0},` +
+				`{"metric":"DB","measurement":"txn.tso.p99_us","value":120}]`},
+	}
+	for _, tt := range tests {
+		got, err := statsJSON(tt.stats)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("statsJSON(%v) = %s, %v, want %s", tt.stats, got, err, tt.want)
+		}
+	}
+
+	// The drivers report their Stats.
+	raw, _ := newTestRawDB(t)
+	raw.stats.add("scan_leader", 2)
+	got, err := raw.StatsJSON()
+	if want := `[{"metric":"DB","measurement":"scan_leader","value":2}]`; err != nil || string(got) != want {
+		t.Errorf("StatsJSON = %s, %v, want %s", got, err, want)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/go-ycsb/pkg/ycsb"
+)
+
+// properties
+const (
+	// tikvOpRouting maps the operations to "raw" or "txn" in "mixed" type, like
+	// "reads:raw,writes:txn". An operation is one of read, scan, update, insert
+	// and delete, "reads" stands for read and scan, "writes" for the others.
+	tikvOpRouting = "tikv.opRouting"
+)
+
+var (
+	readOps  = []string{"read", "scan"}
+	writeOps = []string{"update", "insert", "delete"}
+)
+
+// mixedDB sends every operation to the raw or the txn driver according to
+// tikvOpRouting. Both drivers are created from the same properties so they
+// encode the rows the same way, and each one reads what the other writes.
+type mixedDB struct {
+	raw *rawDB
+	txn *txnDB
+
+	// routes maps the operation to "raw" or "txn".
+	routes map[string]string
+	stats  *stats
+}
+
+func parseOpRouting(s string) (map[string]string, error) {
+	routes := make(map[string]string, len(readOps)+len(writeOps))
+	for _, op := range append(readOps, writeOps...) {
+		routes[op] = "raw"
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		seps := strings.SplitN(item, ":", 2)
+		if len(seps) != 2 {
+			return nil, fmt.Errorf("invalid %s item %q, must be op:type", tikvOpRouting, item)
+		}
+
+		op, tp := strings.TrimSpace(seps[0]), strings.TrimSpace(seps[1])
+		if tp != "raw" && tp != "txn" {
+			return nil, fmt.Errorf("invalid %s type %q, must be raw or txn", tikvOpRouting, tp)
+		}
+
+		var ops []string
+		switch op {
+		case "reads":
+			ops = readOps
+		case "writes":
+			ops = writeOps
+		default:
+			if _, ok := routes[op]; !ok {
+				return nil, fmt.Errorf("invalid %s operation %q", tikvOpRouting, op)
+			}
+			ops = []string{op}
+		}
+
+		for _, op := range ops {
+			routes[op] = tp
+		}
+	}
+	return routes, nil
+}
+
+func createMixedDB(p *properties.Properties) (ycsb.DB, error) {
+	routes, err := parseOpRouting(p.GetString(tikvOpRouting, "reads:raw,writes:txn"))
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := createRawDB(p)
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := createTxnDB(p)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	return &mixedDB{
+		raw:    raw.(*rawDB),
+		txn:    txn.(*txnDB),
+		routes: routes,
+		stats:  newStats()}, nil
+}
+
+// route returns the driver of the operation and counts the operation.
+func (db *mixedDB) route(op string) ycsb.DB {
+	tp := db.routes[op]
+	db.stats.add(op+"."+tp, 1)
+	if tp == "txn" {
+		return db.txn
+	}
+	return db.raw
+}
+
+// Stats returns the count of the operations sent to each driver, like
+// "read.raw", and the stats of the drivers prefixed with "raw." and "txn.".
+func (db *mixedDB) Stats() map[string]int64 {
+	m := db.stats.snapshot()
+	for name, v := range db.raw.Stats() {
+		m["raw."+name] = v
+	}
+	for name, v := range db.txn.Stats() {
+		m["txn."+name] = v
+	}
+	return m
+}
+
+// ReleaseScan gives the result of a Scan back to the thread, the drivers share
+// the state of the thread, so it does not matter which one scanned.
+func (db *mixedDB) ReleaseScan(ctx context.Context, rows []map[string][]byte) {
+	db.raw.ReleaseScan(ctx, rows)
+}
+
+func (db *mixedDB) Close() error {
+	err := db.raw.Close()
+	if txnErr := db.txn.Close(); err == nil {
+		err = txnErr
+	}
+	return err
+}
+
+func (db *mixedDB) InitThread(ctx context.Context, threadID int, threadCount int) context.Context {
+	ctx = db.raw.InitThread(ctx, threadID, threadCount)
+	return db.txn.InitThread(ctx, threadID, threadCount)
+}
+
+func (db *mixedDB) CleanupThread(ctx context.Context) {
+	db.txn.CleanupThread(ctx)
+	db.raw.CleanupThread(ctx)
+}
+
+func (db *mixedDB) Read(ctx context.Context, table string, key string, fields []string) (map[string][]byte, error) {
+	return db.route("read").Read(ctx, table, key, fields)
+}
+
+// Exists is routed like Read.
+func (db *mixedDB) Exists(ctx context.Context, table string, key string) (bool, error) {
+	if txn, ok := db.route("read").(*txnDB); ok {
+		return txn.Exists(ctx, table, key)
+	}
+	return db.raw.Exists(ctx, table, key)
+}
+
+func (db *mixedDB) Scan(ctx context.Context, table string, startKey string, count int, fields []string) ([]map[string][]byte, error) {
+	return db.route("scan").Scan(ctx, table, startKey, count, fields)
+}
+
+func (db *mixedDB) Update(ctx context.Context, table string, key string, values map[string][]byte) error {
+	return db.route("update").Update(ctx, table, key, values)
+}
+
+// UpdateReturning is routed like Update.
+func (db *mixedDB) UpdateReturning(ctx context.Context, table string, key string, values map[string][]byte) (map[string][]byte, error) {
+	if txn, ok := db.route("update").(*txnDB); ok {
+		return txn.UpdateReturning(ctx, table, key, values)
+	}
+	return db.raw.UpdateReturning(ctx, table, key, values)
+}
+
+func (db *mixedDB) Insert(ctx context.Context, table string, key string, values map[string][]byte) error {
+	return db.route("insert").Insert(ctx, table, key, values)
+}
+
+func (db *mixedDB) Delete(ctx context.Context, table string, key string) error {
+	return db.route("delete").Delete(ctx, table, key)
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReadOptions are the options of a single raw read, the zero value reads all
+// the fields like Read.
+type ReadOptions struct {
+	// Fields are the fields to read, nil reads them all.
+	Fields []string
+	// Priority is "low", "normal" or "high", "" uses tikvRawPriority.
+	Priority string
+	// ReplicaRead is "leader", "follower" or "mixed", "" uses
+	// tikvRawReplicaRead.
+	ReplicaRead string
+	// Staleness is the staleness allowed for the read, 0 uses
+	// tikvRawStaleRead.
+	Staleness time.Duration
+}
+
+// WriteOptions are the options of a single raw write, the zero value writes
+// like Insert and Update.
+type WriteOptions struct {
+	// Priority is "low", "normal" or "high", "" is normal.
+	Priority string
+	// TTL is the time the row lives, 0 keeps it forever.
+	TTL time.Duration
+}
+
+// ReadWith is Read with the options of the read. It reads the latest value from
+// the leader at normal priority, the other options are counted as
+// "priority_fallback", "replica_read_fallback" and "stale_read_fallback" in
+// Stats.
+func (db *rawDB) ReadWith(ctx context.Context, table string, key string, opts ReadOptions) (_ map[string][]byte, err error) {
+	defer wrapRawError(&err, "read", table, key)
+
+	if err := db.checkReadOptions(opts); err != nil {
+		return nil, err
+	}
+
+	c := db.tableCodec(table)
+	rowKey, err := c.getRowKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+
+	staleRead := opts.Staleness
+	if staleRead == 0 {
+		staleRead = db.staleRead
+	}
+
+	row, op, err := db.readRow(ctx, rowKey, staleRead)
+	defer op.end()
+	if err != nil || row == nil {
+		return nil, err
+	}
+
+	return c.decodeRow(ctx, row, opts.Fields)
+}
+
+func (db *rawDB) checkReadOptions(opts ReadOptions) error {
+	if err := db.checkPriority(opts.Priority); err != nil {
+		return err
+	}
+
+	switch opts.ReplicaRead {
+	case "", "leader":
+	case "follower", "mixed":
+		db.stats.add("replica_read_fallback", 1)
+	default:
+		return fmt.Errorf("unsupported replica read %q, must be leader, follower or mixed", opts.ReplicaRead)
+	}
+
+	if opts.Staleness < 0 {
+		return fmt.Errorf("staleness must not be negative, got %s", opts.Staleness)
+	}
+	return nil
+}
+
+// checkWriteOptions fails a write with a TTL, a row kept forever would
+// silently change what the caller measures.
+func (db *rawDB) checkWriteOptions(opts WriteOptions) error {
+	if err := db.checkPriority(opts.Priority); err != nil {
+		return err
+	}
+
+	if opts.TTL < 0 {
+		return fmt.Errorf("TTL must not be negative, got %s", opts.TTL)
+	} else if opts.TTL > 0 {
+		return fmt.Errorf("TTL %s is set, but this TiKV client can not write a TTL", opts.TTL)
+	}
+	return nil
+}
+
+func (db *rawDB) checkPriority(priority string) error {
+	switch priority {
+	case "", "normal":
+	case "low", "high":
+		db.stats.add("priority_fallback", 1)
+	default:
+		return fmt.Errorf("unsupported priority %q, must be low, normal or high", priority)
+	}
+	return nil
+}
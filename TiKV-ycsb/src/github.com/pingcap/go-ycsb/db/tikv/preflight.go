@@ -0,0 +1,73 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/go-ycsb/pkg/prop"
+)
+
+// heavyProportion is the proportion of an operation from which a workload is
+// heavy on it.
+const heavyProportion = 0.5
+
+// preflightCheck returns the warnings about a layout which does not suit the
+// operation mix of the workload. They are advice, the driver runs anyway. The
+// layout is the one of the workload table, with its overrides.
+func preflightCheck(p *properties.Properties, cfg Config) []string {
+	layout := cfg.LayoutConfig
+	if t, ok := cfg.Tables[p.GetString(prop.TableName, prop.TableNameDefault)]; ok {
+		layout = t
+	}
+
+	scan := p.GetFloat64(prop.ScanProportion, prop.ScanProportionDefault)
+	rmw := p.GetFloat64(prop.ReadModifyWriteProportion, prop.ReadModifyWriteProportionDefault)
+
+	var warnings []string
+	warnf := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if scan > 0 && layout.ReverseKey {
+		warnf("%s is %v, but %s stores the keys reversed, so a scan does not return the next keys, disable %s for a workload with scans",
+			prop.ScanProportion, scan, tikvRawReverseKey, tikvRawReverseKey)
+	}
+	if scan >= heavyProportion && layout.SaltBuckets > 0 {
+		warnf("%s is %v, but every scan reads and merges the %d buckets of %s, disable salting for a scan heavy workload",
+			prop.ScanProportion, scan, layout.SaltBuckets, tikvRawSaltBuckets)
+	}
+	if rmw > 0 {
+		warnf("%s is %v, but raw KV has no CAS, so a read-modify-write is a read and an update racing with the other threads, set %s to txn to make it atomic",
+			prop.ReadModifyWriteProportion, rmw, tikvType)
+	}
+	if layout.RowKeyCacheSize > 0 && p.GetString(prop.RequestDistribution, prop.RequestDistributionDefault) == "uniform" {
+		warnf("%s only pays off for skewed workloads, but %s is uniform, set it to 0",
+			tikvRawRowKeyCacheSize, prop.RequestDistribution)
+	}
+	if p.GetString(prop.InsertOrder, prop.InsertOrderDefault) == "ordered" && layout.SaltBuckets == 0 && !layout.ReverseKey && layout.HotFraction == 0 {
+		warnf("%s is ordered, so every insert goes to the last region, spread them with %s or %s",
+			prop.InsertOrder, tikvRawSaltBuckets, tikvRawReverseKey)
+	}
+	if layout.TiDBCompat && p.GetString(tikvType, "raw") == "raw" {
+		warnf("%s is set, but TiDB only reads the rows written by transactions, set %s to txn to read the rows with SQL",
+			tikvRawTiDBCompat, tikvType)
+	}
+	if layout.HotFraction > 0 {
+		warnf("%s is %v, the workload deliberately creates a hotspot, only use it for stress testing",
+			tikvRawHotFraction, layout.HotFraction)
+	}
+	return warnings
+}
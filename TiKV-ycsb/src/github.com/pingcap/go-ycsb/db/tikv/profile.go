@@ -0,0 +1,120 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// profiler times a fraction rate of the operations, splitting the time between the
+// client RPCs and the rest, which is mostly encoding and decoding the rows.
+// Timing only a sample keeps the clock reads off most of the operations.
+type profiler struct {
+	rate float64
+	// n counts the operations, it is accessed atomically.
+	n     uint64
+	stats *stats
+
+	mu sync.Mutex
+	// names are the stat names of the operations by operation name, so the
+	// sampled operations do not build them each time.
+	names map[string]*profileNames
+}
+
+// profileNames are the "profile.<name>.*" stat names of an operation.
+type profileNames struct {
+	samples string
+	rpc     string
+	codec   string
+}
+
+// newProfiler returns nil if rate is 0, so nothing is sampled.
+func newProfiler(rate float64, stats *stats) *profiler {
+	if rate == 0 {
+		return nil
+	}
+	return &profiler{rate: rate, stats: stats, names: make(map[string]*profileNames)}
+}
+
+func (p *profiler) statNames(name string) *profileNames {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names, ok := p.names[name]
+	if !ok {
+		prefix := "profile." + name
+		names = &profileNames{
+			samples: prefix + ".samples",
+			rpc:     prefix + ".rpc_ns",
+			codec:   prefix + ".codec_ns",
+		}
+		p.names[name] = names
+	}
+	return names
+}
+
+// sample picks the operations where n*rate reaches the next integer, so
+// exactly floor(n*rate) of the first n operations are picked, for any rate.
+func (p *profiler) sample() bool {
+	n := atomic.AddUint64(&p.n, 1)
+	return uint64(float64(n)*p.rate) != uint64(float64(n-1)*p.rate)
+}
+
+// profileOp is an operation being timed, the zero profileOp is not sampled
+// and all its methods do nothing.
+type profileOp struct {
+	p        *profiler
+	name     string
+	start    time.Time
+	rpcStart time.Time
+	rpc      time.Duration
+}
+
+// begin starts timing the operation if it is sampled.
+func (p *profiler) begin(name string) profileOp {
+	if p == nil || !p.sample() {
+		return profileOp{}
+	}
+	return profileOp{p: p, name: name, start: time.Now()}
+}
+
+func (op *profileOp) sampled() bool {
+	return op.p != nil
+}
+
+func (op *profileOp) rpcBegin() {
+	if op.p != nil {
+		op.rpcStart = time.Now()
+	}
+}
+
+func (op *profileOp) rpcEnd() {
+	if op.p != nil {
+		op.rpc += time.Since(op.rpcStart)
+	}
+}
+
+// end adds the sampled operation to the "profile.<name>.*" stats.
+func (op *profileOp) end() {
+	if op.p == nil {
+		return
+	}
+
+	total := time.Since(op.start)
+	names := op.p.statNames(op.name)
+	op.p.stats.add(names.samples, 1)
+	op.p.stats.add(names.rpc, int64(op.rpc))
+	op.p.stats.add(names.codec, int64(total-op.rpc))
+}
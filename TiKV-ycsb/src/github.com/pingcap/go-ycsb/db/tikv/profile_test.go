@@ -0,0 +1,73 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProfilerRate(t *testing.T) {
+	tests := []struct {
+		rate float64
+		n    int
+		want int
+	}{
+		{1, 1000, 1000},
+		{0.5, 1000, 500},
+		{0.4, 1000, 400},
+		{0.3, 1000, 300},
+		{0.25, 1000, 250},
+		{0.001, 10000, 10},
+		{0.0004, 10000, 4},
+	}
+	for _, tt := range tests {
+		p := newProfiler(tt.rate, newStats())
+		sampled := 0
+		for i := 0; i < tt.n; i++ {
+			if op := p.begin("read"); op.sampled() {
+				sampled++
+			}
+		}
+		if sampled != tt.want {
+			t.Errorf("rate %v sampled %d of %d operations, want %d", tt.rate, sampled, tt.n, tt.want)
+		}
+	}
+
+	if op := newProfiler(0, newStats()).begin("read"); op.sampled() {
+		t.Error("a profiler of rate 0 sampled an operation")
+	}
+}
+
+// BenchmarkProfileSample measures the overhead of the sampling on a raw
+// insert and read, without sampling, at the 1% rate and timing every
+// operation.
+func BenchmarkProfileSample(b *testing.B) {
+	ctx := context.Background()
+	values := benchValues(10, 100)
+	for _, rate := range []string{"0", "0.01", "1"} {
+		b.Run("rate="+rate, func(b *testing.B) {
+			db, _ := newTestRawDB(b, tikvRawProfileSample, rate)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := db.Insert(ctx, "usertable", "user1", values); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := db.Read(ctx, "usertable", "user1", nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
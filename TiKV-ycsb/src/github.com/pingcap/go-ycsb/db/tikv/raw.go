@@ -15,168 +15,894 @@ package tikv
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/magiconair/properties"
-	"github.com/pingcap/go-ycsb/pkg/util"
+	"github.com/pingcap/go-ycsb/pkg/prop"
 	"github.com/pingcap/go-ycsb/pkg/ycsb"
 	"github.com/pingcap/tidb/config"
-	"github.com/pingcap/tidb/mysql"
-	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/tikv"
-	"github.com/pingcap/tidb/tablecodec"
-	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/kvcache"
+)
+
+// properties
+const (
+	// tikvRawReplicaRead is "leader", "follower" or "mixed", the other modes
+	// fall back to the leader.
+	tikvRawReplicaRead = "tikv.raw.replicaRead"
+	// tikvRawStaleRead is the staleness allowed for Read and Scan, like "5s",
+	// the reads stay fresh.
+	tikvRawStaleRead = "tikv.raw.staleRead"
+	// tikvRawScanConsistency is "leader", "follower" or "stale" for the scans,
+	// "" follows tikvRawReplicaRead and tikvRawStaleRead like Read, the
+	// other modes fall back to the leader.
+	tikvRawScanConsistency = "tikv.raw.scanConsistency"
+	// tikvRawReadYourWrites makes Read return the rows written by the same
+	// thread from a per-thread cache of tikvRawReadYourWritesSize rows.
+	tikvRawReadYourWrites     = "tikv.raw.readYourWrites"
+	tikvRawReadYourWritesSize = "tikv.raw.readYourWritesSize"
+	// tikvRawReadCacheSize is the number of rows kept by the read cache shared
+	// by all the threads, 0 disables it. The rows expire after
+	// tikvRawReadCacheTTL.
+	tikvRawReadCacheSize = "tikv.raw.readCacheSize"
+	tikvRawReadCacheTTL  = "tikv.raw.readCacheTTL"
+	// tikvRawTargetStore pins the reads to the store with the ID, setting it
+	// fails the creation.
+	tikvRawTargetStore = "tikv.raw.targetStore"
+	// tikvRawConnAffinity pins every thread to one connection of the pool, set
+	// by InitThread, setting it fails the creation.
+	tikvRawConnAffinity = "tikv.raw.connAffinity"
+	// tikvRawWriteAck is the number of replicas acknowledging a write before
+	// it returns, "default", "leader", "majority" or "all". TiKV acknowledges
+	// the writes once their raft log is committed, so only "default" can be
+	// set.
+	tikvRawWriteAck = "tikv.raw.writeAck"
+	// tikvRawPriority is the priority of Read and Scan, "low", "normal" or
+	// "high", the reads stay at normal priority.
+	tikvRawPriority = "tikv.raw.priority"
+	// tikvRawFollowerFallback is the number of times a Read that timed out on
+	// the leader is retried on a follower, only 0 is supported.
+	tikvRawFollowerFallback = "tikv.raw.followerFallback"
+	// tikvRawReadRepairSample is the fraction of the follower reads read again
+	// from the leader to check the follower, only 0 is supported.
+	tikvRawReadRepairSample = "tikv.raw.readRepairSample"
+	// tikvRawMaxScanDuration bounds the time of a ScanTable pass, 0 does not
+	// bound it.
+	tikvRawMaxScanDuration = "tikv.raw.maxScanDuration"
+	// tikvRawProfileSample is the fraction of the operations whose time is
+	// split between the client RPCs and the row codec in Stats, 0 disables it.
+	tikvRawProfileSample = "tikv.raw.profileSample"
+	// tikvRawDebugHTTP is the address of the debugging HTTP endpoints of
+	// ServeHTTP, "" disables them and an address without host, like ":8080",
+	// listens on localhost only.
+	tikvRawDebugHTTP = "tikv.raw.debugHTTP"
 )
 
 type rawDB struct {
-	db           *tikv.RawKVClient
-	fieldIndices map[string]int64
-	fields       []string
-	bufPool      *util.BufPool
+	*codec
+	// tables are the codecs of the tables with a layout override.
+	tables map[string]*codec
+	db     rawKV
+	// client counts the clones sharing db.
+	client *rawClient
+	// closed is set by Close, it is accessed atomically.
+	closed int32
+	// staleRead is 0 if the reads do not ask for staleness.
+	staleRead time.Duration
+	// scanConsistency is the resolved tikvRawScanConsistency.
+	scanConsistency string
+	// writesSize is 0 if tikvRawReadYourWrites is disabled.
+	writesSize int64
+	// readCache is nil if tikvRawReadCacheSize is 0.
+	readCache *readCache
+	// profile is nil if tikvRawProfileSample is 0.
+	profile *profiler
+	stats   *stats
+	// cfg is the configuration with the resolved connection count.
+	cfg Config
+	// debugServer is nil if tikvRawDebugHTTP is not set, the clones have none.
+	debugServer *http.Server
+	// streams are the running StreamInserts, stopped by Close.
+	streams streamSet
+}
+
+// RawError is returned by the operations of the raw driver, it wraps the error
+// of the client with the operation, like "read", and the table and the key of
+// the operation, the start key for a scan.
+type RawError struct {
+	Op    string
+	Table string
+	Key   string
+	Err   error
+}
+
+func (e *RawError) Error() string {
+	return fmt.Sprintf("raw %s of key %q in table %s: %v", e.Op, e.Key, e.Table, e.Err)
+}
+
+// Unwrap returns the error of the client.
+func (e *RawError) Unwrap() error {
+	return e.Err
+}
+
+// wrapRawError wraps *err in a *RawError of the operation, unless it is nil.
+func wrapRawError(err *error, op string, table string, key string) {
+	if *err != nil {
+		*err = &RawError{Op: op, Table: table, Key: key, Err: *err}
+	}
+}
+
+// Config is the configuration of the raw driver, for creating it with NewRawDB
+// without properties. Every field is the property of the same name, like
+// StaleRead for tikv.raw.staleRead, and DefaultConfig returns their defaults.
+type Config struct {
+	LayoutConfig
+	// Tables overrides the layout of the named tables, from the
+	// tikv.raw.table.<name>.<property> properties.
+	Tables map[string]LayoutConfig
+
+	// PD are the PD endpoints.
+	PD       []string
+	Security config.Security
+	// MaxConnCount is tikv.maxConnCount, 0 derives it from GOMAXPROCS and
+	// ThreadCount.
+	MaxConnCount int
+	ThreadCount  int
+
+	ReplicaRead        string
+	StaleRead          time.Duration
+	ScanConsistency    string
+	ReadYourWrites     bool
+	ReadYourWritesSize int64
+	ReadCacheSize      int64
+	ReadCacheTTL       time.Duration
+	TargetStore        string
+	ConnAffinity       bool
+	WriteAck           string
+	Priority           string
+	FollowerFallback   int
+	ReadRepairSample   float64
+	MaxScanDuration    time.Duration
+	FlushInterval      time.Duration
+	ProfileSample      float64
+	DebugHTTP          string
+	SyntheticSeed      int64
+	DetectDuplicates   string
+	SizeSamplePages    int
+
+	// Logger receives the messages of the driver, nil prints them to the
+	// standard output.
+	Logger Logger
+}
+
+// DefaultConfig returns the defaults of the raw driver properties.
+func DefaultConfig() Config {
+	return Config{
+		LayoutConfig:       DefaultLayoutConfig(),
+		PD:                 []string{"172.31.42.111:2379"},
+		ThreadCount:        int(prop.ThreadCountDefault),
+		ReplicaRead:        "leader",
+		ReadYourWritesSize: 10000,
+		ReadCacheTTL:       time.Second,
+		Priority:           "normal",
+		WriteAck:           "default",
+		SizeSamplePages:    64,
+	}
+}
+
+// String prints the configuration for debugging. The security is printed as
+// its mode and whether each file is set, never the paths of the files.
+func (cfg Config) String() string {
+	security := "plaintext"
+	if cfg.Security.ClusterSSLCA != "" {
+		security = "tls"
+	}
+
+	connCount := strconv.Itoa(cfg.MaxConnCount)
+	if cfg.MaxConnCount == 0 {
+		connCount = "derived"
+	}
+
+	return fmt.Sprintf("pd=%s maxConnCount=%s security=%s (ca %s, cert %s, key %s) "+
+		"fieldCount=%d saltBuckets=%d reverseKey=%v keyspacePrefix=%q keyDecode=%s "+
+		"replicaRead=%s staleRead=%s scanConsistency=%s priority=%s readYourWrites=%v readCacheSize=%d readCacheTTL=%s",
+		strings.Join(cfg.PD, ","), connCount, security,
+		isSet(cfg.Security.ClusterSSLCA), isSet(cfg.Security.ClusterSSLCert), isSet(cfg.Security.ClusterSSLKey),
+		cfg.FieldCount, cfg.SaltBuckets, cfg.ReverseKey, cfg.KeyspacePrefix, cfg.KeyDecode,
+		cfg.ReplicaRead, cfg.StaleRead, cfg.scanConsistency(), cfg.Priority, cfg.ReadYourWrites, cfg.ReadCacheSize, cfg.ReadCacheTTL)
+}
+
+func isSet(s string) string {
+	if s == "" {
+		return "unset"
+	}
+	return "set"
+}
+
+// rawConfig parses the properties of the raw driver, NewRawDB validates them.
+// The parse errors are returned as one configError.
+func rawConfig(p *properties.Properties) (Config, error) {
+	cfg := DefaultConfig()
+	cfg.LayoutConfig = layoutConfig(p)
+	cfg.PD = strings.Split(p.GetString(tikvPD, strings.Join(cfg.PD, ",")), ",")
+	cfg.MaxConnCount = p.GetInt(tikvMaxConnCount, cfg.MaxConnCount)
+	cfg.ThreadCount = p.GetInt(prop.ThreadCount, cfg.ThreadCount)
+	cfg.ReplicaRead = p.GetString(tikvRawReplicaRead, cfg.ReplicaRead)
+	cfg.ScanConsistency = p.GetString(tikvRawScanConsistency, cfg.ScanConsistency)
+	cfg.ReadYourWrites = p.GetBool(tikvRawReadYourWrites, cfg.ReadYourWrites)
+	cfg.ReadYourWritesSize = p.GetInt64(tikvRawReadYourWritesSize, cfg.ReadYourWritesSize)
+	cfg.ReadCacheSize = p.GetInt64(tikvRawReadCacheSize, cfg.ReadCacheSize)
+	cfg.TargetStore = p.GetString(tikvRawTargetStore, cfg.TargetStore)
+	cfg.ConnAffinity = p.GetBool(tikvRawConnAffinity, cfg.ConnAffinity)
+	cfg.WriteAck = p.GetString(tikvRawWriteAck, cfg.WriteAck)
+	cfg.Priority = p.GetString(tikvRawPriority, cfg.Priority)
+	cfg.FollowerFallback = p.GetInt(tikvRawFollowerFallback, cfg.FollowerFallback)
+	cfg.ReadRepairSample = p.GetFloat64(tikvRawReadRepairSample, cfg.ReadRepairSample)
+	cfg.ProfileSample = p.GetFloat64(tikvRawProfileSample, cfg.ProfileSample)
+	cfg.DebugHTTP = p.GetString(tikvRawDebugHTTP, cfg.DebugHTTP)
+	cfg.SyntheticSeed = p.GetInt64(tikvRawSyntheticSeed, cfg.SyntheticSeed)
+	cfg.DetectDuplicates = p.GetString(tikvRawDetectDuplicates, cfg.DetectDuplicates)
+	cfg.SizeSamplePages = p.GetInt(tikvRawSizeSamplePages, cfg.SizeSamplePages)
+
+	var (
+		errs configError
+		err  error
+	)
+	cfg.Tables = tableLayouts(p, &errs)
+	if cfg.StaleRead, err = time.ParseDuration(p.GetString(tikvRawStaleRead, "0")); err != nil {
+		errs.addf("invalid %s: %v", tikvRawStaleRead, err)
+	}
+	if cfg.ReadCacheTTL, err = time.ParseDuration(p.GetString(tikvRawReadCacheTTL, "1s")); err != nil {
+		errs.addf("invalid %s: %v", tikvRawReadCacheTTL, err)
+	}
+	if cfg.MaxScanDuration, err = time.ParseDuration(p.GetString(tikvRawMaxScanDuration, "0")); err != nil {
+		errs.addf("invalid %s: %v", tikvRawMaxScanDuration, err)
+	}
+	if cfg.FlushInterval, err = time.ParseDuration(p.GetString(tikvRawFlushInterval, "0")); err != nil {
+		errs.addf("invalid %s: %v", tikvRawFlushInterval, err)
+	}
+	return cfg, errs.err()
 }
 
 func createRawDB(p *properties.Properties) (ycsb.DB, error) {
-	pdAddr := p.GetString(tikvPD, "172.31.42.111:2379")
-	tikv.MaxConnectionCount = 128
-	db, err := tikv.NewRawKVClient(strings.Split(pdAddr, ","), config.Security{})
+	if err := Validate(p); err != nil {
+		return nil, err
+	}
+
+	cfg, err := rawConfig(p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range preflightCheck(p, cfg) {
+		cfg.logger().Warnf("%s", w)
+	}
+	return NewRawDB(cfg)
+}
+
+// NewRawDB validates the configuration and creates a raw driver connected to
+// the PD endpoints.
+func NewRawDB(cfg Config) (ycsb.DB, error) {
+	var errs configError
+	if cfg.validate(&errs); len(errs) > 0 {
+		return nil, errs
+	}
+
+	r, err := newRawDB(cfg, connectRaw)
 	if err != nil {
 		return nil, err
 	}
 
-	fieldIndices := createFieldIndices(p)
-	fields := allFields(p)
-	bufPool := util.NewBufPool()
+	if cfg.DebugHTTP != "" {
+		lis, err := listenDebug(cfg.DebugHTTP)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.debugServer = &http.Server{Handler: r.debugHandler()}
+		go r.debugServer.Serve(lis)
+		cfg.logger().Infof("serving the debugging HTTP endpoints on %s", lis.Addr())
+	}
+	return r, nil
+}
+
+// rawKV is the raw client, a *tikv.RawKVClient.
+type rawKV interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	Scan(startKey []byte, limit int) ([][]byte, [][]byte, error)
+	Close() error
+}
 
+// connectRaw connects a raw client to the PD endpoints.
+func connectRaw(cfg Config) (rawKV, error) {
+	db, err := tikv.NewRawKVClient(cfg.PD, cfg.Security)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// newRawDB creates a raw driver of the validated configuration with the client
+// of connect.
+func newRawDB(cfg Config, connect func(cfg Config) (rawKV, error)) (*rawDB, error) {
+	c, err := newLayoutCodec(cfg.LayoutConfig)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := newTableCodecs(cfg.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	log := cfg.logger()
+
+	if cfg.ReplicaRead != "leader" {
+		log.Warnf("%s %q is not supported by this TiKV client, reading from the leader", tikvRawReplicaRead, cfg.ReplicaRead)
+	}
+	if cfg.StaleRead > 0 {
+		log.Warnf("%s is not supported by this TiKV client, reading the latest values", tikvRawStaleRead)
+	}
+	if cfg.Priority != "normal" {
+		log.Warnf("%s %q is not supported by this TiKV client, reading at normal priority", tikvRawPriority, cfg.Priority)
+	}
+	if scan := cfg.scanConsistency(); scan != "leader" {
+		log.Warnf("%s %q is not supported by this TiKV client, scanning the leader", tikvRawScanConsistency, scan)
+	}
+
+	var writesSize int64
+	if cfg.ReadYourWrites {
+		writesSize = cfg.ReadYourWritesSize
+	}
+
+	var cache *readCache
+	if cfg.ReadCacheSize > 0 {
+		cache = newReadCache(cfg.ReadCacheSize, cfg.ReadCacheTTL)
+	}
+
+	connCount, err := resolveConnCount(cfg.MaxConnCount, cfg.ThreadCount, log)
+	if err != nil {
+		return nil, err
+	}
+	tikv.MaxConnectionCount = connCount
+	cfg.MaxConnCount = connCount
+	db, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := newStats()
+	return &rawDB{
+		codec:           c,
+		tables:          tables,
+		db:              db,
+		staleRead:       cfg.StaleRead,
+		scanConsistency: cfg.scanConsistency(),
+		writesSize:      writesSize,
+		readCache:       cache,
+		profile:         newProfiler(cfg.ProfileSample, stats),
+		stats:           stats,
+		client:          &rawClient{c: db, refs: 1},
+		cfg:             cfg}, nil
+}
+
+// rawClient is a raw client shared by a driver and its clones, the last one to
+// close closes it.
+type rawClient struct {
+	c rawKV
+	// refs is accessed atomically.
+	refs int32
+}
+
+func (rc *rawClient) acquire() {
+	atomic.AddInt32(&rc.refs, 1)
+}
+
+func (rc *rawClient) release() error {
+	if atomic.AddInt32(&rc.refs, -1) == 0 {
+		return rc.c.Close()
+	}
+	return nil
+}
+
+// Clone returns another raw driver with the same configuration, for sharded
+// benchmarks in one process. It shares the connections and the read cache of
+// the driver, but has its own Stats, and its threads need their own
+// InitThread. The connections are closed once the driver and all its clones
+// are closed.
+func (db *rawDB) Clone() (ycsb.DB, error) {
+	if atomic.LoadInt32(&db.closed) != 0 {
+		return nil, fmt.Errorf("can not clone a closed raw driver")
+	}
+
+	db.client.acquire()
+	stats := newStats()
 	return &rawDB{
-		db:           db,
-		fieldIndices: fieldIndices,
-		fields:       fields,
-		bufPool:      bufPool}, nil
+		codec:           db.codec,
+		tables:          db.tables,
+		db:              db.db,
+		client:          db.client,
+		staleRead:       db.staleRead,
+		scanConsistency: db.scanConsistency,
+		writesSize:      db.writesSize,
+		readCache:       db.readCache,
+		profile:         newProfiler(db.cfg.ProfileSample, stats),
+		stats:           stats,
+		cfg:             db.cfg}, nil
+}
+
+// Config returns the configuration of the driver, with the connection count it
+// resolved.
+func (db *rawDB) Config() Config {
+	return db.cfg
+}
+
+// Stats returns the raw counters, "stale_read_fallback" is the number of reads
+// which asked for a stale read and were served with the latest values, and
+// "read_your_writes_hit" the number of reads served from the thread writes.
+// "scan_leader" counts the scans, which are all served by the leader, and
+// "scan_consistency_fallback" the ones which asked tikvRawScanConsistency for
+// a follower or a stale scan. "scan_resume" counts the pages of the table
+// scans scanned again after their region moved, and "scan_truncated" the
+// ScanTable passes stopped by tikvRawMaxScanDuration.
+// With the read cache it also has "read_cache_hit" and "read_cache_miss". With
+// tikvRawProfileSample every sampled operation adds to "profile.<op>.samples",
+// and its nanoseconds spent in the client RPCs and elsewhere to
+// "profile.<op>.rpc_ns" and "profile.<op>.codec_ns". With tikvRawHotFraction
+// "hot_key" counts the keys routed to a hot key, by the driver and its clones.
+// With tikvRawIdempotentWrites "write_retry" counts the retried puts, and
+// "write_retry_skipped" the ones skipped as their first put was applied.
+// With tikvRawDetectDuplicates "duplicate_key" counts the existing rows found
+// by the loads.
+func (db *rawDB) Stats() map[string]int64 {
+	m := db.stats.snapshot()
+	addHotHits(m, db.codec)
+	for _, c := range db.tables {
+		addHotHits(m, c)
+	}
+	return m
+}
+
+// countRead counts a read in the stats.
+func (db *rawDB) countRead() {
+	if db.staleRead > 0 {
+		db.stats.add("stale_read_fallback", 1)
+	}
 }
 
+// scanConsistency returns ScanConsistency, or the consistency of Read if it
+// is "".
+func (cfg Config) scanConsistency() string {
+	switch {
+	case cfg.ScanConsistency != "":
+		return cfg.ScanConsistency
+	case cfg.StaleRead > 0:
+		return "stale"
+	case cfg.ReplicaRead != "leader":
+		return "follower"
+	default:
+		return "leader"
+	}
+}
+
+// countScan counts a scan, which is always served by the leader, in the stats.
+func (db *rawDB) countScan() {
+	db.countScanAs(db.scanConsistency)
+}
+
+// countScanAs counts a scan asked for the consistency.
+func (db *rawDB) countScanAs(consistency string) {
+	db.stats.add("scan_leader", 1)
+	if consistency != "leader" {
+		db.stats.add("scan_consistency_fallback", 1)
+	}
+	if consistency == "stale" {
+		db.stats.add("stale_read_fallback", 1)
+	}
+}
+
+// Close releases the connections, which are closed by the last of the driver
+// and its clones. Closing twice does nothing.
 func (db *rawDB) Close() error {
-	return db.db.Close()
+	if !atomic.CompareAndSwapInt32(&db.closed, 0, 1) {
+		return nil
+	}
+	db.streams.stop(true)
+	if db.debugServer != nil {
+		db.debugServer.Close()
+	}
+	return db.client.release()
 }
 
 func (db *rawDB) InitThread(ctx context.Context, _ int, _ int) context.Context {
+	ctx = withThreadState(ctx)
+	if state := threadStateOf(ctx); db.writesSize > 0 && state.writes == nil {
+		state.writes = kvcache.NewSimpleLRUCache(db.writesSize)
+	}
 	return ctx
 }
 
+// threadWrites returns the writes of the thread, nil if they are not kept.
+func (db *rawDB) threadWrites(ctx context.Context) *kvcache.SimpleLRUCache {
+	if state := threadStateOf(ctx); state != nil {
+		return state.writes
+	}
+	return nil
+}
+
+// keepWrite keeps the row written by the thread, a nil row for a delete, and
+// invalidates the row in the read cache.
+func (db *rawDB) keepWrite(ctx context.Context, rowKey []byte, row []byte) {
+	if db.readCache != nil {
+		db.readCache.invalidate(rowKey)
+	}
+
+	if writes := db.threadWrites(ctx); writes != nil {
+		// The row may be a pooled buffer, keep a copy.
+		if row != nil {
+			row = append([]byte(nil), row...)
+		}
+		key := rowKeyCacheKey(rowKey)
+		if v, ok := writes.Get(key); ok {
+			v.(*keptRow).row = row
+		} else {
+			writes.Put(key, &keptRow{row: row})
+		}
+	}
+}
+
 func (db *rawDB) CleanupThread(ctx context.Context) {
+	cleanupThreadState(ctx)
 }
 
-func (db *rawDB) getRowKey(table string, key string) []byte {
-	return util.Slice(fmt.Sprintf("%s:%s", table, key))
+func (db *rawDB) Read(ctx context.Context, table string, key string, fields []string) (map[string][]byte, error) {
+	return db.ReadWith(ctx, table, key, ReadOptions{Fields: fields})
 }
 
-func (db *rawDB) decodeRow(ctx context.Context, row []byte, fields []string) (map[string][]byte, error) {
-	if len(fields) == 0 {
-		fields = db.fields
+// readRow returns the encoded row from the thread writes, the read cache or
+// the cluster, nil if the row does not exist. A read from the cluster asking
+// for staleRead may be sampled, the caller ends op once the row is decoded.
+func (db *rawDB) readRow(ctx context.Context, rowKey []byte, staleRead time.Duration) ([]byte, profileOp, error) {
+	if writes := db.threadWrites(ctx); writes != nil {
+		if v, ok := writes.Get(rowKeyCacheKey(rowKey)); ok {
+			db.stats.add("read_your_writes_hit", 1)
+			return v.(*keptRow).row, profileOp{}, nil
+		}
 	}
 
-	cols := make(map[int64]*types.FieldType, len(fields))
-	fieldType := types.NewFieldType(mysql.TypeVarchar)
+	if db.readCache != nil {
+		if row, ok := db.readCache.get(rowKey); ok {
+			db.stats.add("read_cache_hit", 1)
+			return row, profileOp{}, nil
+		}
+		db.stats.add("read_cache_miss", 1)
+	}
 
-	for _, field := range fields {
-		i := db.fieldIndices[field]
-		cols[i] = fieldType
+	op := db.profile.begin("read")
+	if staleRead > 0 {
+		db.stats.add("stale_read_fallback", 1)
+	}
+	op.rpcBegin()
+	row, err := db.get(rowKey)
+	op.rpcEnd()
+	if err != nil || row == nil {
+		return nil, op, err
 	}
 
-	data, err := tablecodec.DecodeRow(row, cols, nil)
-	if err != nil {
-		return nil, err
+	if db.readCache != nil {
+		db.readCache.put(rowKey, row)
 	}
+	return row, op, nil
+}
 
-	res := make(map[string][]byte, len(fields))
-	for _, field := range fields {
-		i := db.fieldIndices[field]
-		if v, ok := data[i]; ok {
-			res[field] = v.GetBytes()
-		}
+// Exists returns whether the row exists, like Read but without decoding it.
+func (db *rawDB) Exists(ctx context.Context, table string, key string) (_ bool, err error) {
+	defer wrapRawError(&err, "read", table, key)
+
+	rowKey, err := db.tableCodec(table).getRowKey(table, key)
+	if err != nil {
+		return false, err
 	}
 
-	return res, nil
+	row, op, err := db.readRow(ctx, rowKey, db.staleRead)
+	op.end()
+	return row != nil, err
 }
 
-func (db *rawDB) Read(ctx context.Context, table string, key string, fields []string) (map[string][]byte, error) {
-	row, err := db.db.Get(db.getRowKey(table, key))
+// RowMeta describes how a row is stored.
+type RowMeta struct {
+	// Size is the length of the encoded row in bytes.
+	Size int
+	// SchemaVersion is the version of the row format. None of the
+	// tikvRawEncoding formats carries a version, so it is always 0.
+	SchemaVersion int64
+	// Compression is the codec compressing the row. The rows are never
+	// compressed, so it is always "none".
+	Compression string
+	// TTL is the time left before the row expires, 0 if it never does. It is
+	// always 0.
+	TTL time.Duration
+}
+
+// GetWithMeta reads all the fields of the row like Read, and describes how the
+// row is stored, with no other request. It returns nil fields and a zero
+// RowMeta if the row does not exist.
+func (db *rawDB) GetWithMeta(ctx context.Context, table string, key string) (_ map[string][]byte, _ RowMeta, err error) {
+	defer wrapRawError(&err, "read", table, key)
+
+	c := db.tableCodec(table)
+	rowKey, err := c.getRowKey(table, key)
 	if err != nil {
-		return nil, err
-	} else if row == nil {
-		return nil, nil
+		return nil, RowMeta{}, err
 	}
 
-	return db.decodeRow(ctx, row, fields)
+	row, op, err := db.readRow(ctx, rowKey, db.staleRead)
+	defer op.end()
+	if err != nil || row == nil {
+		return nil, RowMeta{}, err
+	}
+
+	fields, err := c.decodeRow(ctx, row, nil)
+	if err != nil {
+		return nil, RowMeta{}, err
+	}
+	return fields, RowMeta{Size: len(row), Compression: "none"}, nil
 }
 
-func (db *rawDB) Scan(ctx context.Context, table string, startKey string, count int, fields []string) ([]map[string][]byte, error) {
-	_, rows, err := db.db.Scan(db.getRowKey(table, startKey), count)
+// ReadRaw returns the encoded row without decoding it, nil if the row does not
+// exist. It skips the caches, the returned slice is owned by the caller.
+func (db *rawDB) ReadRaw(ctx context.Context, table string, key string) (_ []byte, err error) {
+	defer wrapRawError(&err, "read", table, key)
+
+	rowKey, err := db.tableCodec(table).getRowKey(table, key)
 	if err != nil {
 		return nil, err
 	}
 
-	res := make([]map[string][]byte, len(rows))
-	for i, row := range rows {
-		if row == nil {
-			res[i] = nil
-			continue
-		}
+	db.countRead()
+	return db.get(rowKey)
+}
 
-		v, err := db.decodeRow(ctx, row, fields)
-		if err != nil {
-			return nil, err
-		}
-		res[i] = v
-	}
+func (db *rawDB) Scan(ctx context.Context, table string, startKey string, count int, fields []string) (_ []map[string][]byte, err error) {
+	defer wrapRawError(&err, "scan", table, startKey)
 
-	return res, nil
+	op := db.profile.begin("scan")
+	defer op.end()
+
+	db.countScan()
+	return db.tableCodec(table).scanRows(ctx, table, startKey, count, fields, db.scanFunc(&op))
+}
+
+// scanFunc returns the raw scan, timing its RPCs if op is sampled.
+func (db *rawDB) scanFunc(op *profileOp) scanFunc {
+	if !op.sampled() {
+		return db.db.Scan
+	}
+	return func(start []byte, limit int) ([][]byte, [][]byte, error) {
+		op.rpcBegin()
+		defer op.rpcEnd()
+		return db.db.Scan(start, limit)
+	}
 }
 
 func (db *rawDB) Update(ctx context.Context, table string, key string, values map[string][]byte) error {
-	row, err := db.db.Get(db.getRowKey(table, key))
+	return db.UpdateWith(ctx, table, key, values, WriteOptions{})
+}
+
+// UpdateWith is Update with the options of the write.
+func (db *rawDB) UpdateWith(ctx context.Context, table string, key string, values map[string][]byte, opts WriteOptions) error {
+	_, err := db.update(ctx, table, key, values, opts, false)
+	return err
+}
+
+// UpdateReturning is Update returning the fields of the row before the update,
+// nil if the row did not exist. They are decoded from the read of the update,
+// so it sends no other request.
+func (db *rawDB) UpdateReturning(ctx context.Context, table string, key string, values map[string][]byte) (map[string][]byte, error) {
+	return db.update(ctx, table, key, values, WriteOptions{}, true)
+}
+
+// update reads the row, merges the values into it and writes it back. With
+// returnPrevious it returns the row as it was read.
+func (db *rawDB) update(ctx context.Context, table string, key string, values map[string][]byte, opts WriteOptions, returnPrevious bool) (previous map[string][]byte, err error) {
+	defer wrapRawError(&err, "update", table, key)
+
+	if err := db.checkWriteOptions(opts); err != nil {
+		return nil, err
+	}
+
+	op := db.profile.begin("update")
+	defer op.end()
+
+	c := db.tableCodec(table)
+	rowKey, err := c.getRowKey(table, key)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	data, err := db.decodeRow(ctx, row, nil)
+	op.rpcBegin()
+	row, err := db.db.Get(rowKey)
+	op.rpcEnd()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	data, err := c.decodeRow(ctx, row, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if returnPrevious && row != nil {
+		previous = copyRow(data)
+	}
 	for field, value := range values {
 		data[field] = value
 	}
 
-	// Update data and use Insert to overwrite.
-	return db.Insert(ctx, table, key, data)
+	// Update data and overwrite it under the same key.
+	return previous, db.insert(ctx, &op, table, key, data, writeBase{known: true, token: rowToken(row)})
+}
+
+// copyRow returns a copy of the map of the row, the values are shared.
+func copyRow(row map[string][]byte) map[string][]byte {
+	m := make(map[string][]byte, len(row))
+	for field, value := range row {
+		m[field] = value
+	}
+	return m
 }
 
 func (db *rawDB) Insert(ctx context.Context, table string, key string, values map[string][]byte) error {
+	return db.InsertWith(ctx, table, key, values, WriteOptions{})
+}
+
+// InsertWith is Insert with the options of the write.
+func (db *rawDB) InsertWith(ctx context.Context, table string, key string, values map[string][]byte, opts WriteOptions) (err error) {
+	defer wrapRawError(&err, "insert", table, key)
+
+	if err := db.checkWriteOptions(opts); err != nil {
+		return err
+	}
+
+	c := db.tableCodec(table)
+	values, err = c.insertValues(values)
+	if err != nil {
+		return err
+	}
+
+	op := db.profile.begin("insert")
+	defer op.end()
+
+	return db.insert(ctx, &op, table, c.insertKey(key, values), values, writeBase{})
+}
+
+// insert encodes and puts the row replacing base, the put is timed in op.
+func (db *rawDB) insert(ctx context.Context, op *profileOp, table string, key string, values map[string][]byte, base writeBase) error {
 	// Simulate TiDB data
-	buf := db.bufPool.Get()
-	defer db.bufPool.Put(buf)
+	c := db.tableCodec(table)
+	buf := c.bufPool.Get()
+	defer c.bufPool.Put(buf)
 
-	cols := make([]types.Datum, 0, len(values))
-	colIDs := make([]int64, 0, len(values))
+	rowData, err := c.encodeRowBuf(buf, values)
+	if err != nil {
+		return err
+	}
 
-	for k, v := range values {
-		i := db.fieldIndices[k]
-		var d types.Datum
-		d.SetBytes(v)
+	rowKey, err := c.getRowKey(table, key)
+	if err != nil {
+		return err
+	}
+	return db.put(ctx, op, rowKey, rowData, base)
+}
 
-		cols = append(cols, d)
-		colIDs = append(colIDs, i)
+// put puts the encoded row replacing base, the put is timed in op.
+func (db *rawDB) put(ctx context.Context, op *profileOp, rowKey []byte, rowData []byte, base writeBase) error {
+	op.rpcBegin()
+	err := db.db.Put(rowKey, rowData)
+	op.rpcEnd()
+	if err != nil && db.codec.tokens != nil {
+		err = db.retryPut(op, rowKey, rowData, base, err)
+	}
+	if err != nil {
+		return err
 	}
 
-	rowData, err := tablecodec.EncodeRow(&stmtctx.StatementContext{}, cols, colIDs, buf.Bytes(), nil)
+	db.keepWrite(ctx, rowKey, rowData)
+	return nil
+}
+
+func (db *rawDB) Delete(ctx context.Context, table string, key string) (err error) {
+	defer wrapRawError(&err, "delete", table, key)
+
+	rowKey, err := db.tableCodec(table).getRowKey(table, key)
 	if err != nil {
 		return err
 	}
 
-	return db.db.Put(db.getRowKey(table, key), rowData)
+	if err = db.db.Delete(rowKey); err != nil {
+		return err
+	}
+
+	db.keepWrite(ctx, rowKey, nil)
+	return nil
+}
+
+// KeyDistribution counts the rows of the table in each of the buckets, which
+// split the key range of the table into equal parts by the first two bytes
+// following the table prefix. It scans the whole table, so it is expensive.
+func (db *rawDB) KeyDistribution(ctx context.Context, table string, buckets int) ([]int64, error) {
+	if buckets <= 0 {
+		return nil, fmt.Errorf("invalid bucket count %d", buckets)
+	}
+
+	prefix := db.tableCodec(table).appendTablePrefix(nil, table)
+	it := db.newIterator(ctx, prefix, kv.Key(prefix).PrefixNext())
+	counts := make([]int64, buckets)
+	for it.Next() {
+		var b [2]byte
+		copy(b[:], it.Key()[len(prefix):])
+		i := int(binary.BigEndian.Uint16(b[:])) * buckets >> 16
+		counts[i]++
+	}
+
+	return counts, it.Err()
+}
+
+// Reset deletes all the rows of the table and zeroes the counters of Stats,
+// to run several experiments in one process. The counters are not kept by
+// table, so all of them are zeroed. The rows are deleted one by one. It must
+// not run with other operations in flight, a concurrent write may survive it,
+// and of the thread writes kept by tikvRawReadYourWrites only the ones of the
+// thread of ctx are dropped.
+func (db *rawDB) Reset(ctx context.Context, table string) error {
+	prefix := db.tableCodec(table).appendTablePrefix(nil, table)
+	it := db.newIterator(ctx, prefix, kv.Key(prefix).PrefixNext())
+	for it.Next() {
+		if err := db.db.Delete(it.Key()); err != nil {
+			return err
+		}
+		if db.readCache != nil {
+			db.readCache.invalidate(it.Key())
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	if state := threadStateOf(ctx); state != nil && state.writes != nil {
+		state.writes = kvcache.NewSimpleLRUCache(db.writesSize)
+	}
+	db.stats.reset()
+	return nil
 }
 
-func (db *rawDB) Delete(ctx context.Context, table string, key string) error {
-	return db.db.Delete(db.getRowKey(table, key))
+// DeletePrefix deletes all the rows whose row key starts with the prefix,
+// following the keyspace prefix, and returns the number of deleted rows.
+// The prefix matches the stored layout, so "usertable:" deletes a whole table,
+// but a logical key prefix is only contiguous when salting and reversing keys
+// are disabled. The keys are deleted one by one.
+func (db *rawDB) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	start := append(append([]byte(nil), db.keyspacePrefix...), prefix...)
+	if len(start) == 0 {
+		return 0, fmt.Errorf("refuse to delete with an empty prefix")
+	}
+
+	it := db.newIterator(ctx, start, kv.Key(start).PrefixNext())
+	var n int64
+	for it.Next() {
+		if err := db.db.Delete(it.Key()); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, it.Err()
 }
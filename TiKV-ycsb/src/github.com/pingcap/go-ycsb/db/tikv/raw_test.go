@@ -0,0 +1,650 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/magiconair/properties"
+)
+
+// memRaw is a raw client keeping the pairs in memory.
+type memRaw struct {
+	mu    sync.Mutex
+	pairs map[string][]byte
+	// gets counts the calls of Get, and closes the ones of Close.
+	gets   int
+	closes int
+}
+
+func newMemRaw() *memRaw {
+	return &memRaw{pairs: make(map[string][]byte)}
+}
+
+func (m *memRaw) Get(key []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gets++
+	if v, ok := m.pairs[string(key)]; ok {
+		return append([]byte(nil), v...), nil
+	}
+	return nil, nil
+}
+
+func (m *memRaw) Put(key, value []byte) error {
+	if len(value) == 0 {
+		return errors.New("empty value is not supported")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pairs[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *memRaw) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pairs, string(key))
+	return nil
+}
+
+func (m *memRaw) Scan(startKey []byte, limit int) ([][]byte, [][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys [][]byte
+	for k := range m.pairs {
+		if bytes.Compare([]byte(k), startKey) >= 0 {
+			keys = append(keys, []byte(k))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = append([]byte(nil), m.pairs[string(k)]...)
+	}
+	return keys, values, nil
+}
+
+func (m *memRaw) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closes++
+	return nil
+}
+
+// keys returns the sorted keys of the pairs.
+func (m *memRaw) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.pairs))
+	for k := range m.pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// newTestRawDB returns a raw driver of the properties on a memRaw.
+func newTestRawDB(t testing.TB, kvs ...string) (*rawDB, *memRaw) {
+	t.Helper()
+	p := properties.NewProperties()
+	p.Set(tikvMaxConnCount, "1")
+	for i := 0; i+1 < len(kvs); i += 2 {
+		p.Set(kvs[i], kvs[i+1])
+	}
+	cfg, err := rawConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newMemRaw()
+	db, err := newRawDB(cfg, func(Config) (rawKV, error) { return m, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, m
+}
+
+func TestDeletePrefix(t *testing.T) {
+	tests := []struct {
+		kvs    []string
+		prefix string
+		// want are the row keys left, nil if DeletePrefix fails.
+		want []string
+	}{
+		{nil, "usertable:", []string{"other:user1"}},
+		{nil, "usertable:user1", []string{"other:user1", "usertable:user2"}},
+		{nil, "none", []string{"other:user1", "usertable:user1", "usertable:user10", "usertable:user2"}},
+		{nil, "", nil},
+		{[]string{tikvRawKeyspacePrefix, "run1/"}, "", []string{}},
+		{[]string{tikvRawKeyspacePrefix, "run1/"}, "other:", []string{"run1/usertable:user1", "run1/usertable:user10", "run1/usertable:user2"}},
+	}
+	for _, tt := range tests {
+		db, m := newTestRawDB(t, tt.kvs...)
+		for _, row := range []struct{ table, key string }{
+			{"usertable", "user1"}, {"usertable", "user10"}, {"usertable", "user2"}, {"other", "user1"},
+		} {
+			if err := db.Insert(context.Background(), row.table, row.key, map[string][]byte{"field0": []byte("a")}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		before := len(m.keys())
+		n, err := db.DeletePrefix(context.Background(), tt.prefix)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%v: DeletePrefix(%q) deleted %d rows, want an error", tt.kvs, tt.prefix, n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: DeletePrefix(%q): %v", tt.kvs, tt.prefix, err)
+		}
+		if left := m.keys(); !reflect.DeepEqual(left, tt.want) || n != int64(before-len(left)) {
+			t.Errorf("%v: DeletePrefix(%q) = %d left %q, want %q", tt.kvs, tt.prefix, n, left, tt.want)
+		}
+	}
+}
+
+func TestExists(t *testing.T) {
+	ctx := context.Background()
+	raw, m := newTestRawDB(t)
+	txn, _ := newTestTxnDB(t)
+	drivers := []struct {
+		name string
+		db   interface {
+			Insert(ctx context.Context, table string, key string, values map[string][]byte) error
+			Exists(ctx context.Context, table string, key string) (bool, error)
+		}
+	}{{"raw", raw}, {"txn", txn}}
+
+	for _, d := range drivers {
+		if err := d.db.Insert(ctx, "usertable", "user1", map[string][]byte{"field0": []byte("a")}); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range []struct {
+			key  string
+			want bool
+		}{{"user1", true}, {"user2", false}, {"user10", false}} {
+			if ok, err := d.db.Exists(ctx, "usertable", tt.key); err != nil || ok != tt.want {
+				t.Errorf("%s: Exists(%s) = %v, %v, want %v", d.name, tt.key, ok, err, tt.want)
+			}
+		}
+	}
+
+	// The row is not decoded, so a row Read can not decode exists.
+	m.Put([]byte("usertable:bad"), []byte{0xff})
+	if _, err := raw.Read(ctx, "usertable", "bad", nil); err == nil {
+		t.Fatal("Read decoded a corrupt row")
+	}
+	if ok, err := raw.Exists(ctx, "usertable", "bad"); err != nil || !ok {
+		t.Errorf("Exists of a corrupt row = %v, %v, want true", ok, err)
+	}
+}
+
+func TestConfigString(t *testing.T) {
+	tests := []struct {
+		set  func(cfg *Config)
+		want []string
+	}{
+		{func(cfg *Config) {}, []string{"maxConnCount=derived", "security=plaintext (ca unset, cert unset, key unset)"}},
+		{func(cfg *Config) {
+			cfg.PD = []string{"pd1:2379", "pd2:2379"}
+			cfg.MaxConnCount = 8
+		}, []string{"pd=pd1:2379,pd2:2379 maxConnCount=8"}},
+		{func(cfg *Config) {
+			cfg.Security.ClusterSSLCA = "/secret/ca.pem"
+			cfg.Security.ClusterSSLCert = "/secret/cert.pem"
+		}, []string{"security=tls (ca set, cert set, key unset)"}},
+		{func(cfg *Config) {
+			cfg.StaleRead = 5e9
+			cfg.KeyspacePrefix = "run1/"
+		}, []string{`keyspacePrefix="run1/"`, "staleRead=5s scanConsistency=stale"}},
+	}
+	for i, tt := range tests {
+		cfg := DefaultConfig()
+		tt.set(&cfg)
+		s := cfg.String()
+		for _, want := range tt.want {
+			if !strings.Contains(s, want) {
+				t.Errorf("#%d: %s has no %s", i, s, want)
+			}
+		}
+		if strings.Contains(s, "/secret") {
+			t.Errorf("#%d: %s shows a certificate path", i, s)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	ctx := context.Background()
+	tests := [][]string{
+		nil,
+		{tikvRawKeyspacePrefix, "run1/"},
+		{tikvRawSaltBuckets, "4"},
+		// The cached rows must not outlive the reset.
+		{tikvRawReadCacheSize, "16", tikvRawReadCacheTTL, "1h"},
+	}
+	for _, kvs := range tests {
+		db, m := newTestRawDB(t, kvs...)
+		for _, table := range []string{"usertable", "other"} {
+			for _, key := range []string{"user1", "user2"} {
+				if err := db.Insert(ctx, table, key, map[string][]byte{"field0": []byte("a")}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := db.Read(ctx, table, key, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		left := len(m.keys()) / 2
+
+		if err := db.Reset(ctx, "usertable"); err != nil {
+			t.Fatalf("%v: Reset: %v", kvs, err)
+		}
+		if n := len(m.keys()); n != left {
+			t.Errorf("%v: %d rows left, want the %d rows of the other table", kvs, n, left)
+		}
+		for name, n := range db.Stats() {
+			if n != 0 {
+				t.Errorf("%v: Stats()[%s] = %d after Reset, want 0", kvs, name, n)
+			}
+		}
+		if row, err := db.Read(ctx, "usertable", "user1", nil); err != nil || row != nil {
+			t.Errorf("%v: Read after Reset = %v, %v, want no row", kvs, row, err)
+		}
+		if row, err := db.Read(ctx, "other", "user1", nil); err != nil || row == nil {
+			t.Errorf("%v: Read of the other table = %v, %v, want the row", kvs, row, err)
+		}
+	}
+}
+
+func TestInsertMissingFields(t *testing.T) {
+	ctx := context.Background()
+	half := map[string][]byte{"field0": []byte("a")}
+	tests := []struct {
+		policy string
+		// want is the fields read back, nil if the insert fails.
+		want []string
+	}{
+		{"skip", []string{"field0"}},
+		{"fillEmpty", []string{"field0", "field1"}},
+		{"error", nil},
+	}
+	for _, tt := range tests {
+		kvs := []string{"fieldcount", "2", tikvRawMissingFields, tt.policy}
+		raw, _ := newTestRawDB(t, kvs...)
+		txn, _ := newTestTxnDB(t, kvs...)
+		inserts := []struct {
+			name   string
+			insert func() error
+			read   func() (map[string][]byte, error)
+		}{
+			{"raw Insert",
+				func() error { return raw.Insert(ctx, "usertable", "user1", half) },
+				func() (map[string][]byte, error) { return raw.Read(ctx, "usertable", "user1", nil) }},
+			{"txn Insert",
+				func() error { return txn.Insert(ctx, "usertable", "user1", half) },
+				func() (map[string][]byte, error) { return txn.Read(ctx, "usertable", "user1", nil) }},
+			{"TxnInsert",
+				func() error { return txn.TxnInsert(ctx, "usertable", map[string]map[string][]byte{"user2": half}) },
+				func() (map[string][]byte, error) { return txn.Read(ctx, "usertable", "user2", nil) }},
+		}
+		for _, ins := range inserts {
+			err := ins.insert()
+			if tt.want == nil {
+				if err == nil || !strings.Contains(err.Error(), "field1") {
+					t.Errorf("%s %s: insert of a row missing field1: err %v", tt.policy, ins.name, err)
+				}
+				continue
+			} else if err != nil {
+				t.Fatalf("%s %s: %v", tt.policy, ins.name, err)
+			}
+
+			row, err := ins.read()
+			if err != nil {
+				t.Fatalf("%s %s: %v", tt.policy, ins.name, err)
+			}
+			var fields []string
+			for field, v := range row {
+				if field != "field0" && len(v) != 0 {
+					t.Errorf("%s %s: filled %s with %q", tt.policy, ins.name, field, v)
+				}
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("%s %s: read the fields %v, want %v", tt.policy, ins.name, fields, tt.want)
+			}
+		}
+		if len(half) != 1 {
+			t.Fatalf("%s: the inserted values were modified: %q", tt.policy, half)
+		}
+
+		// Update merges into the stored row, whatever the policy.
+		if err := raw.Update(ctx, "usertable", "user3", half); err != nil {
+			t.Errorf("%s: Update of a partial row: %v", tt.policy, err)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		// order closes the driver, 0, and its clones, 1 and 2, in turn.
+		order []int
+	}{
+		{[]int{0, 1, 2}},
+		{[]int{2, 1, 0}},
+		{[]int{1, 1, 0, 0, 2}},
+	}
+	for _, tt := range tests {
+		db, m := newTestRawDB(t)
+		dbs := []*rawDB{db}
+		for i := 0; i < 2; i++ {
+			c, err := db.Clone()
+			if err != nil {
+				t.Fatal(err)
+			}
+			dbs = append(dbs, c.(*rawDB))
+		}
+
+		// The clones share the rows, but not the counters.
+		if err := dbs[1].Insert(ctx, "usertable", "user1", map[string][]byte{"field0": []byte("a")}); err != nil {
+			t.Fatal(err)
+		}
+		if row, err := dbs[2].Read(ctx, "usertable", "user1", nil); err != nil || row == nil {
+			t.Fatalf("Read from a clone = %v, %v, want the row", row, err)
+		}
+		dbs[2].stats.add("test", 1)
+		if n := db.Stats()["test"]; n != 0 {
+			t.Errorf("a clone added %d to the counters of the driver", n)
+		}
+
+		closed := make(map[int]bool)
+		for _, i := range tt.order {
+			if err := dbs[i].Close(); err != nil {
+				t.Fatal(err)
+			}
+			closed[i] = true
+			want := 0
+			if len(closed) == len(dbs) {
+				want = 1
+			}
+			if m.closes != want {
+				t.Fatalf("%v: closing %d closed the client %d times, want %d", tt.order, i, m.closes, want)
+			}
+			for j, open := range dbs {
+				if closed[j] {
+					continue
+				}
+				if _, err := open.Read(ctx, "usertable", "user1", nil); err != nil {
+					t.Errorf("%v: Read from %d after closing %d: %v", tt.order, j, i, err)
+				}
+			}
+		}
+		if _, err := db.Clone(); err == nil {
+			t.Errorf("%v: cloned a closed driver", tt.order)
+		}
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	db, m := newTestRawDB(t, tikvRawReadYourWrites, "true")
+	ctx := db.InitThread(context.Background(), 0, 1)
+	other := db.InitThread(context.Background(), 1, 1)
+	rowKey, err := db.codec.getRowKey("usertable", "user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := db.codec.encodeRow(nil, map[string][]byte{"field0": []byte("stale")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := func(v string) map[string][]byte { return map[string][]byte{"field0": []byte(v)} }
+
+	tests := []struct {
+		write func() error
+		// want is field0 of the row read back, "" if there is no row.
+		want string
+	}{
+		{func() error { return db.Insert(ctx, "usertable", "user1", value("a")) }, "a"},
+		{func() error { return db.Update(ctx, "usertable", "user1", value("b")) }, "b"},
+		{func() error { return db.Insert(ctx, "usertable", "user1", value("c")) }, "c"},
+		{func() error { return db.Delete(ctx, "usertable", "user1") }, ""},
+		{func() error { return db.Insert(ctx, "usertable", "user1", value("d")) }, "d"},
+	}
+	for i, tt := range tests {
+		if err := tt.write(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		// The thread reads its own write, not the row of the cluster.
+		m.Put(rowKey, stale)
+		hits := db.Stats()["read_your_writes_hit"]
+		row, err := db.Read(ctx, "usertable", "user1", nil)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := string(row["field0"]); got != tt.want || (tt.want == "") != (row == nil) {
+			t.Errorf("#%d: read %q, want %q", i, row, tt.want)
+		}
+		if n := db.Stats()["read_your_writes_hit"]; n != hits+1 {
+			t.Errorf("#%d: read_your_writes_hit %d, want %d", i, n, hits+1)
+		}
+
+		if row, err := db.Read(other, "usertable", "user1", nil); err != nil || string(row["field0"]) != "stale" {
+			t.Errorf("#%d: another thread read %q, %v, want the row of the cluster", i, row, err)
+		}
+	}
+}
+
+func TestReadCache(t *testing.T) {
+	ctx := context.Background()
+	value := func(v string) map[string][]byte { return map[string][]byte{"field0": []byte(v)} }
+	tests := []struct {
+		ttl string
+		// cached is whether the reads after the first are served by the cache.
+		cached bool
+	}{
+		{"1h", true},
+		{"1ns", false},
+	}
+	for _, tt := range tests {
+		db, m := newTestRawDB(t, tikvRawReadCacheSize, "16", tikvRawReadCacheTTL, tt.ttl)
+		steps := []struct {
+			write func() error
+			// want is field0 of the row read back, "" if there is no row.
+			want string
+		}{
+			{func() error { return db.Insert(ctx, "usertable", "user1", value("a")) }, "a"},
+			{func() error { return db.Update(ctx, "usertable", "user1", value("b")) }, "b"},
+			{func() error { return db.Delete(ctx, "usertable", "user1") }, ""},
+			{func() error { return db.Insert(ctx, "usertable", "user1", value("c")) }, "c"},
+		}
+		for i, step := range steps {
+			if err := step.write(); err != nil {
+				t.Fatalf("%s #%d: %v", tt.ttl, i, err)
+			}
+			// A write invalidates the cached row, so the first read gets it.
+			for j := 0; j < 3; j++ {
+				gets := m.gets
+				row, err := db.Read(ctx, "usertable", "user1", nil)
+				if err != nil {
+					t.Fatalf("%s #%d: %v", tt.ttl, i, err)
+				}
+				if got := string(row["field0"]); got != step.want {
+					t.Errorf("%s #%d: read %q, want %q", tt.ttl, i, row, step.want)
+				}
+				// The missing rows are not cached.
+				wantGets := 1
+				if j > 0 && tt.cached && step.want != "" {
+					wantGets = 0
+				}
+				if n := m.gets - gets; n != wantGets {
+					t.Errorf("%s #%d: read %d got %d rows from the cluster, want %d", tt.ttl, i, j, n, wantGets)
+				}
+			}
+		}
+	}
+}
+
+func TestUpdateReturning(t *testing.T) {
+	ctx := context.Background()
+	raw, _ := newTestRawDB(t)
+	txn, _ := newTestTxnDB(t)
+	routes, err := parseOpRouting("update:txn,read:txn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixedRaw, _ := newTestRawDB(t)
+	mixedTxn, _ := newTestTxnDB(t)
+	drivers := []struct {
+		name string
+		db   interface {
+			UpdateReturning(ctx context.Context, table string, key string, values map[string][]byte) (map[string][]byte, error)
+			Read(ctx context.Context, table string, key string, fields []string) (map[string][]byte, error)
+		}
+	}{{"raw", raw}, {"txn", txn}, {"mixed", &mixedDB{raw: mixedRaw, txn: mixedTxn, routes: routes, stats: newStats()}}}
+
+	steps := []struct {
+		values map[string][]byte
+		// previous is the row returned, nil for a missing row, and row the
+		// row read after the update.
+		previous, row map[string][]byte
+	}{
+		{map[string][]byte{"field0": []byte("a")}, nil, map[string][]byte{"field0": []byte("a")}},
+		{map[string][]byte{"field1": []byte("b")},
+			map[string][]byte{"field0": []byte("a")},
+			map[string][]byte{"field0": []byte("a"), "field1": []byte("b")}},
+		{map[string][]byte{"field0": []byte("c")},
+			map[string][]byte{"field0": []byte("a"), "field1": []byte("b")},
+			map[string][]byte{"field0": []byte("c"), "field1": []byte("b")}},
+	}
+	for _, d := range drivers {
+		for i, step := range steps {
+			previous, err := d.db.UpdateReturning(ctx, "usertable", "user1", step.values)
+			if err != nil {
+				t.Fatalf("%s #%d: %v", d.name, i, err)
+			}
+			if (previous == nil) != (step.previous == nil) || !sameRow(previous, step.previous) {
+				t.Errorf("%s #%d: UpdateReturning = %q, want %q", d.name, i, previous, step.previous)
+			}
+			// The returned row is a copy.
+			for field := range previous {
+				previous[field] = []byte("x")
+			}
+			if row, err := d.db.Read(ctx, "usertable", "user1", nil); err != nil || !sameRow(row, step.row) {
+				t.Errorf("%s #%d: Read after UpdateReturning = %q, %v, want %q", d.name, i, row, err, step.row)
+			}
+		}
+	}
+	// The mixed driver routed the updates to the txn driver.
+	if row, err := mixedRaw.Read(ctx, "usertable", "user1", nil); err != nil || row != nil {
+		t.Errorf("the mixed raw driver read %q, %v, want no row", row, err)
+	}
+}
+
+// BenchmarkReadRaw compares ReadRaw, which returns the row as the client
+// does, with Read decoding it, on a memRaw copying the value like a client.
+func BenchmarkReadRaw(b *testing.B) {
+	ctx := context.Background()
+	db, _ := newTestRawDB(b)
+	if err := db.Insert(ctx, "usertable", "user1", benchValues(10, 100)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Read", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := db.Read(ctx, "usertable", "user1", nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ReadRaw", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := db.ReadRaw(ctx, "usertable", "user1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkInsert runs the insert hot path of the raw driver on a memRaw,
+// the shared StatementContext and the pooled datums leave the row key and
+// the copies of memRaw as the only allocations.
+func BenchmarkInsert(b *testing.B) {
+	ctx := context.Background()
+	db, _ := newTestRawDB(b)
+	values := benchValues(10, 100)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user%d", i)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := db.Insert(ctx, "usertable", keys[i%len(keys)], values); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkScan scans 100 rows of a memRaw, without a thread, and in a
+// thread releasing each result with ReleaseScan so the next scan reuses it.
+func BenchmarkScan(b *testing.B) {
+	tests := []struct {
+		name    string
+		release bool
+	}{{"allocated", false}, {"released", true}}
+	for _, tt := range tests {
+		release := tt.release
+		b.Run(tt.name, func(b *testing.B) {
+			ctx := context.Background()
+			db, _ := newTestRawDB(b)
+			for i := 0; i < 200; i++ {
+				if err := db.Insert(ctx, "usertable", fmt.Sprintf("user%03d", i), benchValues(1, 100)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if release {
+				ctx = db.InitThread(ctx, 0, 1)
+				defer db.CleanupThread(ctx)
+			}
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rows, err := db.Scan(ctx, "usertable", "user000", 100, nil)
+				if err != nil || len(rows) != 100 {
+					b.Fatalf("Scan = %d rows, %v, want 100", len(rows), err)
+				}
+				if release {
+					db.ReleaseScan(ctx, rows)
+				}
+			}
+		})
+	}
+}
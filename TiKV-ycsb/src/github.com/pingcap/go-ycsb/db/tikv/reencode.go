@@ -0,0 +1,110 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/tidb/kv"
+	tidbcodec "github.com/pingcap/tidb/util/codec"
+)
+
+// tableColIDFlag is the flag of the varint column IDs of a "tablecodec" row,
+// which util/codec does not export.
+const tableColIDFlag = 8
+
+// builtinDecoders are the built-in encodings of rowEncoding.
+var builtinDecoders = map[string]RowCodec{
+	"tablecodec": tableRowCodec{},
+	"json":       jsonRowCodec{},
+	"msgpack":    msgpackRowCodec{},
+}
+
+// rowEncoding returns the built-in tikvRawEncoding of the row, detected by its
+// first byte as the rows carry no tag of their encoding, or "" if it is none
+// of them. The column IDs of "tablecodec" are varints, an empty row is a nil,
+// "json" encodes an object and "msgpack" a map.
+func rowEncoding(row []byte) string {
+	if len(row) == 0 {
+		return ""
+	}
+
+	switch b := row[0]; {
+	case b == tableColIDFlag || b == tidbcodec.NilFlag:
+		return "tablecodec"
+	case b == '{':
+		return "json"
+	case b&0xf0 == 0x80 || b == 0xde || b == 0xdf:
+		return "msgpack"
+	default:
+		return ""
+	}
+}
+
+// ReEncode rewrites the rows of table which are not in the tikv.raw.encoding
+// of the driver, after the encoding is changed, and returns the number of rows
+// rewritten. The encoding of every row is detected from the row itself, so
+// only the rows of the built-in encodings can be rewritten. A row of none of
+// them fails the rewrite, unless the driver uses a registered encoding, then
+// the row is taken to be in it already. The rows are scanned batch at a time,
+// 0 scans the default batch, and written back one by one, so the rows before a
+// failed one stay rewritten. The table must not be written while it is
+// rewritten.
+func (db *rawDB) ReEncode(ctx context.Context, table string, batch int) (int64, error) {
+	if batch < 0 {
+		return 0, fmt.Errorf("batch must not be negative, got %d", batch)
+	}
+
+	c := db.tableCodec(table)
+	prefix := c.appendTablePrefix(nil, table)
+	it := db.newIterator(ctx, prefix, kv.Key(prefix).PrefixNext())
+	if batch > 0 {
+		it.batch = batch
+	}
+
+	encoding := db.tableLayout(table).Encoding
+	_, builtin := builtinDecoders[encoding]
+	var n int64
+	for it.Next() {
+		enc := rowEncoding(it.Value())
+		if enc == encoding || (enc == "" && !builtin) {
+			continue
+		} else if enc == "" {
+			return n, fmt.Errorf("row %q is in no %s", it.Key(), tikvRawEncoding)
+		}
+		dec := builtinDecoders[enc]
+
+		data, err := c.stripToken(it.Value())
+		if err != nil {
+			return n, err
+		}
+		values, err := dec.Decode(data, nil)
+		if err != nil {
+			return n, fmt.Errorf("decode %s row %q: %v", enc, it.Key(), err)
+		}
+		row, err := c.encodeRow(nil, values)
+		if err != nil {
+			return n, err
+		}
+
+		rowKey := append([]byte(nil), it.Key()...)
+		if err := db.db.Put(rowKey, row); err != nil {
+			return n, err
+		}
+		db.keepWrite(ctx, rowKey, row)
+		n++
+	}
+	return n, it.Err()
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errNoReplicaRead is returned by the reads which need a follower replica.
+var errNoReplicaRead = errors.New("replica read is not supported by this TiKV client")
+
+// get reads the row key from the leader.
+func (db *rawDB) get(rowKey []byte) ([]byte, error) {
+	return db.db.Get(rowKey)
+}
+
+// ScanStale scans the rows as of staleness before now, which could be served by
+// a nearby follower with a lower latency. It scans the latest rows from the
+// leader, counted like a Scan, and its staleness replaces
+// tikvRawScanConsistency.
+func (db *rawDB) ScanStale(ctx context.Context, table string, startKey string, count int, staleness time.Duration, fields []string) (_ []map[string][]byte, err error) {
+	defer wrapRawError(&err, "scan", table, startKey)
+
+	if staleness < 0 {
+		return nil, fmt.Errorf("staleness must not be negative, got %s", staleness)
+	}
+
+	op := db.profile.begin("scan")
+	defer op.end()
+
+	consistency := "leader"
+	if staleness > 0 {
+		consistency = "stale"
+	}
+	db.countScanAs(consistency)
+	return db.tableCodec(table).scanRows(ctx, table, startKey, count, fields, db.scanFunc(&op))
+}
+
+// VerifyReplica would compare the row of the leader with the one of a
+// follower, it returns errNoReplicaRead once the key is checked.
+func (db *rawDB) VerifyReplica(ctx context.Context, table string, key string) (bool, error) {
+	if _, err := db.tableCodec(table).getRowKey(table, key); err != nil {
+		return false, err
+	}
+	return false, errNoReplicaRead
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pingcap/go-ycsb/pkg/prop"
+)
+
+func TestVerifyReplica(t *testing.T) {
+	db := &rawDB{codec: newTestCodec(t), stats: newStats()}
+	if ok, err := db.VerifyReplica(context.Background(), "usertable", "user1"); ok || err != errNoReplicaRead {
+		t.Errorf("VerifyReplica = %v, %v, want false, %v", ok, err, errNoReplicaRead)
+	}
+}
+
+func TestReadErrorsWrapped(t *testing.T) {
+	ctx := context.Background()
+	// The row keys of the long key do not fit tikvRawMaxKeyBytes.
+	db := &rawDB{codec: newTestCodec(t, prop.FieldCount, "2", tikvRawMaxKeyBytes, "16"), stats: newStats()}
+	key := "user0123456789abcdef"
+
+	tests := []struct {
+		op  string
+		run func() error
+	}{
+		{"read", func() error { _, err := db.Exists(ctx, "usertable", key); return err }},
+		{"read", func() error { _, _, err := db.GetWithMeta(ctx, "usertable", key); return err }},
+		{"read", func() error { _, err := db.ReadRaw(ctx, "usertable", key); return err }},
+		{"scan", func() error { _, err := db.ScanStale(ctx, "usertable", key, 1, -time.Second, nil); return err }},
+	}
+	for i, tt := range tests {
+		err, ok := tt.run().(*RawError)
+		if !ok || err.Op != tt.op || err.Table != "usertable" || err.Key != key {
+			t.Errorf("#%d: got %#v, want a %s *RawError of %s", i, err, tt.op, key)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// TableScan is a pass over the rows of a table in the order of the stored
+// keys, read page by page like ExportJSON. Its position can be saved with
+// Token and resumed by ScanResume, even by another process, so a full pass
+// over a huge table can be checkpointed. It is not safe for concurrent use.
+type TableScan struct {
+	c     *codec
+	ctx   context.Context
+	table string
+	// fields are the fields decoded, nil decodes them all.
+	fields []string
+	it     *rawIterator
+	// next is the start key of the rows not returned yet.
+	next []byte
+	end  []byte
+
+	key string
+	row map[string][]byte
+	err error
+}
+
+// ScanTable starts a pass over all the rows of the table. With
+// tikvRawMaxScanDuration the pass stops before its next page once it has run
+// that long, see Truncated.
+func (db *rawDB) ScanTable(ctx context.Context, table string, fields []string) *TableScan {
+	c := db.tableCodec(table)
+	prefix := c.appendTablePrefix(nil, table)
+	return db.newTableScan(ctx, c, table, prefix, fields)
+}
+
+// ScanResume continues the pass over the table from the position saved by
+// Token. The token is the next stored key, so it stays valid across restarts
+// and writes, but the rows written before the position meanwhile are skipped,
+// and the table must keep its layout.
+func (db *rawDB) ScanResume(ctx context.Context, table string, token string, fields []string) (*TableScan, error) {
+	start, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scan token %q: %v", token, err)
+	}
+
+	c := db.tableCodec(table)
+	prefix := c.appendTablePrefix(nil, table)
+	if !bytes.HasPrefix(start, prefix) && !bytes.Equal(start, kv.Key(prefix).PrefixNext()) {
+		return nil, fmt.Errorf("scan token %q is not a position in table %s", token, table)
+	}
+	return db.newTableScan(ctx, c, table, start, fields), nil
+}
+
+func (db *rawDB) newTableScan(ctx context.Context, c *codec, table string, start []byte, fields []string) *TableScan {
+	end := kv.Key(c.appendTablePrefix(nil, table)).PrefixNext()
+	it := db.newIterator(ctx, start, end)
+	if db.cfg.MaxScanDuration > 0 {
+		it.deadline = time.Now().Add(db.cfg.MaxScanDuration)
+	}
+
+	db.countScan()
+	return &TableScan{
+		c:      c,
+		ctx:    ctx,
+		table:  table,
+		fields: fields,
+		it:     it,
+		next:   start,
+		end:    end,
+	}
+}
+
+// Next moves to the next row, it returns false when the table is exhausted or
+// an error occurs.
+func (s *TableScan) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if !s.it.Next() {
+		if s.it.Err() == nil && !s.it.Truncated() {
+			s.next = s.end
+		}
+		return false
+	}
+
+	key, err := s.c.logicalKey(s.table, s.it.Key())
+	if err != nil {
+		s.err = err
+		return false
+	}
+
+	row, err := s.c.decodeRow(s.ctx, s.it.Value(), s.fields)
+	if err != nil {
+		s.err = fmt.Errorf("decode row of key %q in table %s: %v", key, s.table, err)
+		return false
+	}
+
+	// Append a '\0' to skip the current row.
+	rowKey := s.it.Key()
+	s.key, s.row = key, row
+	s.next = append(append(make([]byte, 0, len(rowKey)+1), rowKey...), 0)
+	return true
+}
+
+// Key returns the logical key of the current row.
+func (s *TableScan) Key() string {
+	return s.key
+}
+
+// Row returns the fields of the current row.
+func (s *TableScan) Row() map[string][]byte {
+	return s.row
+}
+
+// Truncated returns whether tikvRawMaxScanDuration stopped the scan before the
+// end of the table, the rows returned are a partial result and Token resumes
+// after them.
+func (s *TableScan) Truncated() bool {
+	return s.it.Truncated()
+}
+
+// Err returns the error which stopped the scan.
+func (s *TableScan) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.it.Err()
+}
+
+// Token returns the position after the current row, so it can be saved once
+// the row is processed. The token of a failed scan resumes at the row which
+// failed, and the token of an exhausted scan resumes to no row.
+func (s *TableScan) Token() string {
+	return base64.RawURLEncoding.EncodeToString(s.next)
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scanAll returns the keys of the pass and stops after max rows, with the
+// token to resume after them.
+func scanAll(t *testing.T, s *TableScan, max int) ([]string, string) {
+	t.Helper()
+	// Several pages per pass.
+	s.it.batch = 16
+	var keys []string
+	for len(keys) < max && s.Next() {
+		if want := "v" + s.Key(); string(s.Row()["field0"]) != want {
+			t.Fatalf("row of %s is %q, want field0 %s", s.Key(), s.Row(), want)
+		}
+		keys = append(keys, s.Key())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return keys, s.Token()
+}
+
+func TestScanResume(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		kvs []string
+		// stop is the number of rows of a pass before it is resumed.
+		stop int
+	}{
+		{nil, 1},
+		{nil, 7},
+		{nil, 16},
+		{nil, 1000},
+		{[]string{tikvRawKeyspacePrefix, "run1/"}, 10},
+		{[]string{tikvRawSaltBuckets, "4"}, 10},
+	}
+	for _, tt := range tests {
+		db, m := newTestRawDB(t, tt.kvs...)
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("user%d", i)
+			if err := db.Insert(ctx, "usertable", key, map[string][]byte{"field0": []byte("v" + key)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, table := range []string{"other", "usertablex"} {
+			if err := db.Insert(ctx, table, "user1", map[string][]byte{"field0": []byte("vuser1")}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, token := scanAll(t, db.ScanTable(ctx, "usertable", nil), 1000)
+		if len(want) != 100 {
+			t.Fatalf("%v: scanned %d rows, want 100", tt.kvs, len(want))
+		}
+
+		// Every pass runs in a new driver, like after a restart.
+		var got []string
+		token = ""
+		for passes := 0; ; passes++ {
+			if passes > 100 {
+				t.Fatalf("%v: the scan does not end", tt.kvs)
+			}
+			next, _ := newTestRawDB(t, tt.kvs...)
+			next.db = m
+			var s *TableScan
+			if token == "" {
+				s = next.ScanTable(ctx, "usertable", []string{"field0"})
+			} else {
+				var err error
+				if s, err = next.ScanResume(ctx, "usertable", token, []string{"field0"}); err != nil {
+					t.Fatalf("%v: ScanResume(%s): %v", tt.kvs, token, err)
+				}
+			}
+			keys, nextToken := scanAll(t, s, tt.stop)
+			got = append(got, keys...)
+			if len(keys) < tt.stop {
+				break
+			}
+			token = nextToken
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: resumed every %d rows the scan returned %q, want %q", tt.kvs, tt.stop, got, want)
+		}
+
+		// The token of an exhausted scan resumes to no row.
+		s := db.ScanTable(ctx, "usertable", nil)
+		scanAll(t, s, 1000)
+		if s, err := db.ScanResume(ctx, "usertable", s.Token(), nil); err != nil || s.Next() {
+			t.Errorf("%v: the token of an exhausted scan resumed at %s, %v", tt.kvs, s.Key(), err)
+		}
+	}
+
+	db, _ := newTestRawDB(t)
+	s := db.ScanTable(ctx, "other", nil)
+	for _, token := range []string{"!", s.Token()} {
+		if _, err := db.ScanResume(ctx, "usertable", token, nil); err == nil || !strings.Contains(err.Error(), "token") {
+			t.Errorf("ScanResume(%q): err %v", token, err)
+		}
+	}
+}
+
+// slowRaw is a memRaw whose scans take delay.
+type slowRaw struct {
+	*memRaw
+	delay time.Duration
+}
+
+func (s *slowRaw) Scan(startKey []byte, limit int) ([][]byte, [][]byte, error) {
+	time.Sleep(s.delay)
+	return s.memRaw.Scan(startKey, limit)
+}
+
+func TestMaxScanDuration(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		maxScanDuration string
+		truncated       bool
+	}{
+		{"0", false},
+		// The pages take 20ms, so a pass stops after a few of the 7 pages.
+		{"50ms", true},
+	}
+	for _, tt := range tests {
+		db, m := newTestRawDB(t, tikvRawMaxScanDuration, tt.maxScanDuration)
+		var want []string
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("user%03d", i)
+			if err := db.Insert(ctx, "usertable", key, map[string][]byte{"field0": []byte("v" + key)}); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, key)
+		}
+		db.db = &slowRaw{memRaw: m, delay: 20 * time.Millisecond}
+
+		var got []string
+		s := db.ScanTable(ctx, "usertable", nil)
+		for passes := 1; ; passes++ {
+			keys, token := scanAll(t, s, 1000)
+			got = append(got, keys...)
+			if !s.Truncated() {
+				break
+			}
+			if !tt.truncated {
+				t.Fatalf("%s: pass %d truncated", tt.maxScanDuration, passes)
+			}
+			// A pass stops before a page, after at least one.
+			if len(keys) == 0 || len(keys)%16 != 0 || len(got) >= len(want) {
+				t.Errorf("%s: pass %d truncated after %d rows", tt.maxScanDuration, passes, len(keys))
+			}
+			if n := db.Stats()["scan_truncated"]; n != int64(passes) {
+				t.Errorf("%s: scan_truncated = %d after %d truncated passes", tt.maxScanDuration, n, passes)
+			}
+
+			var err error
+			if s, err = db.ScanResume(ctx, "usertable", token, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: the passes returned %q, want %q", tt.maxScanDuration, got, want)
+		}
+		if n := db.Stats()["scan_truncated"]; tt.truncated != (n > 0) {
+			t.Errorf("%s: scan_truncated = %d", tt.maxScanDuration, n)
+		}
+	}
+}
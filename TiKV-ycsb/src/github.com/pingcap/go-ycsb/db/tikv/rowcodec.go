@@ -0,0 +1,284 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+	tidbcodec "github.com/pingcap/tidb/util/codec"
+)
+
+// tikvRawEncoding is the name of the RowCodec of the rows, "tablecodec",
+// "json", "msgpack" or one registered with RegisterCodec.
+const tikvRawEncoding = "tikv.raw.encoding"
+
+// RowCodec encodes the fields of a row into the value stored in TiKV, it must
+// be safe for concurrent use.
+type RowCodec interface {
+	// Encode encodes the values into the capacity of b, the row is only kept
+	// until b is reused.
+	Encode(b []byte, values map[string][]byte) ([]byte, error)
+	// Decode returns the fields of the row, nil fields returns all of them.
+	// The result is kept by the caller, so it must not share row. An empty
+	// row, like the one of a missing key, is an empty map.
+	Decode(row []byte, fields []string) (map[string][]byte, error)
+}
+
+var (
+	rowCodecsMu sync.RWMutex
+	rowCodecs   = map[string]func() RowCodec{}
+)
+
+// RegisterCodec registers a RowCodec for tikvRawEncoding, like
+// ycsb.RegisterDBCreator it panics if the name is already registered. Call it
+// from init, so the codec exists before the drivers are created.
+func RegisterCodec(name string, factory func() RowCodec) {
+	rowCodecsMu.Lock()
+	defer rowCodecsMu.Unlock()
+
+	if _, ok := rowCodecs[name]; ok {
+		panic(fmt.Sprintf("duplicate register row codec %s", name))
+	}
+	rowCodecs[name] = factory
+}
+
+// newRowCodec returns nil for "tablecodec", which the codec encodes itself
+// without the interface.
+func newRowCodec(name string) (RowCodec, error) {
+	rowCodecsMu.RLock()
+	factory, ok := rowCodecs[name]
+	rowCodecsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s %q", tikvRawEncoding, name)
+	}
+	rc := factory()
+	if _, ok := rc.(tableRowCodec); ok {
+		return nil, nil
+	}
+	return rc, nil
+}
+
+func init() {
+	RegisterCodec("tablecodec", func() RowCodec { return tableRowCodec{} })
+	RegisterCodec("json", func() RowCodec { return jsonRowCodec{} })
+	RegisterCodec("msgpack", func() RowCodec { return msgpackRowCodec{} })
+}
+
+// selectFields returns the fields of a decoded row, nil fields returns the row.
+func selectFields(row map[string][]byte, fields []string) map[string][]byte {
+	if len(fields) == 0 {
+		return row
+	}
+
+	res := make(map[string][]byte, len(fields))
+	for _, field := range fields {
+		if v, ok := row[field]; ok {
+			res[field] = v
+		}
+	}
+	return res
+}
+
+// tableRowCodec is the encoding of TiDB rows, with the column ID of field<i>
+// being i. The codec of the drivers encodes it faster with the configured
+// columns, so this one is only used through the interface.
+type tableRowCodec struct{}
+
+// tableRowCodecSC is read only, like the sc of codec.
+var tableRowCodecSC = &stmtctx.StatementContext{}
+
+func (tableRowCodec) Encode(b []byte, values map[string][]byte) ([]byte, error) {
+	cols := make([]types.Datum, 0, len(values))
+	colIDs := make([]int64, 0, len(values))
+	for field, v := range values {
+		id, err := strconv.ParseInt(strings.TrimPrefix(field, "field"), 10, 64)
+		if err != nil || !strings.HasPrefix(field, "field") {
+			return nil, fmt.Errorf("field %q is not named field<i>", field)
+		}
+		var d types.Datum
+		d.SetBytes(v)
+		cols = append(cols, d)
+		colIDs = append(colIDs, id)
+	}
+	return tablecodec.EncodeRow(tableRowCodecSC, cols, colIDs, b, nil)
+}
+
+func (tableRowCodec) Decode(row []byte, fields []string) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+	if len(row) == 0 || (len(row) == 1 && row[0] == tidbcodec.NilFlag) {
+		return res, nil
+	}
+
+	for b := row; len(b) > 0; {
+		remain, id, err := tidbcodec.DecodeOne(b)
+		if err != nil {
+			return nil, err
+		}
+		var v types.Datum
+		if b, v, err = tidbcodec.DecodeOne(remain); err != nil {
+			return nil, err
+		}
+		res["field"+strconv.FormatInt(id.GetInt64(), 10)] = v.GetBytes()
+	}
+	return selectFields(res, fields), nil
+}
+
+// jsonRowCodec stores a row as a JSON object of the fields, the values are
+// base64 strings so any bytes round trip.
+type jsonRowCodec struct{}
+
+func (jsonRowCodec) Encode(b []byte, values map[string][]byte) ([]byte, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return append(b[:0], data...), nil
+}
+
+func (jsonRowCodec) Decode(row []byte, fields []string) (map[string][]byte, error) {
+	var res map[string][]byte
+	if len(row) == 0 {
+		return make(map[string][]byte), nil
+	}
+	if err := json.Unmarshal(row, &res); err != nil {
+		return nil, fmt.Errorf("decode JSON row: %v", err)
+	}
+	if res == nil {
+		res = make(map[string][]byte)
+	}
+	return selectFields(res, fields), nil
+}
+
+// msgpackRowCodec stores a row as a MessagePack map of the field names to the
+// values as bin, with the fields in order so a row always encodes the same.
+// It only reads this shape, not any MessagePack.
+type msgpackRowCodec struct{}
+
+func (msgpackRowCodec) Encode(b []byte, values map[string][]byte) ([]byte, error) {
+	fields := make([]string, 0, len(values))
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	b = appendMsgpackHeader(b[:0], len(fields), 0x80, 15, 0xde, 0xdf)
+	for _, field := range fields {
+		b = appendMsgpackHeader(b, len(field), 0xa0, 31, 0xda, 0xdb)
+		b = append(b, field...)
+		v := values[field]
+		if len(v) <= 0xff {
+			b = append(b, 0xc4, byte(len(v)))
+		} else {
+			b = appendMsgpackHeader(b, len(v), 0, -1, 0xc5, 0xc6)
+		}
+		b = append(b, v...)
+	}
+	return b, nil
+}
+
+// appendMsgpackHeader appends the header of a map or a string of n, the fix
+// format holds up to fixMax, a negative fixMax has none.
+func appendMsgpackHeader(b []byte, n int, fix byte, fixMax int, tag16 byte, tag32 byte) []byte {
+	switch {
+	case n <= fixMax:
+		return append(b, fix|byte(n))
+	case n <= 0xffff:
+		b = append(b, tag16, 0, 0)
+		binary.BigEndian.PutUint16(b[len(b)-2:], uint16(n))
+		return b
+	default:
+		b = append(b, tag32, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[len(b)-4:], uint32(n))
+		return b
+	}
+}
+
+func (msgpackRowCodec) Decode(row []byte, fields []string) (map[string][]byte, error) {
+	if len(row) == 0 {
+		return make(map[string][]byte), nil
+	}
+	d := msgpackDecoder{b: row}
+	n := d.length(0x80, 0x0f, 0, 0xde, 0xdf)
+	res := make(map[string][]byte, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		field := string(d.bytes(d.length(0xa0, 0x1f, 0xd9, 0xda, 0xdb)))
+		value := d.bytes(d.length(0, 0, 0xc4, 0xc5, 0xc6))
+		res[field] = append([]byte(nil), value...)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("decode MessagePack row: %v", d.err)
+	}
+	return selectFields(res, fields), nil
+}
+
+type msgpackDecoder struct {
+	b   []byte
+	err error
+}
+
+// length reads the tag of a map, a string or a bin and returns its length,
+// which a fix tag keeps in the bits of fixMask and the others follow with 1, 2
+// or 4 bytes. A zero fix or tag8 means the type has no such tag.
+func (d *msgpackDecoder) length(fix byte, fixMask byte, tag8 byte, tag16 byte, tag32 byte) int {
+	b := d.bytes(1)
+	if d.err != nil {
+		return 0
+	}
+
+	switch tag := b[0]; {
+	case fix != 0 && tag&^fixMask == fix:
+		return int(tag & fixMask)
+	case tag8 != 0 && tag == tag8:
+		return d.uint(1)
+	case tag == tag16:
+		return d.uint(2)
+	case tag == tag32:
+		return d.uint(4)
+	default:
+		d.err = fmt.Errorf("unexpected tag 0x%02x", tag)
+		return 0
+	}
+}
+
+// uint reads a big-endian unsigned integer of n bytes.
+func (d *msgpackDecoder) uint(n int) int {
+	var v int
+	for _, c := range d.bytes(n) {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+func (d *msgpackDecoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.b) {
+		d.err = fmt.Errorf("unexpected end of row")
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/magiconair/properties"
+)
+
+func newTestCodec(t testing.TB, kvs ...string) *codec {
+	t.Helper()
+	p := properties.NewProperties()
+	for i := 0; i+1 < len(kvs); i += 2 {
+		p.Set(kvs[i], kvs[i+1])
+	}
+	c, err := newCodec(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+var testEncodings = []string{"tablecodec", "json", "msgpack"}
+
+func TestRowCodecRoundTrip(t *testing.T) {
+	rows := []map[string][]byte{
+		{},
+		{"field0": []byte("a")},
+		{"field0": []byte(""), "field3": []byte("\x00\xff binary")},
+		{"field1": bytes.Repeat([]byte("x"), 70000)},
+	}
+	for _, name := range testEncodings {
+		c := newTestCodec(t, tikvRawEncoding, name, "fieldcount", "4")
+		for _, row := range rows {
+			data, err := c.encodeRow(nil, row)
+			if err != nil {
+				t.Fatalf("%s: encode %v: %v", name, row, err)
+			}
+			got, err := c.decodeRow(context.Background(), data, nil)
+			if err != nil {
+				t.Fatalf("%s: decode: %v", name, err)
+			}
+			if !sameRow(got, row) {
+				t.Errorf("%s: decoded %q, want %q", name, got, row)
+			}
+		}
+	}
+}
+
+// TestRowCodecEmptyRow checks the row of a missing key decodes to an empty
+// map, which update merges the values into.
+func TestRowCodecEmptyRow(t *testing.T) {
+	for _, name := range testEncodings {
+		c := newTestCodec(t, tikvRawEncoding, name)
+		for _, row := range [][]byte{nil, {}} {
+			got, err := c.decodeRow(context.Background(), row, nil)
+			if err != nil {
+				t.Fatalf("%s: decode %q: %v", name, row, err)
+			}
+			if got == nil || len(got) != 0 {
+				t.Errorf("%s: decode %q = %v, want an empty map", name, row, got)
+			}
+			got["field0"] = []byte("v")
+		}
+	}
+
+	for _, rc := range []RowCodec{tableRowCodec{}, jsonRowCodec{}, msgpackRowCodec{}} {
+		got, err := rc.Decode(nil, nil)
+		if err != nil || got == nil || len(got) != 0 {
+			t.Errorf("%T: Decode(nil) = %v, %v, want an empty map", rc, got, err)
+		}
+	}
+}
+
+func TestRowCodecSelectFields(t *testing.T) {
+	row := map[string][]byte{"field0": []byte("a"), "field1": []byte("b")}
+	for _, name := range testEncodings {
+		c := newTestCodec(t, tikvRawEncoding, name, "fieldcount", "2")
+		data, err := c.encodeRow(nil, row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.decodeRow(context.Background(), data, []string{"field1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string][]byte{"field1": []byte("b")}; !sameRow(got, want) {
+			t.Errorf("%s: decoded %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNewRowCodecUnknown(t *testing.T) {
+	if _, err := newRowCodec("protobuf"); err == nil {
+		t.Fatal("newRowCodec of an unknown codec succeeded")
+	}
+}
+
+func sameRow(a map[string][]byte, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for field, v := range a {
+		w, ok := b[field]
+		if !ok || !bytes.Equal(v, w) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math/bits"
+
+	"github.com/pingcap/go-ycsb/pkg/util"
+)
+
+// properties
+const (
+	// tikvRawSaltHash is the hash of the logical key picking its salt bucket,
+	// "crc32", "fnv" or "xxhash", so the buckets can match the sharding of
+	// another system.
+	tikvRawSaltHash = "tikv.raw.saltHash"
+)
+
+// saltHasher hashes the logical key of a salted row, its bucket is the hash
+// modulo the number of buckets.
+type saltHasher interface {
+	hash(key []byte) uint64
+}
+
+// saltHashers are the hashes of tikvRawSaltHash.
+var saltHashers = map[string]saltHasher{
+	"crc32":  crc32Hasher{},
+	"fnv":    fnvHasher{},
+	"xxhash": xxHasher{},
+}
+
+// crc32Hasher is the IEEE CRC-32.
+type crc32Hasher struct{}
+
+func (crc32Hasher) hash(key []byte) uint64 {
+	return uint64(crc32.ChecksumIEEE(key))
+}
+
+// fnvHasher is the 64 bits FNV-1a.
+type fnvHasher struct{}
+
+func (fnvHasher) hash(key []byte) uint64 {
+	return uint64(util.BytesHash64(key))
+}
+
+// xxHasher is the 64 bits xxHash with a seed of 0, the vendored packages have
+// no xxHash.
+type xxHasher struct{}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func xxRound(acc uint64, input uint64) uint64 {
+	acc += input * xxPrime2
+	return bits.RotateLeft64(acc, 31) * xxPrime1
+}
+
+func xxMergeRound(acc uint64, v uint64) uint64 {
+	acc ^= xxRound(0, v)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (xxHasher) hash(b []byte) uint64 {
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		var seed uint64
+		v1, v2, v3, v4 := seed+xxPrime1+xxPrime2, seed+xxPrime2, seed, seed-xxPrime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(b[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(b[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(b[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(b[24:32]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+
+	h += uint64(n)
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
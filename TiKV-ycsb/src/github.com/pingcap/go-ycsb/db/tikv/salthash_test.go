@@ -0,0 +1,74 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSaltHashers(t *testing.T) {
+	tests := []struct {
+		hash string
+		key  string
+		want uint64
+	}{
+		{"crc32", "", 0},
+		{"crc32", "123456789", 0xcbf43926},
+		{"fnv", "", 0xcbf29ce484222325},
+		{"fnv", "a", 0xaf63dc4c8601ec8c},
+		{"xxhash", "", 0xef46db3751d8e999},
+		{"xxhash", "a", 0xd24ec4f1a98c6e5b},
+		{"xxhash", "as", 0x1c330fb2d66be179},
+		{"xxhash", "asd", 0x631c37ce72a97393},
+		{"xxhash", "asdf", 0x415872f599cea71e},
+		{"xxhash", "abc", 0x44bc2cf5ad770999},
+		// The inputs of 32 bytes and more take the striped loop.
+		{"xxhash", "Call me Ishmael. Some years ago--never mind how long precisely-", 0x02a2e85470d6fd96},
+	}
+	for _, tt := range tests {
+		if got := saltHashers[tt.hash].hash([]byte(tt.key)); got != tt.want {
+			t.Errorf("%s(%q) = %#x, want %#x", tt.hash, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSaltBuckets(t *testing.T) {
+	for _, hash := range []string{"crc32", "fnv", "xxhash"} {
+		c := newTestCodec(t, tikvRawSaltBuckets, "16", tikvRawSaltHash, hash)
+		other := newTestCodec(t, tikvRawSaltBuckets, "16", tikvRawSaltHash, hash)
+		used := make(map[int]bool)
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("user%d", i)
+			rowKey, err := c.RowKey("usertable", key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The bucket only depends on the hash of the key.
+			bucket := int(saltHashers[hash].hash([]byte(key)) % 16)
+			want := append(c.appendBucketPrefix(nil, "usertable", bucket), key...)
+			if !bytes.Equal(rowKey, want) {
+				t.Errorf("%s: RowKey(%s) = %q, want %q", hash, key, rowKey, want)
+			}
+			if again, err := other.RowKey("usertable", key); err != nil || !bytes.Equal(again, rowKey) {
+				t.Errorf("%s: RowKey(%s) of another codec = %q, %v, want %q", hash, key, again, err, rowKey)
+			}
+			used[bucket] = true
+		}
+		if len(used) != 16 {
+			t.Errorf("%s: the keys only use %d of 16 buckets", hash, len(used))
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// ShardRange returns the range [startKey, endKey) of the logical keys owned by
+// shard shardIndex of totalShards, "" is the start or the end of the keyspace.
+// The shards are contiguous, disjoint and cover all the keys, so the processes
+// of a run can split the keyspace without coordinating. The operations are not
+// bounded by the range, it is for the tools splitting the keys of a run, like
+// PreSplitKeys.
+//
+// The range of the keys of insertorder=hashed, keyPrefix, the keyprefix of the
+// workload, followed by an int64 hash, is split evenly, the negative hashes
+// like "user-12" sort first. The core workload hashes the key numbers with
+// FNV, and the hashes of the first 100000 keys all fall in one quarter of the
+// range, so the shards of a small table are uneven. The keys of
+// insertorder=ordered are better split by their numbers with insertstart and
+// insertcount.
+func ShardRange(keyPrefix string, totalShards, shardIndex int) (startKey, endKey string, err error) {
+	if totalShards <= 0 || shardIndex < 0 || shardIndex >= totalShards {
+		return "", "", fmt.Errorf("invalid shard %d of %d shards", shardIndex, totalShards)
+	}
+
+	if shardIndex > 0 {
+		startKey = shardBound(keyPrefix, totalShards, shardIndex)
+	}
+	if shardIndex < totalShards-1 {
+		endKey = shardBound(keyPrefix, totalShards, shardIndex+1)
+	}
+	return startKey, endKey, nil
+}
+
+// shardBound returns the first key of shard i, at i/n of the sorted hashes.
+// The first half holds the negative hashes and the second half the others.
+// Most hashes have 19 digits, so the bounds are spread over those, and the
+// shorter hashes sort among them by their first digits.
+func shardBound(keyPrefix string, n, i int) string {
+	pos, _ := bits.Div64(uint64(i), 0, uint64(n))
+	sign := "-"
+	if pos >= 1<<63 {
+		sign, pos = "", pos-1<<63
+	}
+
+	const minHash = 1e18
+	hi, lo := bits.Mul64(pos, math.MaxInt64-minHash)
+	return fmt.Sprintf("%s%s%d", keyPrefix, sign, minHash+(hi<<1|lo>>63))
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestShardRange(t *testing.T) {
+	const keys = 20000
+	for _, prefix := range []string{"user", "k"} {
+		for _, n := range []int{1, 2, 3, 4, 7, 10} {
+			// The shards are contiguous and cover the keyspace.
+			var prevEnd string
+			for i := 0; i < n; i++ {
+				start, end, err := ShardRange(prefix, n, i)
+				if err != nil {
+					t.Fatalf("ShardRange(%q, %d, %d): %v", prefix, n, i, err)
+				}
+				if start != prevEnd || (i == n-1) != (end == "") || (end != "" && end <= start) {
+					t.Fatalf("shard %d of %d is [%q, %q) after one ending at %q", i, n, start, end, prevEnd)
+				}
+				prevEnd = end
+			}
+
+			// Every hashed key is in one shard, and the shards hold about
+			// the same number of uniform hashes.
+			r := rand.New(rand.NewSource(1))
+			counts := make([]int, n)
+			for k := 0; k < keys; k++ {
+				key := fmt.Sprintf("%s%d", prefix, int64(r.Uint64()))
+				owners := 0
+				for i := 0; i < n; i++ {
+					start, end, _ := ShardRange(prefix, n, i)
+					if key >= start && (end == "" || key < end) {
+						counts[i]++
+						owners++
+					}
+				}
+				if owners != 1 {
+					t.Fatalf("key %q is in %d of %d shards", key, owners, n)
+				}
+			}
+			for i, c := range counts {
+				if want := keys / n; c < want*9/10 || c > want*11/10 {
+					t.Errorf("shard %d of %d holds %d of %d %q keys, want about %d", i, n, c, keys, prefix, want)
+				}
+			}
+		}
+	}
+}
+
+func TestShardRangeInvalid(t *testing.T) {
+	for _, tt := range []struct{ n, i int }{{0, 0}, {-1, 0}, {3, 3}, {3, -1}} {
+		if _, _, err := ShardRange("user", tt.n, tt.i); err == nil {
+			t.Errorf("ShardRange(%d, %d) returned no error", tt.n, tt.i)
+		}
+	}
+}
+
+func TestPreSplitKeys(t *testing.T) {
+	keys := PreSplitKeys("user", 4)
+	if len(keys) != 3 {
+		t.Fatalf("PreSplitKeys(4) = %q, want 3 keys", keys)
+	}
+	for i, key := range keys {
+		if start, _, _ := ShardRange("user", 4, i+1); key != start {
+			t.Errorf("split key %d is %q, want the start of shard %d %q", i, key, i+1, start)
+		}
+	}
+	if keys := PreSplitKeys("user", 1); len(keys) != 0 {
+		t.Errorf("PreSplitKeys(1) = %q, want none", keys)
+	}
+}
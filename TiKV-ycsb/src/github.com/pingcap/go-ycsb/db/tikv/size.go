@@ -0,0 +1,304 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"sort"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// properties
+const (
+	// tikvRawSizeSamplePages is the number of pages read by EstimateSize, 0
+	// reads the whole table.
+	tikvRawSizeSamplePages = "tikv.raw.sizeSamplePages"
+)
+
+// EstimateSize returns the bytes of the stored keys and rows of the table, to
+// gauge the footprint of a load. With tikvRawSizeSamplePages it reads that many
+// pages spread over the keys of the table and extrapolates, see sampleSize,
+// and with 0 it reads every pair. It is the size of one replica before the
+// compression and the MVCC and raft overhead of TiKV, so the disk usage is
+// about the replica count times the size, less what the compression saves.
+func (db *rawDB) EstimateSize(ctx context.Context, table string) (int64, error) {
+	prefix := db.tableCodec(table).appendTablePrefix(nil, table)
+	end := kv.Key(prefix).PrefixNext()
+	if db.cfg.SizeSamplePages == 0 {
+		return pairsSize(db.newIterator(ctx, prefix, end))
+	}
+	return sampleSize(ctx, db.db.Scan, prefix, end, db.cfg.SizeSamplePages, rawScanBatchSize)
+}
+
+// pairsSize sums the lengths of the keys and values of it.
+func pairsSize(it *rawIterator) (int64, error) {
+	var size int64
+	for it.Next() {
+		size += int64(len(it.Key()) + len(it.Value()))
+	}
+	return size, it.Err()
+}
+
+// sampleSize estimates the bytes of the pairs in [start, end) with the given
+// number of pages of batch pairs. It finds the first and the last key, the
+// last with a few hundred one pair scans, maps the keys between them to
+// numbers with a keySpace, splits those into that many segments of the same
+// width and reads the first page of each segment. A segment which fits in its
+// page is counted exactly, the size of the others is extrapolated from the
+// share of the segment their page covers, measured with a keySpace of the
+// pages read. A range of at most pages segments of one page is thus exact,
+// and the error of the others grows with the unevenness of the keys inside a
+// segment.
+func sampleSize(ctx context.Context, scan scanFunc, start []byte, end []byte, pages int, batch int) (int64, error) {
+	first, ok, err := firstKey(scan, start, end)
+	if err != nil || !ok {
+		return 0, err
+	}
+	last, err := lastKey(scan, first, end)
+	if err != nil {
+		return 0, err
+	}
+	head, _, err := scan(first, batch)
+	if err != nil {
+		return 0, err
+	}
+	prefix := first[:commonPrefixLen(first, last)]
+	segments := newKeySpace(prefix, append([][]byte{first, last}, head...), true)
+
+	// The bounds are integers, so the keys of a segment are at least its
+	// bound.
+	lo, hi := segments.position(first), segments.position(last)+1
+	bounds := make([]float64, pages+1)
+	for i := range bounds {
+		bounds[i] = math.Floor(lo + (hi-lo)*float64(i)/float64(pages))
+	}
+	bounds[0], bounds[pages] = lo, hi
+
+	// partial are the segments larger than their page.
+	type partial struct {
+		start, end, last []byte
+		size             int64
+	}
+	var (
+		exact    int64
+		partials []partial
+		sample   [][]byte
+	)
+	segStart := first
+	for i := 0; i < pages; i++ {
+		if bounds[i+1] <= bounds[i] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		segEnd := end
+		if i < pages-1 {
+			segEnd = segments.key(bounds[i+1])
+		}
+		keys, values, err := scan(segStart, batch)
+		if err != nil {
+			return 0, err
+		}
+		var pageSize int64
+		n := 0
+		for ; n < len(keys) && bytes.Compare(keys[n], segEnd) < 0; n++ {
+			pageSize += int64(len(keys[n]) + len(values[n]))
+		}
+		if n < batch {
+			exact += pageSize
+		} else {
+			partials = append(partials, partial{start: segStart, end: segEnd, last: keys[n-1], size: pageSize})
+			sample = append(sample, keys[:n]...)
+		}
+		segStart = segEnd
+	}
+
+	size := float64(exact)
+	pages2 := newKeySpace(prefix, append([][]byte{first, last}, sample...), false)
+	for _, p := range partials {
+		segLo := pages2.position(p.start)
+		segHi := pages2.position(last) + 1
+		if !bytes.Equal(p.end, end) {
+			segHi = pages2.position(p.end)
+		}
+		covered := pages2.position(p.last) - segLo + 1
+		size += float64(p.size) * math.Max((segHi-segLo)/covered, 1)
+	}
+	return int64(size + 0.5), nil
+}
+
+// firstKey returns the first key of [start, end), ok is false if there is
+// none.
+func firstKey(scan scanFunc, start []byte, end []byte) (key []byte, ok bool, err error) {
+	keys, _, err := scan(start, 1)
+	if err != nil || len(keys) == 0 || bytes.Compare(keys[0], end) >= 0 {
+		return nil, false, err
+	}
+	return keys[0], true, nil
+}
+
+// lastKey returns the last key of [first, end). It is found a byte at a time,
+// searching the largest byte b such that a key of the range starts with the
+// bytes found and b with one pair scans.
+func lastKey(scan scanFunc, first []byte, end []byte) ([]byte, error) {
+	var prefix []byte
+	for {
+		// Whether a key of the range starts with prefix followed by a byte
+		// of at least b. The keys before first are not in the range.
+		probe := func(b int) (bool, error) {
+			from := append(append([]byte(nil), prefix...), byte(b))
+			if bytes.Compare(from, first) < 0 {
+				from = first
+			}
+			key, ok, err := firstKey(scan, from, end)
+			return ok && bytes.HasPrefix(key, prefix), err
+		}
+		if ok, err := probe(0); err != nil {
+			return nil, err
+		} else if !ok {
+			// No key is longer than prefix, it is the last key.
+			return prefix, nil
+		}
+		lo, hi := 0, 255
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			ok, err := probe(mid)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		prefix = append(prefix, byte(lo))
+	}
+}
+
+// keySpace maps the keys with a common prefix to numbers in the same order.
+// The bytes after the prefix are the digits of the number, each in the base
+// of the bytes seen at its place in a sample of the keys, so a key made of a
+// few symbols, like the decimal digits of the workload, spreads over the
+// numbers as evenly as over the keys, without the gaps of the other bytes. The
+// first unseen byte ends the number at the next seen byte, so the keys with an
+// unseen byte or a shorter key are in order but not apart.
+type keySpace struct {
+	prefix []byte
+	// alphabets are the bytes seen at each place, sorted, a byte is the digit
+	// of its index. The places past them have no digit.
+	alphabets [][]byte
+	// radixes are the numbers of digits of the places, at least 1.
+	radixes []float64
+}
+
+// newKeySpace returns the keySpace of the keys of the sample with the prefix,
+// with the bytes seen at any place at every place if global is set. The places
+// are limited so the numbers are exact floats.
+func newKeySpace(prefix []byte, sample [][]byte, global bool) *keySpace {
+	var seen [][256]bool
+	for _, key := range sample {
+		if !bytes.HasPrefix(key, prefix) {
+			continue
+		}
+		for i, b := range key[len(prefix):] {
+			if global {
+				i = 0
+			}
+			for len(seen) <= i {
+				seen = append(seen, [256]bool{})
+			}
+			seen[i][b] = true
+		}
+	}
+
+	ks := &keySpace{prefix: prefix}
+	places := len(seen)
+	if global {
+		places = math.MaxInt32
+	}
+	for max, i := 1.0, 0; i < places && len(seen) > 0; i++ {
+		place := &seen[0]
+		if !global {
+			place = &seen[i]
+		}
+		var alphabet []byte
+		for b, ok := range place {
+			if ok {
+				alphabet = append(alphabet, byte(b))
+			}
+		}
+		radix := math.Max(float64(len(alphabet)), 1)
+		if max*radix > 1<<53 || (global && radix == 1) {
+			break
+		}
+		max *= radix
+		ks.alphabets = append(ks.alphabets, alphabet)
+		ks.radixes = append(ks.radixes, radix)
+	}
+	return ks
+}
+
+// position returns the number of the key, which starts with the prefix.
+func (ks *keySpace) position(key []byte) float64 {
+	suffix := key[len(ks.prefix):]
+	var pos float64
+	ended := false
+	for i, alphabet := range ks.alphabets {
+		pos *= ks.radixes[i]
+		if ended || i >= len(suffix) {
+			continue
+		}
+		k := sort.Search(len(alphabet), func(j int) bool { return alphabet[j] >= suffix[i] })
+		if k == len(alphabet) || alphabet[k] != suffix[i] {
+			// An unseen byte is at the start of the next seen one.
+			ended = true
+		}
+		pos += float64(k)
+	}
+	return pos
+}
+
+// key returns the key of the position, the smaller keys have a position of at
+// most pos and the others of at least pos.
+func (ks *keySpace) key(pos float64) []byte {
+	digits := make([]int, len(ks.alphabets))
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := math.Mod(pos, ks.radixes[i])
+		digits[i] = int(d)
+		pos = (pos - d) / ks.radixes[i]
+	}
+
+	key := append([]byte(nil), ks.prefix...)
+	for i, d := range digits {
+		if d >= len(ks.alphabets[i]) {
+			break
+		}
+		key = append(key, ks.alphabets[i][d])
+	}
+	return key
+}
+
+func commonPrefixLen(a []byte, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/pingcap/go-ycsb/pkg/util"
+	"github.com/pingcap/tidb/kv"
+)
+
+// sortedPairs is a fake keyspace for the scans.
+type sortedPairs struct {
+	keys   [][]byte
+	values [][]byte
+	// scans counts the calls of scan.
+	scans int
+}
+
+func newSortedPairs(pairs map[string][]byte) *sortedPairs {
+	s := &sortedPairs{}
+	for k := range pairs {
+		s.keys = append(s.keys, []byte(k))
+	}
+	sort.Slice(s.keys, func(i, j int) bool { return bytes.Compare(s.keys[i], s.keys[j]) < 0 })
+	for _, k := range s.keys {
+		s.values = append(s.values, pairs[string(k)])
+	}
+	return s
+}
+
+func (s *sortedPairs) scan(start []byte, limit int) ([][]byte, [][]byte, error) {
+	s.scans++
+	i := sort.Search(len(s.keys), func(i int) bool { return bytes.Compare(s.keys[i], start) >= 0 })
+	j := i + limit
+	if j > len(s.keys) {
+		j = len(s.keys)
+	}
+	return s.keys[i:j], s.values[i:j], nil
+}
+
+// tableSize is the exact size of the pairs starting with prefix.
+func (s *sortedPairs) tableSize(prefix []byte) int64 {
+	var size int64
+	for i, k := range s.keys {
+		if bytes.HasPrefix(k, prefix) {
+			size += int64(len(k) + len(s.values[i]))
+		}
+	}
+	return size
+}
+
+// testDataset returns the rows of the keys in "usertable" with values of 50
+// to 150 bytes, next to the rows of two other tables.
+func testDataset(keys []string) *sortedPairs {
+	r := rand.New(rand.NewSource(1))
+	pairs := make(map[string][]byte, len(keys)+200)
+	for _, key := range keys {
+		pairs["usertable:"+key] = make([]byte, 50+r.Intn(101))
+	}
+	for i := 0; i < 100; i++ {
+		pairs[fmt.Sprintf("aaa:user%d", i)] = make([]byte, 1000)
+		pairs[fmt.Sprintf("zzz:user%d", i)] = make([]byte, 1000)
+	}
+	return newSortedPairs(pairs)
+}
+
+func TestSampleSize(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	uniform := make([]string, 50000)
+	hashed := make([]string, 50000)
+	ordered := make([]string, 50000)
+	for i := range uniform {
+		uniform[i] = fmt.Sprintf("user%d", int64(r.Uint64()))
+		hashed[i] = fmt.Sprintf("user%d", util.Hash64(int64(i)))
+		ordered[i] = fmt.Sprintf("user%08d", i)
+	}
+
+	tests := []struct {
+		name  string
+		keys  []string
+		pages int
+		// tolerance is the relative error allowed, 0 for an exact size.
+		tolerance float64
+	}{
+		{"empty", nil, 16, 0},
+		{"one row", []string{"user1"}, 16, 0},
+		{"one page", uniform[:100], 16, 0},
+		{"uniform", uniform, 64, 0.05},
+		// The FNV hashes of consecutive numbers are in arithmetic
+		// progressions, so the pages cover uneven shares of a segment.
+		{"workload hashes", hashed, 64, 0.2},
+		{"ordered", ordered, 64, 0.05},
+	}
+	for _, tt := range tests {
+		s := testDataset(tt.keys)
+		prefix := []byte("usertable:")
+		want := s.tableSize(prefix)
+		got, err := sampleSize(context.Background(), s.scan, prefix, kv.Key(prefix).PrefixNext(), tt.pages, 128)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if diff := float64(got - want); diff < -tt.tolerance*float64(want) || diff > tt.tolerance*float64(want) {
+			t.Errorf("%s: estimated %d bytes, want %d within %v", tt.name, got, want, tt.tolerance)
+		}
+		// The sample reads far fewer pairs than the full scan.
+		if maxScans := tt.pages + 9*40; s.scans > maxScans {
+			t.Errorf("%s: %d scans, want at most %d", tt.name, s.scans, maxScans)
+		}
+	}
+}
+
+func TestSampleSizeSmallIsExact(t *testing.T) {
+	// Any table of at most pages pages is read whole.
+	r := rand.New(rand.NewSource(3))
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user%d", int64(r.Uint64()))
+	}
+	s := testDataset(keys)
+	prefix := []byte("usertable:")
+	got, err := sampleSize(context.Background(), s.scan, prefix, kv.Key(prefix).PrefixNext(), 64, 1000)
+	if want := s.tableSize(prefix); err != nil || got != want {
+		t.Errorf("sampleSize = %d, %v, want %d", got, err, want)
+	}
+}
+
+func TestPairsSize(t *testing.T) {
+	s := testDataset([]string{"user1", "user2", "user3"})
+	prefix := []byte("usertable:")
+	got, err := pairsSize(newRawIterator(context.Background(), s.scan, prefix, kv.Key(prefix).PrefixNext()))
+	if want := s.tableSize(prefix); err != nil || got != want {
+		t.Errorf("pairsSize = %d, %v, want %d", got, err, want)
+	}
+}
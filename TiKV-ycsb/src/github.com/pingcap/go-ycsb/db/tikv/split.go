@@ -0,0 +1,106 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// errNoSplit is returned by PreSplit of the raw driver.
+var errNoSplit = errors.New("this TiKV raw client can not split regions, pre-split with the txn driver")
+
+// splitClient splits the region holding a key at the key, like the TiKV store
+// of the txn driver.
+type splitClient interface {
+	SplitRegion(splitKey kv.Key) error
+}
+
+// PreSplitKeys returns the n-1 keys splitting the keys starting with keyPrefix
+// into the n shards of ShardRange, as the split keys of PreSplit.
+func PreSplitKeys(keyPrefix string, n int) []string {
+	var keys []string
+	for i := 1; i < n; i++ {
+		keys = append(keys, shardBound(keyPrefix, n, i))
+	}
+	return keys
+}
+
+// splitRowKeys returns the row keys of table to split at, sorted: the start of
+// the table and the rows of splitKeys, which are logical keys encoded like the
+// keys of the rows.
+func (c *codec) splitRowKeys(table string, splitKeys []string) ([][]byte, error) {
+	rowKeys := make([][]byte, 0, len(splitKeys)+1)
+	rowKeys = append(rowKeys, c.appendTablePrefix(nil, table))
+	for _, key := range splitKeys {
+		rowKey, err := c.buildCheckedRowKey(table, key)
+		if err != nil {
+			return nil, err
+		}
+		rowKeys = append(rowKeys, rowKey)
+	}
+
+	sort.Slice(rowKeys, func(i, j int) bool {
+		return bytes.Compare(rowKeys[i], rowKeys[j]) < 0
+	})
+	return rowKeys, nil
+}
+
+// preSplit splits the regions at the row keys in order, a key which already
+// starts a region is skipped by the client.
+func preSplit(ctx context.Context, s splitClient, rowKeys [][]byte) error {
+	for _, rowKey := range rowKeys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.SplitRegion(rowKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PreSplit splits the regions of table before it is loaded, at the start of
+// the table and at the rows of splitKeys, so the first writes are not all sent
+// to one region. The split keys are logical keys like the keys of Insert, nil
+// only splits the table from the rest of the keyspace, PreSplitKeys returns
+// the keys of evenly sized shards.
+func (db *txnDB) PreSplit(ctx context.Context, table string, splitKeys []string) error {
+	s, ok := db.db.(splitClient)
+	if !ok {
+		return errors.New("this TiKV store can not split regions")
+	}
+
+	rowKeys, err := db.splitRowKeys(table, splitKeys)
+	if err != nil {
+		return err
+	}
+	return preSplit(ctx, s, rowKeys)
+}
+
+// PreSplit fails. The raw and txn drivers encode the rows the same way, so the
+// regions can be split with the txn driver before loading with the raw one.
+func (db *rawDB) PreSplit(ctx context.Context, table string, splitKeys []string) error {
+	return errNoSplit
+}
+
+// PreSplit splits the regions with the txn driver, the regions hold the rows
+// of both drivers.
+func (db *mixedDB) PreSplit(ctx context.Context, table string, splitKeys []string) error {
+	return db.txn.PreSplit(ctx, table, splitKeys)
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// splitStore is a memStore recording its splits, which fails the split at
+// failAt.
+type splitStore struct {
+	*memStore
+	failAt string
+	splits []string
+}
+
+func (s *splitStore) SplitRegion(splitKey kv.Key) error {
+	if string(splitKey) == s.failAt {
+		return errors.New("split failed")
+	}
+	s.splits = append(s.splits, string(splitKey))
+	return nil
+}
+
+func TestPreSplit(t *testing.T) {
+	tests := []struct {
+		kvs       []string
+		splitKeys []string
+		failAt    string
+		// want are the keys split at, err whether PreSplit fails.
+		want []string
+		err  bool
+	}{
+		{want: []string{"usertable:"}},
+		{splitKeys: []string{"user3", "user1", "user2"},
+			want: []string{"usertable:", "usertable:user1", "usertable:user2", "usertable:user3"}},
+		{kvs: []string{tikvRawKeyspacePrefix, "run1/"}, splitKeys: []string{"user1"},
+			want: []string{"run1/usertable:", "run1/usertable:user1"}},
+		// The split keys are encoded like the keys of the rows.
+		{kvs: []string{tikvRawReverseKey, "true"}, splitKeys: []string{"user12", "user21"},
+			want: []string{"usertable:", "usertable:12resu", "usertable:21resu"}},
+		{kvs: []string{tikvRawMaxKeyBytes, "16"}, splitKeys: []string{"user1", "user0123456789abcdef"}, err: true},
+		{splitKeys: []string{"user1", "user2"}, failAt: "usertable:user1",
+			want: []string{"usertable:"}, err: true},
+	}
+	for _, tt := range tests {
+		db, m := newTestTxnDB(t, tt.kvs...)
+		s := &splitStore{memStore: m, failAt: tt.failAt}
+		db.db = s
+		err := db.PreSplit(context.Background(), "usertable", tt.splitKeys)
+		if (err != nil) != tt.err || !reflect.DeepEqual(s.splits, tt.want) {
+			t.Errorf("%v: PreSplit(%q) split at %q, %v, want %q", tt.kvs, tt.splitKeys, s.splits, err, tt.want)
+		}
+
+		// The mixed driver splits with the txn driver.
+		if !tt.err {
+			s.splits = nil
+			raw, _ := newTestRawDB(t, tt.kvs...)
+			mixed := &mixedDB{raw: raw, txn: db}
+			if err := mixed.PreSplit(context.Background(), "usertable", tt.splitKeys); err != nil || !reflect.DeepEqual(s.splits, tt.want) {
+				t.Errorf("%v: mixed PreSplit(%q) split at %q, %v, want %q", tt.kvs, tt.splitKeys, s.splits, err, tt.want)
+			}
+			if err := raw.PreSplit(context.Background(), "usertable", tt.splitKeys); err != errNoSplit {
+				t.Errorf("%v: raw PreSplit: err %v, want %v", tt.kvs, err, errNoSplit)
+			}
+		}
+	}
+
+	db, m := newTestTxnDB(t)
+	if err := db.PreSplit(context.Background(), "usertable", nil); err == nil {
+		t.Error("PreSplit with a store which can not split succeeded")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := &splitStore{memStore: m}
+	db.db = s
+	if err := db.PreSplit(ctx, "usertable", []string{"user1"}); err != context.Canceled || len(s.splits) != 0 {
+		t.Errorf("PreSplit of a canceled context split at %q, %v", s.splits, err)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The latency histograms of the vendored clients, labeled by the type.
+const (
+	tikvRequestMetric = "tidb_tikvclient_request_seconds"
+	pdCmdMetric       = "pd_client_cmd_handle_cmds_duration_seconds"
+)
+
+// stats holds the named counters of a driver, it is safe for concurrent use.
+type stats struct {
+	sync.RWMutex
+
+	counters map[string]*int64
+}
+
+func newStats() *stats {
+	return &stats{counters: make(map[string]*int64, 16)}
+}
+
+func (s *stats) add(name string, n int64) {
+	s.RLock()
+	c, ok := s.counters[name]
+	s.RUnlock()
+
+	if !ok {
+		s.Lock()
+		if c, ok = s.counters[name]; !ok {
+			c = new(int64)
+			s.counters[name] = c
+		}
+		s.Unlock()
+	}
+
+	atomic.AddInt64(c, n)
+}
+
+// snapshot returns a copy of the current counter values.
+func (s *stats) snapshot() map[string]int64 {
+	s.RLock()
+	defer s.RUnlock()
+
+	m := make(map[string]int64, len(s.counters))
+	for name, c := range s.counters {
+		m[name] = atomic.LoadInt64(c)
+	}
+	return m
+}
+
+// reset zeroes all the counters.
+func (s *stats) reset() {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, c := range s.counters {
+		atomic.StoreInt64(c, 0)
+	}
+}
+
+// metricLatency reports a latency histogram kept by the vendored clients in
+// the prometheus metrics, relative to the time it was created.
+type metricLatency struct {
+	metric string
+	// reqType is the value of the "type" label of the histogram.
+	reqType string
+	base    latencySample
+}
+
+// latencySample is the sum of the histograms with the same type, the buckets
+// are cumulative counts by the upper bound in seconds.
+type latencySample struct {
+	count   uint64
+	sum     float64
+	bounds  []float64
+	buckets []uint64
+}
+
+func newMetricLatency(metric string, reqType string) (*metricLatency, error) {
+	base, err := gatherLatency(metric, reqType)
+	if err != nil {
+		return nil, err
+	}
+	return &metricLatency{metric: metric, reqType: reqType, base: base}, nil
+}
+
+// addTo puts the count, the average, the 95th and the 99th percentile latency
+// in microseconds in m with the given name prefix. The percentiles are the
+// upper bounds of the histogram buckets, so they are coarse.
+func (l *metricLatency) addTo(m map[string]int64, name string) error {
+	cur, err := gatherLatency(l.metric, l.reqType)
+	if err != nil {
+		return err
+	}
+
+	count := cur.count - l.base.count
+	m[name+".count"] = int64(count)
+	m[name+".avg_us"] = 0
+	m[name+".p95_us"] = 0
+	m[name+".p99_us"] = 0
+	if count == 0 {
+		return nil
+	}
+
+	m[name+".avg_us"] = int64((cur.sum - l.base.sum) * 1e6 / float64(count))
+	m[name+".p95_us"] = l.percentile(cur, count, 0.95)
+	m[name+".p99_us"] = l.percentile(cur, count, 0.99)
+	return nil
+}
+
+func (l *metricLatency) percentile(cur latencySample, count uint64, q float64) int64 {
+	want := uint64(q * float64(count))
+	for i, bound := range cur.bounds {
+		n := cur.buckets[i]
+		if i < len(l.base.buckets) {
+			n -= l.base.buckets[i]
+		}
+		if n >= want {
+			return int64(bound * 1e6)
+		}
+	}
+	// Beyond the last bucket, the best bound is the last one.
+	if len(cur.bounds) == 0 {
+		return 0
+	}
+	return int64(cur.bounds[len(cur.bounds)-1] * 1e6)
+}
+
+func gatherLatency(metric string, reqType string) (latencySample, error) {
+	samples, err := gatherHistograms(metric)
+	if err != nil {
+		return latencySample{}, err
+	}
+	return samples[reqType], nil
+}
+
+// gatherHistograms returns the histograms of the metric by their "type" label.
+func gatherHistograms(metric string) (map[string]latencySample, error) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make(map[string]latencySample)
+	for _, family := range families {
+		if family.GetName() != metric {
+			continue
+		}
+
+		// The histogram may also be labeled by the store, sum them all.
+		for _, m := range family.GetMetric() {
+			reqType := labelValue(m.GetLabel(), "type")
+			sample := samples[reqType]
+			h := m.GetHistogram()
+			sample.count += h.GetSampleCount()
+			sample.sum += h.GetSampleSum()
+			for i, b := range h.GetBucket() {
+				if i == len(sample.buckets) {
+					sample.bounds = append(sample.bounds, b.GetUpperBound())
+					sample.buckets = append(sample.buckets, 0)
+				}
+				sample.buckets[i] += b.GetCumulativeCount()
+			}
+			samples[reqType] = sample
+		}
+	}
+	return samples, nil
+}
+
+func labelValue(labels []*dto.LabelPair, name string) string {
+	for _, label := range labels {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,258 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pingcap/go-ycsb/pkg/ycsb"
+)
+
+// properties
+const (
+	// tikvRawFlushInterval bounds the time a record of StreamInsert is kept
+	// before it is written, 0 writes the records once a batch is full.
+	tikvRawFlushInterval = "tikv.raw.flushInterval"
+)
+
+const (
+	// streamBatchRows is the number of records StreamInsert keeps before
+	// writing them with one BatchInsert.
+	streamBatchRows = 256
+	// maxStreamRecord bounds a record of StreamInsert, so a stream without
+	// newlines can not take all the memory.
+	maxStreamRecord = 64 << 20
+)
+
+// StreamParseFunc parses a record of StreamInsert into the key and the values
+// of a row. The record is owned by the row, so the values may share it.
+type StreamParseFunc func(record []byte) (key string, values map[string][]byte, err error)
+
+// streamRecord is a record of StreamInsert and its line.
+type streamRecord struct {
+	line   int64
+	record []byte
+}
+
+// streamSet keeps the cancel functions of the running StreamInserts of a
+// driver, so Close stops them. The zero value is empty.
+type streamSet struct {
+	mu      sync.Mutex
+	next    int
+	cancels map[int]context.CancelFunc
+	closed  bool
+	running sync.WaitGroup
+}
+
+// begin returns the context of a StreamInsert, cancelled by stop, and the
+// function the StreamInsert calls once it returns.
+func (s *streamSet) begin(ctx context.Context) (context.Context, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, nil, fmt.Errorf("stream insert on a closed driver")
+	}
+	if s.cancels == nil {
+		s.cancels = make(map[int]context.CancelFunc)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	id := s.next
+	s.next++
+	s.cancels[id] = cancel
+	s.running.Add(1)
+	return ctx, func() {
+		s.mu.Lock()
+		delete(s.cancels, id)
+		s.mu.Unlock()
+		cancel()
+		s.running.Done()
+	}, nil
+}
+
+// stop cancels the running StreamInserts and waits for them to return. With
+// closed no StreamInsert begins afterwards.
+func (s *streamSet) stop(closed bool) {
+	s.mu.Lock()
+	s.closed = s.closed || closed
+	for _, cancel := range s.cancels {
+		cancel()
+	}
+	s.mu.Unlock()
+	s.running.Wait()
+}
+
+// beginStream begins a StreamInsert in the set of the driver and in the one
+// of the thread, so both Close and CleanupThread stop it.
+func beginStream(ctx context.Context, s *streamSet) (context.Context, func(), error) {
+	ctx, end, err := s.begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	state := threadStateOf(ctx)
+	if state == nil || state.streams == nil {
+		return ctx, end, nil
+	}
+	ctx, threadEnd, err := state.streams.begin(ctx)
+	if err != nil {
+		end()
+		return nil, nil, err
+	}
+	return ctx, func() {
+		threadEnd()
+		end()
+	}, nil
+}
+
+// streamInsert reads the newline separated records of r and inserts them with
+// db.BatchInsert, streamBatchRows at a time. A non zero interval also writes
+// the records kept every interval, so a slow reader does not hold them back.
+func streamInsert(ctx context.Context, db ycsb.BatchDB, table string, r io.Reader, parse StreamParseFunc, interval time.Duration) (int64, error) {
+	keys := make([]string, 0, streamBatchRows)
+	rows := make([]map[string][]byte, 0, streamBatchRows)
+	var n int64
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		if err := db.BatchInsert(ctx, table, keys, rows); err != nil {
+			return err
+		}
+		n += int64(len(keys))
+		keys, rows = keys[:0], rows[:0]
+		return nil
+	}
+	add := func(rec streamRecord) error {
+		key, values, err := parse(rec.record)
+		if err != nil {
+			return fmt.Errorf("stream insert of table %s: line %d: %v", table, rec.line, err)
+		}
+		keys, rows = append(keys, key), append(rows, values)
+		if len(keys) == streamBatchRows {
+			return flush()
+		}
+		return nil
+	}
+
+	// The records are read by another goroutine, so a cancelled ctx and the
+	// ticker are seen while the reader blocks. It never outlives the call: on
+	// return r is closed if it is an io.Closer, so a blocked read returns, and
+	// the reader is waited for.
+	records := make(chan streamRecord)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	var reader sync.WaitGroup
+	reader.Add(1)
+	defer func() {
+		close(done)
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		reader.Wait()
+	}()
+	go func() {
+		defer reader.Done()
+		defer close(records)
+		sc := newStreamScanner(r)
+		for line := int64(1); sc.Scan(); line++ {
+			if len(sc.Bytes()) == 0 {
+				continue
+			}
+			select {
+			case records <- streamRecord{line: line, record: append([]byte(nil), sc.Bytes()...)}:
+			case <-done:
+				return
+			}
+		}
+		readErr <- sc.Err()
+	}()
+
+	// Without an interval tick stays nil, so only full batches are written.
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		case <-tick:
+			if err := flush(); err != nil {
+				return n, err
+			}
+		case rec, ok := <-records:
+			if !ok {
+				if err := <-readErr; err != nil {
+					return n, err
+				}
+				return n, flush()
+			}
+			if err := add(rec); err != nil {
+				return n, err
+			}
+		}
+	}
+}
+
+func newStreamScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxStreamRecord)
+	return sc
+}
+
+// StreamInsert inserts the records read from r into the table and returns the
+// number of records inserted, for loading datasets which do not fit in
+// memory. The records are separated by newlines, empty lines are skipped, and
+// parse turns a record into a row, so any record format can be loaded. Only
+// streamBatchRows records are kept at a time, each batch is written with
+// BatchInsert, and the batches before a failed one stay inserted. With
+// tikvRawFlushInterval the records kept are also written every interval. The
+// records are read by a goroutine, StreamInsert closes r if it is an
+// io.Closer before it returns and waits for the read in flight, so r must be
+// closable if it may block. Close and CleanupThread stop a running
+// StreamInsert, even one blocked in a read of r.
+func (db *rawDB) StreamInsert(ctx context.Context, table string, r io.Reader, parse StreamParseFunc) (int64, error) {
+	ctx, end, err := beginStream(ctx, &db.streams)
+	if err != nil {
+		return 0, err
+	}
+	defer end()
+	return streamInsert(ctx, db, table, r, parse, db.cfg.FlushInterval)
+}
+
+// StreamInsert is rawDB.StreamInsert.
+func (db *txnDB) StreamInsert(ctx context.Context, table string, r io.Reader, parse StreamParseFunc) (int64, error) {
+	ctx, end, err := beginStream(ctx, &db.streams)
+	if err != nil {
+		return 0, err
+	}
+	defer end()
+	return streamInsert(ctx, db, table, r, parse, db.flushInterval)
+}
+
+// StreamInsert is rawDB.StreamInsert, each batch is routed like an insert.
+func (db *mixedDB) StreamInsert(ctx context.Context, table string, r io.Reader, parse StreamParseFunc) (int64, error) {
+	ctx, end, err := beginStream(ctx, &db.raw.streams)
+	if err != nil {
+		return 0, err
+	}
+	defer end()
+	return streamInsert(ctx, db, table, r, parse, db.raw.cfg.FlushInterval)
+}
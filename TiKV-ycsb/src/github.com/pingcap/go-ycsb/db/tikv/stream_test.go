@@ -0,0 +1,266 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRecorder is a ycsb.BatchDB keeping the batches inserted.
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]string
+	rows    map[string]map[string][]byte
+	// inserted receives the size of each batch if it is not nil.
+	inserted chan int
+}
+
+func (db *batchRecorder) BatchRead(ctx context.Context, table string, keys []string, fields []string) ([]map[string][]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	rows := make([]map[string][]byte, len(keys))
+	for i, key := range keys {
+		rows[i] = db.rows[key]
+	}
+	return rows, nil
+}
+
+func (db *batchRecorder) BatchInsert(ctx context.Context, table string, keys []string, values []map[string][]byte) error {
+	db.mu.Lock()
+	db.batches = append(db.batches, append([]string(nil), keys...))
+	if db.rows == nil {
+		db.rows = make(map[string]map[string][]byte)
+	}
+	for i, key := range keys {
+		db.rows[key] = values[i]
+	}
+	db.mu.Unlock()
+	if db.inserted != nil {
+		db.inserted <- len(keys)
+	}
+	return nil
+}
+
+func (db *batchRecorder) sizes() []int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	sizes := make([]int, len(db.batches))
+	for i, b := range db.batches {
+		sizes[i] = len(b)
+	}
+	return sizes
+}
+
+// parseKeyValue parses "key=value" into a row with a field "f".
+func parseKeyValue(record []byte) (string, map[string][]byte, error) {
+	i := strings.IndexByte(string(record), '=')
+	if i < 0 {
+		return "", nil, fmt.Errorf("no '=' in %q", record)
+	}
+	return string(record[:i]), map[string][]byte{"f": record[i+1:]}, nil
+}
+
+func streamRecords(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "user%d=%d\n", i, i)
+		if i%100 == 0 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func TestStreamInsertBatches(t *testing.T) {
+	tests := []struct {
+		records int
+		want    []int
+	}{
+		{0, []int{}},
+		{3, []int{3}},
+		{streamBatchRows, []int{streamBatchRows}},
+		{streamBatchRows + 44, []int{streamBatchRows, 44}},
+	}
+	for _, interval := range []time.Duration{0, time.Hour} {
+		for _, tt := range tests {
+			db := &batchRecorder{}
+			n, err := streamInsert(context.Background(), db, "t", strings.NewReader(streamRecords(tt.records)), parseKeyValue, interval)
+			if err != nil {
+				t.Fatalf("interval %s, %d records: %v", interval, tt.records, err)
+			}
+			if n != int64(tt.records) || !reflect.DeepEqual(db.sizes(), tt.want) {
+				t.Errorf("interval %s, %d records: inserted %d in %v, want %v", interval, tt.records, n, db.sizes(), tt.want)
+			}
+		}
+	}
+}
+
+func TestStreamInsertParseError(t *testing.T) {
+	for _, interval := range []time.Duration{0, time.Hour} {
+		db := &batchRecorder{}
+		r := strings.NewReader("a=1\n\nb=2\nbad\nc=3\n")
+		n, err := streamInsert(context.Background(), db, "t", r, parseKeyValue, interval)
+		if err == nil || !strings.Contains(err.Error(), "line 4") {
+			t.Errorf("interval %s: err %v, want an error of line 4", interval, err)
+		}
+		if n != 0 || len(db.sizes()) != 0 {
+			t.Errorf("interval %s: inserted %d in %v before the partial batch failed", interval, n, db.sizes())
+		}
+	}
+}
+
+func TestStreamInsertFlushInterval(t *testing.T) {
+	pr, pw := io.Pipe()
+	db := &batchRecorder{inserted: make(chan int, 4)}
+	type result struct {
+		n   int64
+		err error
+	}
+	res := make(chan result, 1)
+	go func() {
+		n, err := streamInsert(context.Background(), db, "t", pr, parseKeyValue, 10*time.Millisecond)
+		res <- result{n, err}
+	}()
+
+	// The writer stalls after 3 records, the partial batch is written by the
+	// timer.
+	io.WriteString(pw, "a=1\nb=2\nc=3\n")
+	select {
+	case size := <-db.inserted:
+		if size != 3 {
+			t.Fatalf("flushed a batch of %d, want 3", size)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the partial batch was not flushed while the reader blocked")
+	}
+
+	io.WriteString(pw, "d=4\n")
+	pw.Close()
+	r := <-res
+	if r.err != nil || r.n != 4 {
+		t.Fatalf("inserted %d, err %v, want 4", r.n, r.err)
+	}
+	if got := db.sizes(); !reflect.DeepEqual(got, []int{3, 1}) {
+		t.Errorf("batches %v, want [3 1]", got)
+	}
+}
+
+func TestStreamInsertStopsReader(t *testing.T) {
+	for _, interval := range []time.Duration{0, time.Hour} {
+		pr, pw := io.Pipe()
+		db := &batchRecorder{}
+		res := make(chan error, 1)
+		go func() {
+			_, err := streamInsert(context.Background(), db, "t", pr, parseKeyValue, interval)
+			res <- err
+		}()
+
+		io.WriteString(pw, "bad\n")
+		if err := <-res; err == nil {
+			t.Fatalf("interval %s: inserted a record which does not parse", interval)
+		}
+		// The reader was stopped by closing r, nothing reads the pipe anymore.
+		if _, err := io.WriteString(pw, "a=1\n"); err != io.ErrClosedPipe {
+			t.Errorf("interval %s: write after the early return: err %v, want %v", interval, err, io.ErrClosedPipe)
+		}
+	}
+}
+
+func TestStreamSetStop(t *testing.T) {
+	// stop is called by Close with closed and by CleanupThread without it,
+	// the read of the StreamInsert blocks with and without an interval.
+	for _, tt := range []struct {
+		closed   bool
+		interval time.Duration
+	}{{true, 0}, {false, 0}, {true, time.Hour}, {false, time.Hour}} {
+		closed := tt.closed
+		var s streamSet
+		ctx := withThreadState(context.Background())
+		thread := threadStateOf(ctx).streams
+		pr, _ := io.Pipe()
+		res := make(chan error, 1)
+		go func() {
+			ctx, end, err := beginStream(ctx, &s)
+			if err != nil {
+				res <- err
+				return
+			}
+			defer end()
+			_, err = streamInsert(ctx, &batchRecorder{}, "t", pr, parseKeyValue, tt.interval)
+			res <- err
+		}()
+
+		// Wait for the StreamInsert to begin in both sets.
+		for !streamRunning(&s) || !streamRunning(thread) {
+			time.Sleep(time.Millisecond)
+		}
+		if closed {
+			s.stop(true)
+		} else {
+			cleanupThreadState(ctx)
+		}
+		if err := <-res; err != context.Canceled {
+			t.Errorf("closed %v, interval %s: err %v, want %v", closed, tt.interval, err, context.Canceled)
+		}
+
+		_, _, err := beginStream(context.Background(), &s)
+		if closed != (err != nil) {
+			t.Errorf("closed %v, interval %s: begin after stop: err %v", closed, tt.interval, err)
+		}
+	}
+}
+
+func streamRunning(s *streamSet) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.cancels) > 0
+}
+
+// Close of a driver with the default flush interval stops a StreamInsert
+// blocked in a read.
+func TestStreamInsertClose(t *testing.T) {
+	db, _ := newTestRawDB(t)
+	pr, pw := io.Pipe()
+	res := make(chan error, 1)
+	go func() {
+		_, err := db.StreamInsert(context.Background(), "usertable", pr, parseKeyValue)
+		res <- err
+	}()
+
+	// The first record is read, the read of the next one blocks.
+	io.WriteString(pw, "user1=a\n")
+	for !streamRunning(&db.streams) {
+		time.Sleep(time.Millisecond)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- db.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hung on the StreamInsert blocked in a read")
+	}
+	if err := <-res; err != context.Canceled {
+		t.Errorf("StreamInsert: err %v, want %v", err, context.Canceled)
+	}
+}
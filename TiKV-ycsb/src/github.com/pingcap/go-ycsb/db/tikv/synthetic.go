@@ -0,0 +1,85 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/pingcap/go-ycsb/pkg/util"
+	"github.com/pingcap/go-ycsb/pkg/ycsb"
+)
+
+// properties
+const (
+	// tikvRawSyntheticSeed seeds the values of LoadSynthetic, so a load can be
+	// repeated with the same data.
+	tikvRawSyntheticSeed = "tikv.raw.syntheticSeed"
+)
+
+// loadSynthetic inserts count rows with random values of valueSize bytes into
+// the table, streamBatchRows at a time with db.BatchInsert.
+func loadSynthetic(ctx context.Context, db ycsb.BatchDB, fields []string, table string, count int, valueSize int, seed int64) error {
+	if count < 0 || valueSize < 0 {
+		return fmt.Errorf("count and value size must not be negative, got %d and %d", count, valueSize)
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	keys := make([]string, 0, streamBatchRows)
+	rows := make([]map[string][]byte, 0, streamBatchRows)
+	for i := 0; i < count; i++ {
+		// The keys are hashed like the unordered inserts of the core workload.
+		keys = append(keys, fmt.Sprintf("user%d", util.Hash64(int64(i))))
+		row := make(map[string][]byte, len(fields))
+		for _, field := range fields {
+			value := make([]byte, valueSize)
+			util.RandBytes(r, value)
+			row[field] = value
+		}
+		rows = append(rows, row)
+
+		if len(keys) == streamBatchRows || i == count-1 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := db.BatchInsert(ctx, table, keys, rows); err != nil {
+				return err
+			}
+			keys, rows = keys[:0], rows[:0]
+		}
+	}
+	return nil
+}
+
+// LoadSynthetic inserts count rows into the table, with every field set to a
+// random value of valueSize bytes, to populate a table for a quick experiment
+// without the YCSB workload. The keys are user<n> hashed like the default
+// inserts of the core workload, the values are seeded by
+// tikvRawSyntheticSeed, so the same call loads the same rows. The rows are
+// written with BatchInsert, so they are encoded like the loaded ones, and the
+// batches before a failed one stay inserted.
+func (db *rawDB) LoadSynthetic(ctx context.Context, table string, count int, valueSize int) error {
+	return loadSynthetic(ctx, db, db.tableCodec(table).fields, table, count, valueSize, db.cfg.SyntheticSeed)
+}
+
+// LoadSynthetic is rawDB.LoadSynthetic.
+func (db *txnDB) LoadSynthetic(ctx context.Context, table string, count int, valueSize int) error {
+	return loadSynthetic(ctx, db, db.fields, table, count, valueSize, db.seed)
+}
+
+// LoadSynthetic is rawDB.LoadSynthetic, each batch is routed like an insert.
+func (db *mixedDB) LoadSynthetic(ctx context.Context, table string, count int, valueSize int) error {
+	return loadSynthetic(ctx, db, db.raw.tableCodec(table).fields, table, count, valueSize, db.raw.cfg.SyntheticSeed)
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/go-ycsb/pkg/prop"
+)
+
+// properties
+const (
+	// tikvRawTablePrefix starts the overrides of the layout of a table, like
+	// tikv.raw.table.usertable.encoding for tikv.raw.encoding, or
+	// tikv.raw.table.usertable.fieldcount for fieldcount. Only the raw driver
+	// supports them.
+	tikvRawTablePrefix = "tikv.raw.table."
+)
+
+// tableProps maps the suffix of a table override to the layout property it
+// overrides.
+var tableProps = map[string]string{
+	prop.FieldCount:         prop.FieldCount,
+	prop.FieldLength:        prop.FieldLength,
+	"saltBuckets":           tikvRawSaltBuckets,
+	"saltHash":              tikvRawSaltHash,
+	"reverseKey":            tikvRawReverseKey,
+	"keyspacePrefix":        tikvRawKeyspacePrefix,
+	"rowKeyCacheSize":       tikvRawRowKeyCacheSize,
+	"compositeKeyFields":    tikvRawCompositeKeyFields,
+	"maxKeyBytes":           tikvRawMaxKeyBytes,
+	"truncateLongKeys":      tikvRawTruncateLongKeys,
+	"keyDecode":             tikvRawKeyDecode,
+	"scanDecodeParallelism": tikvRawScanDecodeParallelism,
+	"encodeWorkers":         tikvRawEncodeWorkers,
+	"missingFields":         tikvRawMissingFields,
+	"tidbCompat":            tikvRawTiDBCompat,
+	"tidbTableID":           tikvRawTiDBTableID,
+	"hotFraction":           tikvRawHotFraction,
+	"hotRange":              tikvRawHotRange,
+	"encoding":              tikvRawEncoding,
+}
+
+// tableLayouts parses the tikvRawTablePrefix overrides. The layout of a table
+// is the global layout with the overrides of the table, nil if there are no
+// overrides.
+func tableLayouts(p *properties.Properties, errs *configError) map[string]LayoutConfig {
+	overrides := make(map[string]*properties.Properties)
+	for _, key := range p.Keys() {
+		if !strings.HasPrefix(key, tikvRawTablePrefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, tikvRawTablePrefix)
+		i := strings.LastIndexByte(name, '.')
+		if i <= 0 {
+			errs.addf("invalid %s, must be %s<table>.<property>", key, tikvRawTablePrefix)
+			continue
+		}
+
+		table, suffix := name[:i], name[i+1:]
+		layoutProp, ok := tableProps[suffix]
+		if !ok {
+			errs.addf("%s can not be set per table", key)
+			continue
+		}
+
+		tp, ok := overrides[table]
+		if !ok {
+			tp = properties.NewProperties()
+			tp.Merge(p)
+			overrides[table] = tp
+		}
+		tp.Set(layoutProp, p.GetString(key, ""))
+	}
+
+	if len(overrides) == 0 {
+		return nil
+	}
+	tables := make(map[string]LayoutConfig, len(overrides))
+	for table, tp := range overrides {
+		tables[table] = layoutConfig(tp)
+	}
+	return tables
+}
+
+// validateTables validates the layout of every table, the problems are
+// prefixed with the table.
+func validateTables(tables map[string]LayoutConfig, errs *configError) {
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+
+	for _, table := range names {
+		var tableErrs configError
+		tables[table].validate(&tableErrs)
+		for _, e := range tableErrs {
+			errs.addf("table %s: %s", table, e)
+		}
+	}
+}
+
+// newTableCodecs creates the codecs of the tables with a layout override.
+func newTableCodecs(tables map[string]LayoutConfig) (map[string]*codec, error) {
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	codecs := make(map[string]*codec, len(tables))
+	for table, cfg := range tables {
+		c, err := newLayoutCodec(cfg)
+		if err != nil {
+			return nil, err
+		}
+		codecs[table] = c
+	}
+	return codecs, nil
+}
+
+// tableCodec returns the codec of the table, the one of the driver unless the
+// table has a layout override.
+func (db *rawDB) tableCodec(table string) *codec {
+	if c, ok := db.tables[table]; ok {
+		return c
+	}
+	return db.codec
+}
+
+// tableLayout returns the layout of the table, with its overrides.
+func (db *rawDB) tableLayout(table string) LayoutConfig {
+	if cfg, ok := db.cfg.Tables[table]; ok {
+		return cfg
+	}
+	return db.cfg.LayoutConfig
+}
+
+// RowKey returns the exact key the row is stored under, with the layout of
+// the table.
+func (db *rawDB) RowKey(table string, key string) ([]byte, error) {
+	return db.tableCodec(table).RowKey(table, key)
+}
+
+// checkNoTableLayouts fails the drivers which encode every table the same
+// way, like the txn driver.
+func checkNoTableLayouts(p *properties.Properties) error {
+	for _, key := range p.Keys() {
+		if strings.HasPrefix(key, tikvRawTablePrefix) {
+			return fmt.Errorf("%s is set, but the %s<table>.<property> overrides are only supported by the raw driver", key, tikvRawTablePrefix)
+		}
+	}
+	return nil
+}
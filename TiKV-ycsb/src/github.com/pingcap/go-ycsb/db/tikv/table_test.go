@@ -0,0 +1,120 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties"
+)
+
+func TestTableLayouts(t *testing.T) {
+	tests := []struct {
+		kvs []string
+		// want maps the tables to their field count, encoding and reverse
+		// key, nil if there are no overrides.
+		want map[string][3]string
+		// errs are in the errors, in order.
+		errs []string
+	}{
+		{kvs: []string{"fieldcount", "3"}},
+		{kvs: []string{"fieldcount", "10", tikvRawTablePrefix + "usertable.fieldcount", "3"},
+			want: map[string][3]string{"usertable": {"3", "tablecodec", "false"}}},
+		// An override keeps the global values of the other properties.
+		{kvs: []string{tikvRawReverseKey, "true", tikvRawTablePrefix + "usertable.encoding", "json",
+			tikvRawTablePrefix + "other.reverseKey", "false"},
+			want: map[string][3]string{"usertable": {"10", "json", "true"}, "other": {"10", "tablecodec", "false"}}},
+		// The table is everything up to the last dot.
+		{kvs: []string{tikvRawTablePrefix + "my.table.encoding", "msgpack"},
+			want: map[string][3]string{"my.table": {"10", "msgpack", "false"}}},
+		{kvs: []string{tikvRawTablePrefix + "usertable", "json", tikvRawTablePrefix + "usertable.pd", "x"},
+			errs: []string{"invalid tikv.raw.table.usertable,", "tikv.raw.table.usertable.pd can not be set per table"}},
+	}
+	for _, tt := range tests {
+		p := properties.NewProperties()
+		for i := 0; i+1 < len(tt.kvs); i += 2 {
+			p.Set(tt.kvs[i], tt.kvs[i+1])
+		}
+		var errs configError
+		tables := tableLayouts(p, &errs)
+
+		if len(errs) != len(tt.errs) {
+			t.Errorf("%v: errors %q, want %q", tt.kvs, errs, tt.errs)
+		}
+		for i := 0; i < len(errs) && i < len(tt.errs); i++ {
+			if !strings.Contains(errs[i], tt.errs[i]) {
+				t.Errorf("%v: error %q, want %q", tt.kvs, errs[i], tt.errs[i])
+			}
+		}
+
+		var got map[string][3]string
+		for table, cfg := range tables {
+			if got == nil {
+				got = make(map[string][3]string)
+			}
+			got[table] = [3]string{fmt.Sprint(cfg.FieldCount), cfg.Encoding, fmt.Sprint(cfg.ReverseKey)}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: layouts %v, want %v", tt.kvs, got, tt.want)
+		}
+	}
+}
+
+func TestTableOverrides(t *testing.T) {
+	ctx := context.Background()
+	db, m := newTestRawDB(t, tikvRawMissingFields, "error", tikvRawTablePrefix+"usertable.reverseKey", "true",
+		tikvRawTablePrefix+"usertable.encoding", "json", tikvRawTablePrefix+"usertable.fieldcount", "2")
+	values := map[string][]byte{"field0": []byte("a"), "field1": []byte("b")}
+	if err := db.Insert(ctx, "usertable", "user1", values); err != nil {
+		t.Fatal(err)
+	}
+	if row, err := db.Read(ctx, "usertable", "user1", nil); err != nil || !sameRow(row, values) {
+		t.Errorf("Read = %q, %v, want %q", row, err, values)
+	}
+	// The other tables keep the 10 fields.
+	if err := db.Insert(ctx, "other", "user1", values); err == nil || !strings.Contains(err.Error(), "field9") {
+		t.Errorf("insert of 2 fields into a table of 10: err %v", err)
+	}
+	values = map[string][]byte{}
+	for _, field := range db.codec.fields {
+		values[field] = []byte("c")
+	}
+	if err := db.Insert(ctx, "other", "user1", values); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys, want := m.keys(), []string{"other:user1", "usertable:1resu"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("stored the keys %q, want %q", keys, want)
+	}
+	if row := m.pairs["usertable:1resu"]; !strings.HasPrefix(string(row), "{") {
+		t.Errorf("stored the row %q of usertable, want json", row)
+	}
+	if row := m.pairs["other:user1"]; strings.HasPrefix(string(row), "{") {
+		t.Errorf("stored the row %q of other as json", row)
+	}
+
+	p := properties.NewProperties()
+	p.Set(tikvPD, "127.0.0.1:2379")
+	p.Set(tikvRawTablePrefix+"usertable.saltBuckets", "-1")
+	if err := Validate(p); err == nil || !strings.Contains(err.Error(), "table usertable: "+tikvRawSaltBuckets) {
+		t.Errorf("Validate of a bad override: err %v", err)
+	}
+	if err := checkNoTableLayouts(p); err == nil {
+		t.Error("checkNoTableLayouts accepted an override")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+
+	"github.com/pingcap/tidb/util/kvcache"
+)
+
+// contextKey is the type of the context keys of the drivers, they are
+// unexported so they never collide with the keys of other packages.
+type contextKey string
+
+const (
+	// threadStateKey keeps the *threadState put by InitThread.
+	threadStateKey = contextKey("tikvThread")
+	// txnKey keeps the kv.Transaction started by RunInTxn.
+	txnKey = contextKey("tikvTxn")
+)
+
+// threadState is the state of a thread, only used by the thread itself. The
+// drivers share it, so in "mixed" mode both see the same state.
+type threadState struct {
+	// writes is nil if tikvRawReadYourWrites is disabled. It maps the row key
+	// to the *keptRow of the last write.
+	writes *kvcache.SimpleLRUCache
+	// scanFree is the largest scan result released by the thread, its rows
+	// are all nil. It is taken by the next scan, so it is never handed out
+	// twice.
+	scanFree []map[string][]byte
+	// streams are the running StreamInserts of the thread, stopped by
+	// CleanupThread. It is nil once the thread is cleaned up.
+	streams *streamSet
+}
+
+// keptRow is a row written by the thread, nil if the row is deleted. The LRU
+// cache never replaces the value of a key, so a later write updates it.
+type keptRow struct {
+	row []byte
+}
+
+// withThreadState returns ctx with a threadState, unless it already has one.
+func withThreadState(ctx context.Context) context.Context {
+	if threadStateOf(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, threadStateKey, &threadState{streams: &streamSet{}})
+}
+
+// threadStateOf returns nil if ctx does not come from InitThread.
+func threadStateOf(ctx context.Context) *threadState {
+	state, _ := ctx.Value(threadStateKey).(*threadState)
+	return state
+}
+
+// cleanupThreadState stops the StreamInserts of the thread and drops what the
+// thread keeps, so it can be collected even if the caller holds on to ctx.
+func cleanupThreadState(ctx context.Context) {
+	if state := threadStateOf(ctx); state != nil {
+		if state.streams != nil {
+			state.streams.stop(false)
+		}
+		*state = threadState{}
+	}
+}
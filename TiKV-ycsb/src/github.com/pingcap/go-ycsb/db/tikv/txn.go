@@ -0,0 +1,760 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/go-ycsb/pkg/ycsb"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv"
+)
+
+// properties
+const (
+	// tikvTxnMode is "optimistic" or "pessimistic", see runTxn.
+	tikvTxnMode = "tikv.txn.mode"
+	// tikvTxnCommitLatency reports the prewrite and commit latency in Stats.
+	tikvTxnCommitLatency = "tikv.txn.commitLatency"
+	// tikvTxnMaxRetries is the number of times an optimistic transaction is
+	// rerun after a write conflict.
+	tikvTxnMaxRetries = "tikv.txn.maxRetries"
+	// tikvTxnRetryBackoff is the backoff before the first rerun of a
+	// conflicted transaction, it grows linearly with the reruns.
+	tikvTxnRetryBackoff = "tikv.txn.retryBackoff"
+	// tikvTxnLockTimeout bounds the time a pessimistic transaction waits for
+	// the conflicting ones, 0 bounds the number of waits by maxLockWaits.
+	tikvTxnLockTimeout = "tikv.txn.lockTimeout"
+	// tikvTxnAsyncCommit asks for async commit, it falls back to the
+	// two-phase commit.
+	tikvTxnAsyncCommit = "tikv.txn.asyncCommit"
+	// tikvTxnSplitRows and tikvTxnSplitBytes bound the rows and the bytes of
+	// keys and values written by one transaction of TxnInsert.
+	tikvTxnSplitRows  = "tikv.txn.splitRows"
+	tikvTxnSplitBytes = "tikv.txn.splitBytes"
+	// tikvTxnBatchBytes is the bytes of keys and values a transaction of
+	// BatchInsert is filled up to, so rows of varying sizes are written by
+	// transactions of similar sizes. 0 splits the rows like TxnInsert.
+	tikvTxnBatchBytes = "tikv.txn.batchBytes"
+)
+
+const (
+	txnModeOptimistic  = "optimistic"
+	txnModePessimistic = "pessimistic"
+
+	// maxLockWaits is the number of times a pessimistic transaction waits for
+	// the conflicting transactions before giving up.
+	maxLockWaits = 10
+)
+
+// ErrLockWaitTimeout is returned when a pessimistic transaction still
+// conflicts after waiting for tikvTxnLockTimeout.
+var ErrLockWaitTimeout = errors.New("pessimistic transaction lock wait timeout")
+
+// TxnRetryError is returned when a transaction still conflicts after it has
+// been rerun the configured number of times.
+type TxnRetryError struct {
+	Retries int
+	// Err is the error of the last commit.
+	Err error
+}
+
+func (e *TxnRetryError) Error() string {
+	return fmt.Sprintf("transaction still conflicts after %d retries: %v", e.Retries, e.Err)
+}
+
+// txnDB accesses TiKV with transactions, every operation runs in its own
+// transaction. It shares the codec with rawDB, so the rows written by one mode
+// can be read by the other.
+type txnDB struct {
+	*codec
+	db         kv.Storage
+	mode       string
+	maxRetries int
+	backoff    time.Duration
+	// lockTimeout is 0 if the pessimistic waits are not bounded by time.
+	lockTimeout time.Duration
+	splitRows   int
+	splitBytes  int
+	// batchBytes is 0 if BatchInsert splits like TxnInsert.
+	batchBytes int
+	// seed is tikvRawSyntheticSeed.
+	seed int64
+	// detectDuplicates is "" if BatchInsert does not check the keys.
+	detectDuplicates string
+	// flushInterval is 0 if StreamInsert only writes full batches.
+	flushInterval time.Duration
+	stats         *stats
+
+	// prewrite and commit are nil if tikvTxnCommitLatency is disabled.
+	prewrite *metricLatency
+	commit   *metricLatency
+
+	tso *metricLatency
+
+	// streams are the running StreamInserts, stopped by Close.
+	streams streamSet
+}
+
+func createTxnDB(p *properties.Properties) (ycsb.DB, error) {
+	db, err := newTxnDB(p, openTxnStore)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// openTxnStore opens the transactional store of the PD endpoints.
+func openTxnStore(pdAddr string) (kv.Storage, error) {
+	driver := tikv.Driver{}
+	return driver.Open(fmt.Sprintf("tikv://%s?disableGC=true", pdAddr))
+}
+
+// newTxnDB creates a txn driver of the properties on the store of open.
+func newTxnDB(p *properties.Properties, open func(pdAddr string) (kv.Storage, error)) (*txnDB, error) {
+	if err := checkNoTableLayouts(p); err != nil {
+		return nil, err
+	}
+
+	c, err := newCodec(p)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := p.GetString(tikvTxnMode, txnModeOptimistic)
+	if mode != txnModeOptimistic && mode != txnModePessimistic {
+		return nil, fmt.Errorf("unsupported %s %q, must be %q or %q", tikvTxnMode, mode, txnModeOptimistic, txnModePessimistic)
+	}
+
+	maxRetries := p.GetInt(tikvTxnMaxRetries, 0)
+	if maxRetries < 0 {
+		return nil, fmt.Errorf("%s must not be negative, got %d", tikvTxnMaxRetries, maxRetries)
+	}
+
+	backoff, err := time.ParseDuration(p.GetString(tikvTxnRetryBackoff, "10ms"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", tikvTxnRetryBackoff, err)
+	} else if backoff < 0 {
+		return nil, fmt.Errorf("%s must not be negative, got %s", tikvTxnRetryBackoff, backoff)
+	}
+
+	lockTimeout, err := time.ParseDuration(p.GetString(tikvTxnLockTimeout, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", tikvTxnLockTimeout, err)
+	} else if lockTimeout < 0 {
+		return nil, fmt.Errorf("%s must not be negative, got %s", tikvTxnLockTimeout, lockTimeout)
+	}
+
+	flushInterval, err := time.ParseDuration(p.GetString(tikvRawFlushInterval, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", tikvRawFlushInterval, err)
+	} else if flushInterval < 0 {
+		return nil, fmt.Errorf("%s must not be negative, got %s", tikvRawFlushInterval, flushInterval)
+	}
+
+	// The defaults are the limits of the transaction buffer.
+	splitRows := p.GetInt(tikvTxnSplitRows, int(kv.TxnEntryCountLimit))
+	splitBytes := p.GetInt(tikvTxnSplitBytes, kv.TxnTotalSizeLimit)
+	if splitRows <= 0 || splitBytes <= 0 {
+		return nil, fmt.Errorf("%s and %s must be positive, got %d and %d", tikvTxnSplitRows, tikvTxnSplitBytes, splitRows, splitBytes)
+	}
+	batchBytes := p.GetInt(tikvTxnBatchBytes, 0)
+	if batchBytes < 0 {
+		return nil, fmt.Errorf("%s must not be negative, got %d", tikvTxnBatchBytes, batchBytes)
+	}
+
+	detectDuplicates := p.GetString(tikvRawDetectDuplicates, "")
+	if detectDuplicates != "" && detectDuplicates != duplicatesReport && detectDuplicates != duplicatesError {
+		return nil, fmt.Errorf("unsupported %s %q, must be report or error", tikvRawDetectDuplicates, detectDuplicates)
+	}
+
+	if p.GetBool(tikvTxnAsyncCommit, false) {
+		defaultLogger.Warnf("%s is not supported by this TiKV client, using the two-phase commit", tikvTxnAsyncCommit)
+	}
+
+	pdAddr := p.GetString(tikvPD, "172.31.42.111:2379")
+	connCount, err := maxConnCount(p)
+	if err != nil {
+		return nil, err
+	}
+	tikv.MaxConnectionCount = connCount
+	db, err := open(pdAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := &txnDB{
+		codec:            c,
+		db:               db,
+		mode:             mode,
+		maxRetries:       maxRetries,
+		backoff:          backoff,
+		lockTimeout:      lockTimeout,
+		splitRows:        splitRows,
+		splitBytes:       splitBytes,
+		batchBytes:       batchBytes,
+		seed:             p.GetInt64(tikvRawSyntheticSeed, 0),
+		detectDuplicates: detectDuplicates,
+		flushInterval:    flushInterval,
+		stats:            newStats()}
+
+	if err := txn.initLatencies(p.GetBool(tikvTxnCommitLatency, false)); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return txn, nil
+}
+
+// initLatencies takes the base of the latencies reported by Stats, the
+// metrics of the requests sent before it are left out.
+func (db *txnDB) initLatencies(commitLatency bool) (err error) {
+	if commitLatency {
+		if db.prewrite, err = newMetricLatency(tikvRequestMetric, "Prewrite"); err != nil {
+			return err
+		}
+		if db.commit, err = newMetricLatency(tikvRequestMetric, "Commit"); err != nil {
+			return err
+		}
+	}
+	db.tso, err = newMetricLatency(pdCmdMetric, "tso")
+	return err
+}
+
+// Stats returns the transaction counters, "commit_conflict" is the number of
+// transactions failed by a conflict, "retry" is the number of reruns of the
+// optimistic transactions, "lock_wait" is the number of times a pessimistic
+// transaction waited for a conflicting one and "lock_wait_timeout" the number
+// of pessimistic transactions failed by tikvTxnLockTimeout. "scan_locked_keys" is
+// the number of keys locked by the "scan_for_update" calls of ScanForUpdate.
+// It has the latency of the TSO requests sent to PD, and with
+// tikvTxnCommitLatency the latency of the prewrite and commit requests of the
+// two-phase commit. With tikvRawHotFraction "hot_key" counts the keys routed
+// to a hot key, and with tikvRawDetectDuplicates "duplicate_key" the existing
+// rows found by BatchInsert.
+func (db *txnDB) Stats() map[string]int64 {
+	m := db.stats.snapshot()
+	addHotHits(m, db.codec)
+	// The latency is best effort, an error only leaves it out.
+	db.tso.addTo(m, "tso")
+	if db.prewrite != nil {
+		db.prewrite.addTo(m, "prewrite")
+		db.commit.addTo(m, "commit")
+	}
+	return m
+}
+
+// runTxn runs fn in a new transaction and commits it. In optimistic mode a
+// write conflict reruns fn in a new transaction, so it reads the latest values,
+// up to tikvTxnMaxRetries times. With no retries the conflict fails the commit
+// with an error for which kv.IsRetryableError returns true. Pessimistic mode
+// is emulated on the client: a conflicted transaction waits and reruns fn up
+// to maxLockWaits times, or until tikvTxnLockTimeout has passed since it began
+// when it is set.
+// Every rerun waits for a linearly growing backoff, and a transaction which
+// still conflicts fails with a *TxnRetryError, or ErrLockWaitTimeout.
+func (db *txnDB) runTxn(ctx context.Context, fn func(tx kv.Transaction) error) error {
+	limit, counter := db.maxRetries, "retry"
+	var deadline time.Time
+	if db.mode == txnModePessimistic {
+		limit, counter = maxLockWaits, "lock_wait"
+		if db.lockTimeout > 0 {
+			deadline = time.Now().Add(db.lockTimeout)
+		}
+	}
+
+	for reruns := 0; ; reruns++ {
+		tx, err := db.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if err = fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit(ctx)
+		if !isWriteConflict(err) {
+			return err
+		}
+
+		wait := time.Duration(reruns+1) * db.backoff
+		if !deadline.IsZero() {
+			if time.Now().Add(wait).After(deadline) {
+				db.stats.add("commit_conflict", 1)
+				db.stats.add("lock_wait_timeout", 1)
+				return ErrLockWaitTimeout
+			}
+		} else if reruns >= limit {
+			db.stats.add("commit_conflict", 1)
+			if limit == 0 {
+				return err
+			}
+			return &TxnRetryError{Retries: reruns, Err: err}
+		}
+
+		db.stats.add(counter, 1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// isWriteConflict returns whether the commit failed because another
+// transaction wrote the same keys, which TiKV reports as a retryable key error.
+func isWriteConflict(err error) bool {
+	if !kv.IsRetryableError(err) {
+		return false
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "WriteConflict") || strings.Contains(msg, "tikv restarts txn")
+}
+
+func (db *txnDB) Close() error {
+	db.streams.stop(true)
+	return db.db.Close()
+}
+
+func (db *txnDB) InitThread(ctx context.Context, _ int, _ int) context.Context {
+	return withThreadState(ctx)
+}
+
+func (db *txnDB) CleanupThread(ctx context.Context) {
+	cleanupThreadState(ctx)
+}
+
+// RunInTxn runs fn in a transaction which is committed when fn returns nil,
+// conflicts are handled as described in runTxn. The context passed to fn keeps
+// the transaction for ReadForUpdate, calling RunInTxn with such a context
+// joins the running transaction.
+func (db *txnDB) RunInTxn(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txnKey).(kv.Transaction); ok {
+		return fn(ctx)
+	}
+
+	return db.runTxn(ctx, func(tx kv.Transaction) error {
+		return fn(context.WithValue(ctx, txnKey, tx))
+	})
+}
+
+// ReadForUpdate reads the row in the transaction of RunInTxn and locks the key,
+// it fails if there is no transaction in the context. The lock is taken at
+// commit.
+func (db *txnDB) ReadForUpdate(ctx context.Context, table string, key string, fields []string) (map[string][]byte, error) {
+	tx, ok := ctx.Value(txnKey).(kv.Transaction)
+	if !ok {
+		return nil, fmt.Errorf("ReadForUpdate must be called in RunInTxn")
+	}
+
+	rowKey, err := db.getRowKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := db.getRow(tx, rowKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.LockKeys(rowKey); err != nil {
+		return nil, err
+	} else if row == nil {
+		return nil, nil
+	}
+
+	return db.decodeRow(ctx, row, fields)
+}
+
+// getRow returns nil if the row does not exist.
+func (db *txnDB) getRow(r kv.Retriever, rowKey []byte) ([]byte, error) {
+	row, err := r.Get(rowKey)
+	if kv.ErrNotExist.Equal(err) {
+		return nil, nil
+	}
+	return row, err
+}
+
+func (db *txnDB) Read(ctx context.Context, table string, key string, fields []string) (map[string][]byte, error) {
+	rowKey, err := db.getRowKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row, err := db.getRow(tx, rowKey)
+	if err != nil {
+		return nil, err
+	} else if row == nil {
+		return nil, nil
+	}
+
+	return db.decodeRow(ctx, row, fields)
+}
+
+// Exists returns whether the row exists, like Read but without decoding it.
+func (db *txnDB) Exists(ctx context.Context, table string, key string) (bool, error) {
+	rowKey, err := db.getRowKey(table, key)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	row, err := db.getRow(tx, rowKey)
+	return row != nil, err
+}
+
+// ReadAt reads the row from the snapshot at the timestamp ts, a ts of 0 reads
+// the latest committed version.
+func (db *txnDB) ReadAt(ctx context.Context, table string, key string, ts uint64, fields []string) (map[string][]byte, error) {
+	rowKey, err := db.getRowKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+
+	ver := kv.Version{Ver: ts}
+	if ts == 0 {
+		if ver, err = db.db.CurrentVersion(); err != nil {
+			return nil, err
+		}
+	}
+
+	snapshot, err := db.db.GetSnapshot(ver)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := db.getRow(snapshot, rowKey)
+	if err != nil {
+		return nil, err
+	} else if row == nil {
+		return nil, nil
+	}
+
+	return db.decodeRow(ctx, row, fields)
+}
+
+// TxnBatchRead reads the rows of all the keys with one BatchGet on a snapshot
+// of the latest version, so all of them are read at the same timestamp. The
+// rows are returned in the order of the keys, a missing row is nil.
+func (db *txnDB) TxnBatchRead(ctx context.Context, table string, keys []string, fields []string) ([]map[string][]byte, error) {
+	rowKeys := make([]kv.Key, len(keys))
+	for i, key := range keys {
+		rowKey, err := db.getRowKey(table, key)
+		if err != nil {
+			return nil, err
+		}
+		rowKeys[i] = rowKey
+	}
+
+	ver, err := db.db.CurrentVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := db.db.GetSnapshot(ver)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := snapshot.BatchGet(rowKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]map[string][]byte, len(rowKeys))
+	for i, rowKey := range rowKeys {
+		row, ok := values[string(rowKey)]
+		if !ok || len(row) == 0 {
+			continue
+		}
+
+		if res[i], err = db.decodeRow(ctx, row, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// txnScan returns a scanFunc which scans in the transaction.
+func txnScan(tx kv.Transaction) scanFunc {
+	return func(start []byte, limit int) ([][]byte, [][]byte, error) {
+		it, err := tx.Seek(start)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer it.Close()
+
+		keys := make([][]byte, 0, limit)
+		values := make([][]byte, 0, limit)
+		for it.Valid() && len(keys) < limit {
+			keys = append(keys, it.Key())
+			values = append(values, it.Value())
+			if err = it.Next(); err != nil {
+				return nil, nil, err
+			}
+		}
+		return keys, values, nil
+	}
+}
+
+func (db *txnDB) Scan(ctx context.Context, table string, startKey string, count int, fields []string) ([]map[string][]byte, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return db.scanRows(ctx, table, startKey, count, fields, txnScan(tx))
+}
+
+// ScanForUpdate scans the rows in the transaction of RunInTxn and locks the
+// keys of all the returned rows, like ReadForUpdate does for one row.
+func (db *txnDB) ScanForUpdate(ctx context.Context, table string, startKey string, count int, fields []string) ([]map[string][]byte, error) {
+	tx, ok := ctx.Value(txnKey).(kv.Transaction)
+	if !ok {
+		return nil, fmt.Errorf("ScanForUpdate must be called in RunInTxn")
+	}
+
+	keys, rows, err := db.scanRowPairs(table, startKey, count, txnScan(tx))
+	if err != nil {
+		return nil, err
+	}
+
+	lockKeys := make([]kv.Key, len(keys))
+	for i, key := range keys {
+		lockKeys[i] = key
+	}
+	if err = tx.LockKeys(lockKeys...); err != nil {
+		return nil, err
+	}
+	db.stats.add("scan_for_update", 1)
+	db.stats.add("scan_locked_keys", int64(len(keys)))
+
+	return db.decodeRows(ctx, rows, fields)
+}
+
+func (db *txnDB) Update(ctx context.Context, table string, key string, values map[string][]byte) error {
+	rowKey, err := db.getRowKey(table, key)
+	if err != nil {
+		return err
+	}
+
+	return db.runTxn(ctx, func(tx kv.Transaction) error {
+		row, err := db.getRow(tx, rowKey)
+		if err != nil {
+			return err
+		}
+
+		data, err := db.decodeRow(ctx, row, nil)
+		if err != nil {
+			return err
+		}
+
+		for field, value := range values {
+			data[field] = value
+		}
+
+		return db.set(tx, rowKey, data)
+	})
+}
+
+// UpdateReturning is rawDB.UpdateReturning, the previous row is the one read
+// by the transaction which committed.
+func (db *txnDB) UpdateReturning(ctx context.Context, table string, key string, values map[string][]byte) (map[string][]byte, error) {
+	rowKey, err := db.getRowKey(table, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous map[string][]byte
+	err = db.runTxn(ctx, func(tx kv.Transaction) error {
+		row, err := db.getRow(tx, rowKey)
+		if err != nil {
+			return err
+		}
+
+		data, err := db.decodeRow(ctx, row, nil)
+		if err != nil {
+			return err
+		}
+
+		previous = nil
+		if row != nil {
+			previous = copyRow(data)
+		}
+		for field, value := range values {
+			data[field] = value
+		}
+
+		return db.set(tx, rowKey, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// set encodes the values and puts the row in the transaction.
+func (db *txnDB) set(tx kv.Transaction, rowKey []byte, values map[string][]byte) error {
+	buf := db.bufPool.Get()
+	defer db.bufPool.Put(buf)
+
+	rowData, err := db.encodeRowBuf(buf, values)
+	if err != nil {
+		return err
+	}
+
+	// The transaction copies the value, so the buffer can be reused.
+	return tx.Set(rowKey, rowData)
+}
+
+func (db *txnDB) Insert(ctx context.Context, table string, key string, values map[string][]byte) error {
+	values, err := db.insertValues(values)
+	if err != nil {
+		return err
+	}
+
+	rowKey, err := db.getRowKey(table, db.insertKey(key, values))
+	if err != nil {
+		return err
+	}
+
+	return db.runTxn(ctx, func(tx kv.Transaction) error {
+		return db.set(tx, rowKey, values)
+	})
+}
+
+func (db *txnDB) Delete(ctx context.Context, table string, key string) error {
+	rowKey, err := db.getRowKey(table, key)
+	if err != nil {
+		return err
+	}
+
+	return db.runTxn(ctx, func(tx kv.Transaction) error {
+		return tx.Delete(rowKey)
+	})
+}
+
+// TxnInsert inserts all the entries, keyed by the YCSB key, in one transaction.
+// Either all the rows are written or none of them is. A conflict is handled as
+// described in runTxn, so in optimistic mode the caller can retry the whole
+// group. If the rows exceed tikvTxnSplitRows or tikvTxnSplitBytes, they are
+// split in the order of the row keys and written by sequential transactions,
+// then the insert is only atomic within each split, and on an error the
+// splits before it stay committed.
+func (db *txnDB) TxnInsert(ctx context.Context, table string, entries map[string]map[string][]byte) error {
+	return db.txnInsert(ctx, table, entries, db.splitBytes)
+}
+
+// txnInsert is TxnInsert, splitting the rows at maxBytes.
+func (db *txnDB) txnInsert(ctx context.Context, table string, entries map[string]map[string][]byte, maxBytes int) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	pairs := make([]txnPair, 0, len(entries))
+	rows := make([]map[string][]byte, 0, len(entries))
+	for key, values := range entries {
+		values, err := db.insertValues(values)
+		if err != nil {
+			return err
+		}
+
+		rowKey, err := db.getRowKey(table, db.insertKey(key, values))
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, txnPair{key: rowKey})
+		rows = append(rows, values)
+	}
+
+	// The rows are kept until committed, so they can not use the pool.
+	encoded, err := db.encodeRows(rows)
+	if err != nil {
+		return err
+	}
+	for i := range pairs {
+		pairs[i].value = encoded[i]
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(pairs[i].key, pairs[j].key) < 0
+	})
+
+	splits := db.splitPairs(pairs, maxBytes)
+	db.stats.add("txn_insert", 1)
+	db.stats.add("txn_insert_splits", int64(len(splits)-1))
+
+	for _, split := range splits {
+		err := db.runTxn(ctx, func(tx kv.Transaction) error {
+			for _, pair := range split {
+				if err := tx.Set(pair.key, pair.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type txnPair struct {
+	key   []byte
+	value []byte
+}
+
+// splitPairs splits the pairs so that no split exceeds the rows limit and
+// maxBytes, a single pair exceeding maxBytes is a split by itself.
+func (db *txnDB) splitPairs(pairs []txnPair, maxBytes int) [][]txnPair {
+	var (
+		splits [][]txnPair
+		start  int
+		size   int
+	)
+	for i, pair := range pairs {
+		n := len(pair.key) + len(pair.value)
+		if i > start && (i-start >= db.splitRows || size+n > maxBytes) {
+			splits = append(splits, pairs[start:i])
+			start, size = i, 0
+		}
+		size += n
+	}
+	return append(splits, pairs[start:])
+}
@@ -0,0 +1,400 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/tidb/kv"
+)
+
+// memStore is a transactional store keeping every committed version of the
+// pairs in memory. A commit conflicts when a key it writes or locks was
+// committed after the transaction began.
+type memStore struct {
+	kv.Storage
+	mu      sync.Mutex
+	version uint64
+	// versions are the committed versions of every key, oldest first, a
+	// deletion has a nil value.
+	versions map[string][]memVersion
+	// commits counts the successful commits.
+	commits int
+}
+
+type memVersion struct {
+	version uint64
+	value   []byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{versions: make(map[string][]memVersion)}
+}
+
+func (s *memStore) Begin() (kv.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &storeTxn{
+		memSnapshot: memSnapshot{store: s, version: s.version},
+		writes:      make(map[string][]byte),
+		locks:       make(map[string]bool)}, nil
+}
+
+func (s *memStore) GetSnapshot(ver kv.Version) (kv.Snapshot, error) {
+	return &memSnapshot{store: s, version: ver.Ver}, nil
+}
+
+func (s *memStore) CurrentVersion() (kv.Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return kv.NewVersion(s.version), nil
+}
+
+func (s *memStore) Close() error {
+	return nil
+}
+
+// get returns the value of the key at the version, nil if there is none.
+func (s *memStore) get(key string, version uint64) []byte {
+	var v []byte
+	for _, mv := range s.versions[key] {
+		if mv.version <= version {
+			v = mv.value
+		}
+	}
+	return v
+}
+
+// pairs returns the pairs at the version.
+func (s *memStore) pairs(version uint64) map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pairs := make(map[string][]byte)
+	for k := range s.versions {
+		if v := s.get(k, version); v != nil {
+			pairs[k] = v
+		}
+	}
+	return pairs
+}
+
+// memSnapshot reads the pairs of a memStore at a version.
+type memSnapshot struct {
+	kv.Snapshot
+	store   *memStore
+	version uint64
+}
+
+func (s *memSnapshot) Get(k kv.Key) ([]byte, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	if v := s.store.get(string(k), s.version); v != nil {
+		return v, nil
+	}
+	return nil, kv.ErrNotExist
+}
+
+func (s *memSnapshot) BatchGet(keys []kv.Key) (map[string][]byte, error) {
+	m := make(map[string][]byte)
+	for _, k := range keys {
+		if v, err := s.Get(k); err == nil {
+			m[string(k)] = v
+		}
+	}
+	return m, nil
+}
+
+func (s *memSnapshot) Seek(k kv.Key) (kv.Iterator, error) {
+	return newMemIterator(s.store.pairs(s.version), k), nil
+}
+
+// storeTxn is a transaction of a memStore.
+type storeTxn struct {
+	kv.Transaction
+	memSnapshot
+	// writes are the values written, nil for a deletion.
+	writes map[string][]byte
+	locks  map[string]bool
+}
+
+func (tx *storeTxn) Get(k kv.Key) ([]byte, error) {
+	if v, ok := tx.writes[string(k)]; ok {
+		if v == nil {
+			return nil, kv.ErrNotExist
+		}
+		return v, nil
+	}
+	return tx.memSnapshot.Get(k)
+}
+
+func (tx *storeTxn) Seek(k kv.Key) (kv.Iterator, error) {
+	pairs := tx.store.pairs(tx.version)
+	for key, v := range tx.writes {
+		if v == nil {
+			delete(pairs, key)
+		} else {
+			pairs[key] = v
+		}
+	}
+	return newMemIterator(pairs, k), nil
+}
+
+func (tx *storeTxn) Set(k kv.Key, v []byte) error {
+	tx.writes[string(k)] = append([]byte(nil), v...)
+	return nil
+}
+
+func (tx *storeTxn) Delete(k kv.Key) error {
+	tx.writes[string(k)] = nil
+	return nil
+}
+
+func (tx *storeTxn) LockKeys(keys ...kv.Key) error {
+	for _, k := range keys {
+		tx.locks[string(k)] = true
+	}
+	return nil
+}
+
+func (tx *storeTxn) StartTS() uint64 {
+	return tx.version
+}
+
+func (tx *storeTxn) Commit(ctx context.Context) error {
+	s := tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, keys := range []map[string]bool{tx.locks, keySet(tx.writes)} {
+		for k := range keys {
+			if versions := s.versions[k]; len(versions) > 0 && versions[len(versions)-1].version > tx.version {
+				return kv.ErrRetryable.FastGen("WriteConflict on key %q", k)
+			}
+		}
+	}
+
+	s.version++
+	for k, v := range tx.writes {
+		s.versions[k] = append(s.versions[k], memVersion{version: s.version, value: v})
+	}
+	s.commits++
+	return nil
+}
+
+func (tx *storeTxn) Rollback() error {
+	return nil
+}
+
+func keySet(m map[string][]byte) map[string]bool {
+	keys := make(map[string]bool, len(m))
+	for k := range m {
+		keys[k] = true
+	}
+	return keys
+}
+
+// memIterator iterates over sorted pairs.
+type memIterator struct {
+	keys   []string
+	values map[string][]byte
+}
+
+func newMemIterator(pairs map[string][]byte, start kv.Key) *memIterator {
+	it := &memIterator{values: pairs}
+	for k := range pairs {
+		if k >= string(start) {
+			it.keys = append(it.keys, k)
+		}
+	}
+	sort.Strings(it.keys)
+	return it
+}
+
+func (it *memIterator) Valid() bool   { return len(it.keys) > 0 }
+func (it *memIterator) Key() kv.Key   { return kv.Key(it.keys[0]) }
+func (it *memIterator) Value() []byte { return it.values[it.keys[0]] }
+func (it *memIterator) Next() error   { it.keys = it.keys[1:]; return nil }
+func (it *memIterator) Close()        {}
+
+// newTestTxnDB returns a txn driver of the properties on a memStore.
+func newTestTxnDB(t testing.TB, kvs ...string) (*txnDB, *memStore) {
+	t.Helper()
+	p := properties.NewProperties()
+	p.Set(tikvMaxConnCount, "1")
+	p.Set(tikvTxnRetryBackoff, "1ms")
+	for i := 0; i+1 < len(kvs); i += 2 {
+		p.Set(kvs[i], kvs[i+1])
+	}
+
+	s := newMemStore()
+	db, err := newTxnDB(p, func(string) (kv.Storage, error) { return s, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, s
+}
+
+// The lock of ReadForUpdate is taken at commit, so a concurrent writer of the
+// key is not blocked, and the transaction holding the lock conflicts instead.
+func TestReadForUpdateConflict(t *testing.T) {
+	tests := []struct {
+		mode string
+		// runs is the number of times fn runs, err whether RunInTxn fails
+		// and commits the number of commits, with the insert and the update.
+		runs    int
+		err     bool
+		commits int
+	}{
+		{txnModeOptimistic, 1, true, 2},
+		{txnModePessimistic, 2, false, 3},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		db, s := newTestTxnDB(t, tikvTxnMode, tt.mode)
+		if err := db.Insert(ctx, "usertable", "user1", map[string][]byte{"field0": []byte("a")}); err != nil {
+			t.Fatal(err)
+		}
+
+		runs := 0
+		err := db.RunInTxn(ctx, func(ctx context.Context) error {
+			runs++
+			row, err := db.ReadForUpdate(ctx, "usertable", "user1", nil)
+			if err != nil || string(row["field0"]) == "" {
+				t.Fatalf("%s: ReadForUpdate = %v, %v", tt.mode, row, err)
+			}
+			if runs == 1 {
+				// The writer commits while the key is locked.
+				if err := db.Update(ctx, "usertable", "user1", map[string][]byte{"field0": []byte("b")}); err != nil {
+					t.Errorf("%s: the update of the locked key failed: %v", tt.mode, err)
+				}
+			}
+			return nil
+		})
+		if (err != nil) != tt.err || runs != tt.runs {
+			t.Errorf("%s: RunInTxn ran fn %d times and returned %v, want %d runs, error %v", tt.mode, runs, err, tt.runs, tt.err)
+		}
+		if tt.err && !kv.IsRetryableError(err) {
+			t.Errorf("%s: RunInTxn returned %v, want a retryable error", tt.mode, err)
+		}
+		if s.commits != tt.commits {
+			t.Errorf("%s: %d commits, want %d", tt.mode, s.commits, tt.commits)
+		}
+	}
+}
+
+func TestReadForUpdateOutsideTxn(t *testing.T) {
+	db, _ := newTestTxnDB(t)
+	if _, err := db.ReadForUpdate(context.Background(), "usertable", "user1", nil); err == nil {
+		t.Error("ReadForUpdate outside of RunInTxn succeeded")
+	}
+}
+
+func TestTxnBatchRead(t *testing.T) {
+	ctx := context.Background()
+	db, _ := newTestTxnDB(t, "fieldcount", "2")
+	for _, key := range []string{"user1", "user2"} {
+		values := map[string][]byte{"field0": []byte(key + "a"), "field1": []byte(key + "b")}
+		if err := db.Insert(ctx, "usertable", key, values); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		keys   []string
+		fields []string
+		// want are the field0 of the rows, "" for a missing row.
+		want []string
+	}{
+		{[]string{"user1", "user2"}, nil, []string{"user1a", "user2a"}},
+		{[]string{"user2", "user3", "user1"}, nil, []string{"user2a", "", "user1a"}},
+		{[]string{"user1", "user1"}, []string{"field0"}, []string{"user1a", "user1a"}},
+		{nil, nil, []string{}},
+	}
+	for _, tt := range tests {
+		rows, err := db.TxnBatchRead(ctx, "usertable", tt.keys, tt.fields)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.keys, err)
+		}
+		if len(rows) != len(tt.want) {
+			t.Fatalf("%v: read %d rows, want %d", tt.keys, len(rows), len(tt.want))
+		}
+		for i, row := range rows {
+			if tt.want[i] == "" {
+				if row != nil {
+					t.Errorf("%v: row %d is %v, want nil", tt.keys, i, row)
+				}
+				continue
+			}
+			if string(row["field0"]) != tt.want[i] {
+				t.Errorf("%v: row %d is %v, want field0 %s", tt.keys, i, row, tt.want[i])
+			}
+			if _, ok := row["field1"]; ok == (tt.fields != nil) {
+				t.Errorf("%v: row %d is %v with the fields %v", tt.keys, i, row, tt.fields)
+			}
+		}
+	}
+}
+
+// BenchmarkBatchInsert inserts batches of 1000 rows, the first 100 of them
+// 100 times larger, split by a fixed count of 100 rows or by a 64KB budget.
+func BenchmarkBatchInsert(b *testing.B) {
+	keys := make([]string, 1000)
+	values := make([]map[string][]byte, len(keys))
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user%04d", i)
+		size := 10
+		if i < 100 {
+			size = 1000
+		}
+		values[i] = benchValues(10, size)
+	}
+
+	tests := []struct {
+		name string
+		kvs  []string
+	}{
+		{"rows", []string{tikvTxnSplitRows, "100"}},
+		{"bytes", []string{tikvTxnBatchBytes, "65536"}},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			db, s := newTestTxnDB(b, tt.kvs...)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := db.BatchInsert(ctx, "usertable", keys, values); err != nil {
+					b.Fatal(err)
+				}
+			}
+			stats := db.Stats()
+			b.ReportMetric(float64(stats["txn_insert"]+stats["txn_insert_splits"])/float64(b.N), "txns/op")
+
+			// The last batch wrote the last versions, one per transaction.
+			txnBytes := make(map[uint64]int)
+			var maxBytes int
+			for key, versions := range s.versions {
+				last := versions[len(versions)-1]
+				txnBytes[last.version] += len(key) + len(last.value)
+				if n := txnBytes[last.version]; n > maxBytes {
+					maxBytes = n
+				}
+			}
+			b.ReportMetric(float64(maxBytes), "max_txn_bytes")
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/go-ycsb/pkg/prop"
+)
+
+// configError lists all the problems of a configuration.
+type configError []string
+
+func (e configError) Error() string {
+	return "invalid TiKV configuration: " + strings.Join(e, "; ")
+}
+
+func (e *configError) addf(format string, args ...interface{}) {
+	*e = append(*e, fmt.Sprintf(format, args...))
+}
+
+// err returns nil if there is no problem.
+func (e configError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate checks that the properties of the raw driver, the fields and the
+// key layout are consistent, without connecting to the cluster. It returns
+// all the problems in one error.
+func Validate(p *properties.Properties) error {
+	cfg, err := rawConfig(p)
+	errs, _ := err.(configError)
+	cfg.validate(&errs)
+	return errs.err()
+}
+
+func (cfg LayoutConfig) validate(errs *configError) {
+	if cfg.FieldCount <= 0 {
+		errs.addf("%s must be positive, got %d", prop.FieldCount, cfg.FieldCount)
+	}
+	if cfg.FieldLength < 0 {
+		errs.addf("%s must not be negative, got %d", prop.FieldLength, cfg.FieldLength)
+	}
+
+	if cfg.SaltBuckets < 0 || cfg.SaltBuckets >= maxSaltBuckets {
+		errs.addf("%s must be in [0, %d), got %d", tikvRawSaltBuckets, maxSaltBuckets, cfg.SaltBuckets)
+	}
+	if _, ok := saltHashers[cfg.SaltHash]; !ok {
+		errs.addf("unsupported %s %q, must be crc32, fnv or xxhash", tikvRawSaltHash, cfg.SaltHash)
+	}
+	if cfg.RowKeyCacheSize < 0 {
+		errs.addf("%s must not be negative, got %d", tikvRawRowKeyCacheSize, cfg.RowKeyCacheSize)
+	}
+
+	// The truncated keys end with a 8 bytes hash.
+	if cfg.MaxKeyBytes < 0 || (cfg.TruncateLongKeys && cfg.MaxKeyBytes > 0 && cfg.MaxKeyBytes <= 8) {
+		errs.addf("invalid %s %d", tikvRawMaxKeyBytes, cfg.MaxKeyBytes)
+	}
+
+	if cfg.ScanDecodeParallelism < 1 {
+		errs.addf("%s must be positive, got %d", tikvRawScanDecodeParallelism, cfg.ScanDecodeParallelism)
+	}
+	if cfg.EncodeWorkers < 1 {
+		errs.addf("%s must be positive, got %d", tikvRawEncodeWorkers, cfg.EncodeWorkers)
+	}
+
+	switch cfg.KeyDecode {
+	case "none", "hex", "base64":
+	default:
+		errs.addf("unsupported %s %s", tikvRawKeyDecode, cfg.KeyDecode)
+	}
+
+	switch cfg.MissingFields {
+	case "skip", "fillEmpty", "error":
+	default:
+		errs.addf("unsupported %s %q, must be skip, fillEmpty or error", tikvRawMissingFields, cfg.MissingFields)
+	}
+
+	if cfg.HotFraction < 0 || cfg.HotFraction > 1 {
+		errs.addf("%s must be in [0, 1], got %v", tikvRawHotFraction, cfg.HotFraction)
+	}
+	if cfg.HotRange <= 0 {
+		errs.addf("%s must be positive, got %d", tikvRawHotRange, cfg.HotRange)
+	}
+	// The hot keys are plain strings, they can not be decoded or be a handle.
+	if cfg.HotFraction > 0 && (cfg.KeyDecode != "none" || cfg.TiDBCompat) {
+		errs.addf("%s can not be used with %s or %s", tikvRawHotFraction, tikvRawKeyDecode, tikvRawTiDBCompat)
+	}
+
+	if _, err := newRowCodec(cfg.Encoding); err != nil {
+		errs.addf("%v", err)
+	}
+
+	// The record keys of TiDB have no room for the other key layouts.
+	if cfg.TiDBCompat {
+		if cfg.Encoding != "tablecodec" {
+			errs.addf("%s needs %s tablecodec, got %q", tikvRawTiDBCompat, tikvRawEncoding, cfg.Encoding)
+		}
+		if cfg.IdempotentWrites {
+			errs.addf("%s can not be used with %s, TiDB can not decode the tokens", tikvRawTiDBCompat, tikvRawIdempotentWrites)
+		}
+		if cfg.TiDBTableID <= 0 {
+			errs.addf("%s needs a positive %s, got %d", tikvRawTiDBCompat, tikvRawTiDBTableID, cfg.TiDBTableID)
+		}
+		if cfg.SaltBuckets > 0 || cfg.ReverseKey || cfg.KeyspacePrefix != "" || cfg.KeyDecode != "none" {
+			errs.addf("%s can not be used with %s, %s, %s or %s", tikvRawTiDBCompat,
+				tikvRawSaltBuckets, tikvRawReverseKey, tikvRawKeyspacePrefix, tikvRawKeyDecode)
+		}
+	}
+
+	// The fields are named field0 to field<FieldCount - 1>.
+	fieldIndices := createFieldIndices(cfg.FieldCount)
+	seen := make(map[string]bool, len(cfg.CompositeKeyFields))
+	for _, field := range cfg.CompositeKeyFields {
+		if _, ok := fieldIndices[field]; !ok {
+			errs.addf("%s references unknown field %s", tikvRawCompositeKeyFields, field)
+		} else if seen[field] {
+			errs.addf("%s references field %s twice", tikvRawCompositeKeyFields, field)
+		}
+		seen[field] = true
+	}
+}
+
+func (cfg Config) validate(errs *configError) {
+	cfg.LayoutConfig.validate(errs)
+	validateTables(cfg.Tables, errs)
+
+	if len(cfg.PD) == 0 {
+		errs.addf("%s must not be empty", tikvPD)
+	}
+	if cfg.MaxConnCount < 0 {
+		errs.addf("%s must not be negative, got %d", tikvMaxConnCount, cfg.MaxConnCount)
+	}
+
+	switch cfg.ReplicaRead {
+	case "leader", "follower", "mixed":
+	default:
+		errs.addf("unsupported %s %q, must be leader, follower or mixed", tikvRawReplicaRead, cfg.ReplicaRead)
+	}
+
+	if cfg.StaleRead < 0 {
+		errs.addf("%s must not be negative, got %s", tikvRawStaleRead, cfg.StaleRead)
+	}
+	if cfg.MaxScanDuration < 0 {
+		errs.addf("%s must not be negative, got %s", tikvRawMaxScanDuration, cfg.MaxScanDuration)
+	}
+	if cfg.FlushInterval < 0 {
+		errs.addf("%s must not be negative, got %s", tikvRawFlushInterval, cfg.FlushInterval)
+	}
+	if cfg.SizeSamplePages < 0 {
+		errs.addf("%s must not be negative, got %d", tikvRawSizeSamplePages, cfg.SizeSamplePages)
+	}
+
+	switch cfg.ScanConsistency {
+	case "", "leader", "follower":
+	case "stale":
+		if cfg.StaleRead <= 0 {
+			errs.addf("%s stale needs %s", tikvRawScanConsistency, tikvRawStaleRead)
+		}
+	default:
+		errs.addf("unsupported %s %q, must be leader, follower or stale", tikvRawScanConsistency, cfg.ScanConsistency)
+	}
+
+	if cfg.TargetStore != "" {
+		errs.addf("%s %s is set, but this TiKV client can not choose the store of a read", tikvRawTargetStore, cfg.TargetStore)
+	}
+	if cfg.ConnAffinity {
+		errs.addf("%s is set, but this TiKV client picks the connection of every request itself and can not pin a thread to one", tikvRawConnAffinity)
+	}
+
+	switch cfg.DetectDuplicates {
+	case "", duplicatesReport, duplicatesError:
+	default:
+		errs.addf("unsupported %s %q, must be report or error", tikvRawDetectDuplicates, cfg.DetectDuplicates)
+	}
+
+	switch cfg.WriteAck {
+	case "default":
+	case "leader", "majority", "all":
+		errs.addf("%s %s is set, but TiKV acknowledges a write once raft commits it and this client can not change it, only default is supported",
+			tikvRawWriteAck, cfg.WriteAck)
+	default:
+		errs.addf("unsupported %s %q, must be default, leader, majority or all", tikvRawWriteAck, cfg.WriteAck)
+	}
+
+	switch cfg.Priority {
+	case "low", "normal", "high":
+	default:
+		errs.addf("unsupported %s %q, must be low, normal or high", tikvRawPriority, cfg.Priority)
+	}
+
+	if cfg.FollowerFallback < 0 {
+		errs.addf("%s must not be negative, got %d", tikvRawFollowerFallback, cfg.FollowerFallback)
+	} else if cfg.FollowerFallback > 0 {
+		errs.addf("%s is set, but this TiKV client can not read from a follower", tikvRawFollowerFallback)
+	}
+	if cfg.ReadRepairSample < 0 || cfg.ReadRepairSample > 1 {
+		errs.addf("%s must be in [0, 1], got %v", tikvRawReadRepairSample, cfg.ReadRepairSample)
+	} else if cfg.ReadRepairSample > 0 {
+		errs.addf("%s is set, but this TiKV client can not read from a follower", tikvRawReadRepairSample)
+	}
+	if cfg.ProfileSample < 0 || cfg.ProfileSample > 1 {
+		errs.addf("%s must be in [0, 1], got %v", tikvRawProfileSample, cfg.ProfileSample)
+	}
+
+	if cfg.ReadYourWrites && cfg.ReadYourWritesSize <= 0 {
+		errs.addf("%s must be positive, got %d", tikvRawReadYourWritesSize, cfg.ReadYourWritesSize)
+	}
+
+	if cfg.ReadCacheSize < 0 {
+		errs.addf("%s must not be negative, got %d", tikvRawReadCacheSize, cfg.ReadCacheSize)
+	} else if cfg.ReadCacheSize > 0 && cfg.ReadCacheTTL <= 0 {
+		errs.addf("%s must be positive, got %s", tikvRawReadCacheTTL, cfg.ReadCacheTTL)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		kvs []string
+		// want is "" if the properties are valid, a part of the error
+		// otherwise.
+		want string
+	}{
+		{nil, ""},
+		{[]string{tikvRawFollowerFallback, "0"}, ""},
+		{[]string{tikvRawFollowerFallback, "-1"}, "must not be negative"},
+		{[]string{tikvRawFollowerFallback, "2"}, "can not read from a follower"},
+		{[]string{tikvRawSizeSamplePages, "0"}, ""},
+		{[]string{tikvRawSizeSamplePages, "-1"}, "must not be negative"},
+		{[]string{tikvRawReadRepairSample, "0"}, ""},
+		{[]string{tikvRawReadRepairSample, "1.5"}, "must be in [0, 1]"},
+		{[]string{tikvRawReadRepairSample, "0.1"}, "can not read from a follower"},
+		{[]string{tikvRawReadRepairSample, "0.1", tikvRawReplicaRead, "follower"}, "can not read from a follower"},
+	}
+	for _, tt := range tests {
+		p := properties.NewProperties()
+		for i := 0; i < len(tt.kvs); i += 2 {
+			p.Set(tt.kvs[i], tt.kvs[i+1])
+		}
+		err := Validate(p)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("Validate(%v): %v", tt.kvs, err)
+			}
+			continue
+		}
+		if _, ok := err.(configError); !ok || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate(%v) = %v, want a configError with %q", tt.kvs, err, tt.want)
+		}
+	}
+}
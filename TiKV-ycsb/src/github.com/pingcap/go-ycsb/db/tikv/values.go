@@ -0,0 +1,93 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// The rows store every field as a varchar, so the typed accessors parse the
+// text of the field. They fail if the field is missing or is not a value of
+// the type.
+
+// AsString returns the field of a read result as a string, "" if the field is
+// missing.
+func AsString(row map[string][]byte, field string) string {
+	return string(row[field])
+}
+
+// AsInt64 parses the field of a read result as a decimal int64.
+func AsInt64(row map[string][]byte, field string) (int64, error) {
+	v, err := fieldText(row, field)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("field %s is not an int64: %q", field, v)
+	}
+	return n, nil
+}
+
+// AsUint64 parses the field of a read result as a decimal uint64.
+func AsUint64(row map[string][]byte, field string) (uint64, error) {
+	v, err := fieldText(row, field)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("field %s is not an uint64: %q", field, v)
+	}
+	return n, nil
+}
+
+// AsFloat64 parses the field of a read result as a float64.
+func AsFloat64(row map[string][]byte, field string) (float64, error) {
+	v, err := fieldText(row, field)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("field %s is not a float64: %q", field, v)
+	}
+	return f, nil
+}
+
+// AsBool parses the field of a read result as a bool, like "1" or "true".
+func AsBool(row map[string][]byte, field string) (bool, error) {
+	v, err := fieldText(row, field)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("field %s is not a bool: %q", field, v)
+	}
+	return b, nil
+}
+
+func fieldText(row map[string][]byte, field string) (string, error) {
+	v, ok := row[field]
+	if !ok {
+		return "", fmt.Errorf("field %s is missing", field)
+	}
+	return string(v), nil
+}
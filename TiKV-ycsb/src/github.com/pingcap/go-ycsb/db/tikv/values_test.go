@@ -0,0 +1,84 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"testing"
+)
+
+func TestTypedAccessors(t *testing.T) {
+	row := map[string][]byte{
+		"int":   []byte("-42"),
+		"uint":  []byte("18446744073709551615"),
+		"float": []byte("2.5"),
+		"bool":  []byte("true"),
+		"text":  []byte("abc"),
+		"empty": []byte(""),
+	}
+
+	tests := []struct {
+		field string
+		// want is the value of the accessor, nil if it fails.
+		want  interface{}
+		parse func(row map[string][]byte, field string) (interface{}, error)
+	}{
+		{"int", int64(-42), asInt64},
+		{"uint", uint64(18446744073709551615), asUint64},
+		{"float", 2.5, asFloat64},
+		{"bool", true, asBool},
+		{"text", nil, asInt64},
+		{"uint", nil, asInt64},
+		{"int", nil, asUint64},
+		{"text", nil, asFloat64},
+		{"text", nil, asBool},
+		{"empty", nil, asInt64},
+		{"missing", nil, asInt64},
+		{"missing", nil, asBool},
+	}
+	for _, tt := range tests {
+		v, err := tt.parse(row, tt.field)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("field %s parsed as %v, want an error", tt.field, v)
+			}
+			continue
+		}
+		if err != nil || v != tt.want {
+			t.Errorf("field %s parsed as %v, %v, want %v", tt.field, v, err, tt.want)
+		}
+	}
+
+	if s := AsString(row, "text"); s != "abc" {
+		t.Errorf("AsString(text) = %q", s)
+	}
+	if s := AsString(row, "missing"); s != "" {
+		t.Errorf("AsString(missing) = %q, want \"\"", s)
+	}
+}
+
+func asInt64(row map[string][]byte, field string) (interface{}, error) {
+	return AsInt64(row, field)
+}
+
+func asUint64(row map[string][]byte, field string) (interface{}, error) {
+	return AsUint64(row, field)
+}
+
+func asFloat64(row map[string][]byte, field string) (interface{}, error) {
+	return AsFloat64(row, field)
+}
+
+func asBool(row map[string][]byte, field string) (interface{}, error) {
+	return AsBool(row, field)
+}
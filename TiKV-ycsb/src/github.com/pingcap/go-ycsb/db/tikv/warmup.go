@@ -0,0 +1,221 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/magiconair/properties"
+	"github.com/pingcap/go-ycsb/pkg/prop"
+	"github.com/pingcap/go-ycsb/pkg/ycsb"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv"
+)
+
+// properties
+const (
+	// tikvWarmup runs Warmup on the table of the workload when the driver is
+	// created, with the options of the other warmup properties.
+	tikvWarmup = "tikv.warmup"
+	// tikvWarmupRegions is WarmupOptions.Regions.
+	tikvWarmupRegions = "tikv.warmup.regions"
+	// tikvWarmupScatter is WarmupOptions.Scatter.
+	tikvWarmupScatter = "tikv.warmup.scatter"
+	// tikvWarmupPrewarm is WarmupOptions.Prewarm, it is enabled by default.
+	tikvWarmupPrewarm = "tikv.warmup.prewarm"
+)
+
+// warmupBackoff is the maximum backoff in milliseconds of locating the regions
+// of a table.
+const warmupBackoff = 20000
+
+// WarmupOptions are the steps of Warmup, the zero value does nothing.
+type WarmupOptions struct {
+	// SplitKeys are the keys to split the regions of the table at, like the
+	// split keys of PreSplit.
+	SplitKeys []string
+	// Regions splits the table into this many regions at PreSplitKeys if
+	// SplitKeys is nil, 0 or 1 does not split it.
+	Regions int
+	// KeyPrefix is the key prefix of PreSplitKeys, "user" if it is empty.
+	KeyPrefix string
+	// Scatter asks PD to spread the regions of the table over the stores.
+	Scatter bool
+	// Prewarm loads the regions of the table into the region cache of the
+	// client, so the first operations do not ask PD for them.
+	Prewarm bool
+}
+
+func (opts WarmupOptions) splitKeys() []string {
+	if opts.SplitKeys != nil {
+		return opts.SplitKeys
+	}
+	keyPrefix := opts.KeyPrefix
+	if keyPrefix == "" {
+		keyPrefix = prop.KeyPrefixDefault
+	}
+	return PreSplitKeys(keyPrefix, opts.Regions)
+}
+
+func warmupOptions(p *properties.Properties) (WarmupOptions, error) {
+	opts := WarmupOptions{
+		Regions:   p.GetInt(tikvWarmupRegions, 0),
+		KeyPrefix: p.GetString(prop.KeyPrefix, prop.KeyPrefixDefault),
+		Scatter:   p.GetBool(tikvWarmupScatter, false),
+		Prewarm:   p.GetBool(tikvWarmupPrewarm, true),
+	}
+	if opts.Regions < 0 {
+		return opts, fmt.Errorf("%s must not be negative, got %d", tikvWarmupRegions, opts.Regions)
+	}
+	return opts, nil
+}
+
+// warmupFromProperties runs Warmup on the table of the workload if tikvWarmup
+// is set.
+func warmupFromProperties(p *properties.Properties, db ycsb.DB) error {
+	if !p.GetBool(tikvWarmup, false) {
+		return nil
+	}
+
+	opts, err := warmupOptions(p)
+	if err != nil {
+		return err
+	}
+
+	w, ok := db.(interface {
+		Warmup(ctx context.Context, table string, opts WarmupOptions) error
+	})
+	if !ok {
+		return fmt.Errorf("%s is set, but the driver has no warmup", tikvWarmup)
+	}
+	return w.Warmup(context.Background(), p.GetString(prop.TableName, prop.TableNameDefault), opts)
+}
+
+// warmupSummary counts what a warmup did, for its log.
+type warmupSummary struct {
+	splitKeys int
+	regions   int
+}
+
+func (s warmupSummary) log(log Logger, table string) {
+	log.Infof("warmed up table %s, split at %d keys, %d regions cached", table, s.splitKeys, s.regions)
+}
+
+// scatter falls back to the placement of PD.
+func scatter(opts WarmupOptions, log Logger, stats *stats) {
+	if opts.Scatter {
+		log.Warnf("%s is not supported by this PD client, leaving the regions to the balancer of PD", tikvWarmupScatter)
+		stats.add("scatter_fallback", 1)
+	}
+}
+
+// Warmup splits the regions of table, scatters them and loads them into the
+// region cache, to reach the steady state before measuring, and logs a
+// summary. Splitting fails like PreSplit, only the region of the start of the
+// table is cached, and Scatter is counted as "scatter_fallback" in Stats.
+func (db *rawDB) Warmup(ctx context.Context, table string, opts WarmupOptions) error {
+	if len(opts.splitKeys()) > 0 {
+		return errNoSplit
+	}
+
+	log := db.cfg.logger()
+	scatter(opts, log, db.stats)
+
+	var s warmupSummary
+	if opts.Prewarm {
+		if err := db.prewarm(ctx, [][]byte{db.tableCodec(table).appendTablePrefix(nil, table)}); err != nil {
+			return err
+		}
+		s.regions = 1
+	}
+	s.log(log, table)
+	return nil
+}
+
+// prewarm caches the regions holding the row keys with a scan of one row at
+// each of them.
+func (db *rawDB) prewarm(ctx context.Context, rowKeys [][]byte) error {
+	for _, rowKey := range rowKeys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, _, err := db.db.Scan(rowKey, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Warmup is rawDB.Warmup, but it splits the regions like PreSplit and caches
+// all the regions of the table.
+func (db *txnDB) Warmup(ctx context.Context, table string, opts WarmupOptions) error {
+	s, _, err := db.warmup(ctx, table, opts)
+	if err != nil {
+		return err
+	}
+	s.log(defaultLogger, table)
+	return nil
+}
+
+// warmup returns the summary and the keys the table was split at.
+func (db *txnDB) warmup(ctx context.Context, table string, opts WarmupOptions) (warmupSummary, [][]byte, error) {
+	var s warmupSummary
+	splitKeys := opts.splitKeys()
+	if len(splitKeys) > 0 {
+		if err := db.PreSplit(ctx, table, splitKeys); err != nil {
+			return s, nil, err
+		}
+	}
+	rowKeys, err := db.splitRowKeys(table, splitKeys)
+	if err != nil {
+		return s, nil, err
+	}
+	s.splitKeys = len(splitKeys)
+
+	scatter(opts, defaultLogger, db.stats)
+
+	if opts.Prewarm {
+		store, ok := db.db.(tikv.Storage)
+		if !ok {
+			return s, nil, errors.New("this TiKV store has no region cache")
+		}
+
+		prefix := db.appendTablePrefix(nil, table)
+		bo := tikv.NewBackoffer(ctx, warmupBackoff)
+		ids, err := store.GetRegionCache().ListRegionIDsInKeyRange(bo, prefix, kv.Key(prefix).PrefixNext())
+		if err != nil {
+			return s, nil, err
+		}
+		s.regions = len(ids)
+	}
+	return s, rowKeys, nil
+}
+
+// Warmup is txnDB.Warmup, it also caches the regions of the start of the
+// table and of the split keys in the raw client.
+func (db *mixedDB) Warmup(ctx context.Context, table string, opts WarmupOptions) error {
+	s, rowKeys, err := db.txn.warmup(ctx, table, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Prewarm {
+		if err := db.raw.prewarm(ctx, rowKeys); err != nil {
+			return err
+		}
+	}
+	s.log(defaultLogger, table)
+	return nil
+}
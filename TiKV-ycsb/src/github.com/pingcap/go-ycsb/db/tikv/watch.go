@@ -0,0 +1,93 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/go-ycsb/pkg/util"
+	"github.com/pingcap/tidb/kv"
+)
+
+// WatchChanges polls the table every interval until ctx is done and calls fn
+// with the logical key and the decoded row of every row changed since the last
+// poll, and with a nil row for every deleted row. It is not a change feed: the
+// first poll only takes the rows as they are, a row changed twice between two
+// polls is reported once, and a row changed back to the value it had is not
+// reported. Every poll scans the whole table and a hash of every row is kept,
+// so it only suits small tables. fn is called from the goroutine of
+// WatchChanges, it returns the scan error which stopped polling, or the error
+// of ctx.
+func (db *rawDB) WatchChanges(ctx context.Context, table string, interval time.Duration, fn func(key string, row map[string][]byte)) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid watch interval %s", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var hashes map[string]int64
+	for {
+		next, err := db.pollChanges(ctx, table, hashes, fn)
+		if err != nil {
+			return err
+		}
+		hashes = next
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollChanges scans the table and returns the hash of every row by its logical
+// key, it calls fn for the rows which differ from last, unless last is nil.
+func (db *rawDB) pollChanges(ctx context.Context, table string, last map[string]int64, fn func(key string, row map[string][]byte)) (map[string]int64, error) {
+	c := db.tableCodec(table)
+	prefix := c.appendTablePrefix(nil, table)
+	it := db.newIterator(ctx, prefix, kv.Key(prefix).PrefixNext())
+	hashes := make(map[string]int64, len(last))
+	for it.Next() {
+		key, err := c.logicalKey(table, it.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		hash := util.BytesHash64(it.Value())
+		hashes[key] = hash
+		if old, ok := last[key]; last == nil || (ok && old == hash) {
+			continue
+		}
+
+		row, err := c.decodeRow(ctx, it.Value(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("decode row of key %q in table %s: %v", key, table, err)
+		}
+		fn(key, row)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	for key := range last {
+		if _, ok := hashes[key]; !ok {
+			fn(key, nil)
+		}
+	}
+	return hashes, nil
+}
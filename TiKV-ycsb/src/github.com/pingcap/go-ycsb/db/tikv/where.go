@@ -0,0 +1,89 @@
+// Copyright 2018 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// scanRowsWhere scans count rows of the table from the startKey with scan and
+// decodes only the rows whose field equals equals, it returns the number of
+// rows filtered out.
+func (c *codec) scanRowsWhere(ctx context.Context, table string, startKey string, count int, field string, equals []byte, fields []string, scan scanFunc) ([]map[string][]byte, int64, error) {
+	if _, ok := c.fieldIndices[field]; !ok {
+		return nil, 0, fmt.Errorf("field %s is not one of the %d fields", field, len(c.fields))
+	}
+
+	_, rows, err := c.scanRowPairs(table, startKey, count, scan)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The matching rows are moved to the front of rows, so only they are
+	// decoded with all the fields.
+	where := []string{field}
+	n := 0
+	for _, row := range rows {
+		values, err := c.decodeRow(ctx, row, where)
+		if err != nil {
+			return nil, 0, err
+		}
+		if v, ok := values[field]; ok && bytes.Equal(v, equals) {
+			rows[n] = row
+			n++
+		}
+	}
+
+	res, err := c.decodeRows(ctx, rows[:n], fields)
+	return res, int64(len(rows) - n), err
+}
+
+// ScanWhere is Scan, but it only returns the scanned rows whose field equals
+// equals, so it may return fewer than count rows. The rows are filtered by the
+// driver after they are read, the filtered out ones are counted as
+// "scan_filtered" in Stats.
+func (db *rawDB) ScanWhere(ctx context.Context, table string, startKey string, count int, field string, equals []byte, fields []string) (_ []map[string][]byte, err error) {
+	defer wrapRawError(&err, "scan", table, startKey)
+
+	op := db.profile.begin("scan")
+	defer op.end()
+
+	db.countScan()
+	res, filtered, err := db.tableCodec(table).scanRowsWhere(ctx, table, startKey, count, field, equals, fields, db.scanFunc(&op))
+	db.stats.add("scan_filtered", filtered)
+	return res, err
+}
+
+// ScanWhere is rawDB.ScanWhere in a transaction.
+func (db *txnDB) ScanWhere(ctx context.Context, table string, startKey string, count int, field string, equals []byte, fields []string) ([]map[string][]byte, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, filtered, err := db.scanRowsWhere(ctx, table, startKey, count, field, equals, fields, txnScan(tx))
+	db.stats.add("scan_filtered", filtered)
+	return res, err
+}
+
+// ScanWhere is routed like Scan.
+func (db *mixedDB) ScanWhere(ctx context.Context, table string, startKey string, count int, field string, equals []byte, fields []string) ([]map[string][]byte, error) {
+	if txn, ok := db.route("scan").(*txnDB); ok {
+		return txn.ScanWhere(ctx, table, startKey, count, field, equals, fields)
+	}
+	return db.raw.ScanWhere(ctx, table, startKey, count, field, equals, fields)
+}
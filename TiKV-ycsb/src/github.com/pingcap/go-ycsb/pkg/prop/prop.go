@@ -75,6 +75,8 @@ const (
 	// "ordered", "hashed"
 	InsertOrder                   = "insertorder"
 	InsertOrderDefault            = "hashed"
+	KeyPrefix                     = "keyprefix"
+	KeyPrefixDefault              = "user"
 	HotspotDataFraction           = "hotspotdatafraction"
 	HotspotDataFractionDefault    = float64(0.2)
 	HotspotOpnFraction            = "hotspotopnfraction"
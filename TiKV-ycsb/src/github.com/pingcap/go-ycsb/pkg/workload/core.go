@@ -72,6 +72,7 @@ type core struct {
 	orderedInserts               bool
 	recordCount                  int64
 	zeroPadding                  int64
+	keyPrefix                    string
 	insertionRetryLimit          int64
 	insertionRetryInterval       int64
 
@@ -155,7 +156,7 @@ func (c *core) buildKeyName(keyNum int64) string {
 		keyNum = util.Hash64(keyNum)
 	}
 
-	return fmt.Sprintf("user%0[2]*[1]d", keyNum, c.zeroPadding)
+	return fmt.Sprintf("%s%0[3]*[2]d", c.keyPrefix, keyNum, c.zeroPadding)
 }
 
 func (c *core) buildSingleValue(state *coreState, key string) map[string][]byte {
@@ -472,6 +473,7 @@ func (coreCreator) Create(p *properties.Properties) (ycsb.Workload, error) {
 			c.recordCount, insertStart, insertCount)
 	}
 	c.zeroPadding = p.GetInt64(prop.ZeroPadding, prop.ZeroPaddingDefault)
+	c.keyPrefix = p.GetString(prop.KeyPrefix, prop.KeyPrefixDefault)
 	c.readAllFields = p.GetBool(prop.ReadAllFields, prop.ReadALlFieldsDefault)
 	c.writeAllFields = p.GetBool(prop.WriteAllFields, prop.WriteAllFieldsDefault)
 	c.dataIntegrity = p.GetBool(prop.DataIntegrity, prop.DataIntegrityDefault)
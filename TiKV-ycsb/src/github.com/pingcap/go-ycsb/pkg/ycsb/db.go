@@ -70,6 +70,23 @@ type DB interface {
 	Delete(ctx context.Context, table string, key string) error
 }
 
+// BatchDB is implemented by the databases which read or insert a group of
+// records in one call.
+type BatchDB interface {
+	// BatchRead reads the records of the keys.
+	// table: The name of the table.
+	// keys: The record keys of the records to read.
+	// fields: The list of fields to read, nil|empty for reading all.
+	// It returns the records in the order of the keys, nil for a missing one.
+	BatchRead(ctx context.Context, table string, keys []string, fields []string) ([]map[string][]byte, error)
+
+	// BatchInsert inserts a group of records in the database.
+	// table: The name of the table.
+	// keys: The record keys of the records to insert.
+	// values: The field/value pairs of each record, values[i] is the record of keys[i].
+	BatchInsert(ctx context.Context, table string, keys []string, values []map[string][]byte) error
+}
+
 var dbCreators = map[string]DBCreator{}
 
 // RegisterDBCreator registers a creator for the database